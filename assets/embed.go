@@ -1,53 +1,87 @@
 package assets
 
 import (
-	"bytes"
 	"embed"
 	"fmt"
 	"image"
-	"image/jpeg"
-	"image/png"
+	"io/fs"
+	"math/rand"
 	"strings"
+	"sync"
 )
 
 // Embedded captcha assets to avoid runtime filesystem dependency.
 //
-//go:embed image/gopherbg.jpg image/emoji/*.png
+//go:embed image/manifest.yaml image/gopherbg.jpg image/emoji/*.png
 var files embed.FS
 
-func LoadBackground() (image.Image, error) {
-	return decodeJPEG("image/gopherbg.jpg")
-}
+var (
+	embeddedOnce sync.Once
+	embeddedPack *Pack
+	embeddedErr  error
 
-func LoadEmojiByKey(key string) (image.Image, error) {
-	clean := strings.TrimSpace(key)
-	if clean == "" {
-		return nil, fmt.Errorf("emoji key must not be empty")
+	activeMu   sync.RWMutex
+	activePack *Pack
+)
+
+// Embedded returns the asset pack compiled into the binary.
+func Embedded() *Pack {
+	embeddedOnce.Do(func() {
+		sub, err := fs.Sub(files, "image")
+		if err != nil {
+			embeddedErr = fmt.Errorf("open embedded asset pack: %w", err)
+			return
+		}
+		embeddedPack, embeddedErr = loadPack(sub, "embedded")
+	})
+	if embeddedErr != nil {
+		// The embedded pack is part of the build; failing here means the
+		// binary itself is broken.
+		panic(embeddedErr)
 	}
-	path := fmt.Sprintf("image/emoji/%s.png", clean)
-	return decodePNG(path)
+	return embeddedPack
 }
 
-func decodeJPEG(path string) (image.Image, error) {
-	data, err := files.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("read embedded asset %q: %w", path, err)
+// Use makes pack the source for LoadBackground, LoadEmojiByKey and Current.
+// A nil pack restores the embedded one.
+func Use(pack *Pack) {
+	activeMu.Lock()
+	activePack = pack
+	activeMu.Unlock()
+}
+
+// Current returns the asset pack in use.
+func Current() *Pack {
+	activeMu.RLock()
+	pack := activePack
+	activeMu.RUnlock()
+	if pack == nil {
+		return Embedded()
 	}
-	img, err := jpeg.Decode(bytes.NewReader(data))
-	if err != nil {
-		return nil, fmt.Errorf("decode embedded jpeg %q: %w", path, err)
+	return pack
+}
+
+// LoadBackground returns a random background from the current pack. The
+// image is shared and must not be modified.
+func LoadBackground() (image.Image, error) {
+	pack := Current()
+	if len(pack.backgrounds) == 0 {
+		return nil, fmt.Errorf("asset pack %s has no backgrounds", pack.Source())
 	}
-	return img, nil
+	return pack.image(pack.backgrounds[rand.Intn(len(pack.backgrounds))])
 }
 
-func decodePNG(path string) (image.Image, error) {
-	data, err := files.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("read embedded asset %q: %w", path, err)
+// LoadEmojiByKey returns the emoji image for key from the current pack. The
+// image is shared and must not be modified.
+func LoadEmojiByKey(key string) (image.Image, error) {
+	clean := strings.TrimSpace(key)
+	if clean == "" {
+		return nil, fmt.Errorf("emoji key must not be empty")
 	}
-	img, err := png.Decode(bytes.NewReader(data))
-	if err != nil {
-		return nil, fmt.Errorf("decode embedded png %q: %w", path, err)
+	pack := Current()
+	emoji, ok := pack.emojis[clean]
+	if !ok {
+		return nil, fmt.Errorf("emoji key %q not found in asset pack %s", clean, pack.Source())
 	}
-	return img, nil
+	return pack.image(emoji.File)
 }
@@ -0,0 +1,213 @@
+package assets
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ManifestFile is the manifest name expected at the root of an asset pack
+// directory.
+const ManifestFile = "manifest.yaml"
+
+// emojiKeyPattern keeps keys usable as Telegram callback identifiers.
+var emojiKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// Manifest describes the files of an asset pack.
+type Manifest struct {
+	Emojis      []ManifestEmoji `yaml:"emojis"`
+	Backgrounds []string        `yaml:"backgrounds"`
+}
+
+type ManifestEmoji struct {
+	Key      string `yaml:"key"`
+	Emoji    string `yaml:"emoji"`
+	File     string `yaml:"file"`
+	Category string `yaml:"category"`
+}
+
+// Emoji is one validated emoji of an asset pack.
+type Emoji struct {
+	Key      string
+	Char     string
+	File     string
+	Category string
+}
+
+// Pack is a validated set of emoji images and backgrounds. Every image is
+// decoded once while the pack loads and kept in memory, so rendering never
+// touches the filesystem or the image decoders.
+type Pack struct {
+	source      string
+	fsys        fs.FS
+	emojis      map[string]Emoji
+	keys        []string
+	backgrounds []string
+	images      map[string]image.Image
+}
+
+// LoadPack reads and validates the asset pack in dir. Every referenced image
+// is decoded and cached so broken files are reported at startup rather than
+// while rendering a challenge.
+func LoadPack(dir string) (*Pack, error) {
+	clean := strings.TrimSpace(dir)
+	if clean == "" {
+		return nil, fmt.Errorf("asset pack directory must not be empty")
+	}
+	info, err := os.Stat(clean)
+	if err != nil {
+		return nil, fmt.Errorf("open asset pack %q: %w", clean, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("asset pack %q is not a directory", clean)
+	}
+	return loadPack(os.DirFS(clean), filepath.Clean(clean))
+}
+
+func loadPack(fsys fs.FS, source string) (*Pack, error) {
+	raw, err := fs.ReadFile(fsys, ManifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("read asset pack %s manifest: %w", source, err)
+	}
+
+	var manifest Manifest
+	if err := yaml.UnmarshalStrict(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("decode asset pack %s manifest: %w", source, err)
+	}
+
+	pack := &Pack{
+		source: source,
+		fsys:   fsys,
+		emojis: make(map[string]Emoji, len(manifest.Emojis)),
+		images: make(map[string]image.Image, len(manifest.Emojis)+len(manifest.Backgrounds)),
+	}
+
+	if len(manifest.Emojis) == 0 {
+		return nil, fmt.Errorf("asset pack %s: emojis must not be empty", source)
+	}
+	for i, entry := range manifest.Emojis {
+		emoji := Emoji{
+			Key:      strings.TrimSpace(entry.Key),
+			Char:     strings.TrimSpace(entry.Emoji),
+			File:     strings.TrimSpace(entry.File),
+			Category: strings.TrimSpace(entry.Category),
+		}
+		if !emojiKeyPattern.MatchString(emoji.Key) {
+			return nil, fmt.Errorf("asset pack %s: emojis[%d].key must be 1-32 characters of A-Z, a-z, 0-9, _ or -", source, i)
+		}
+		if _, exists := pack.emojis[emoji.Key]; exists {
+			return nil, fmt.Errorf("asset pack %s: emojis[%d].key duplicates %q", source, i, emoji.Key)
+		}
+		if emoji.Char == "" {
+			return nil, fmt.Errorf("asset pack %s: emojis[%d].emoji is required", source, i)
+		}
+		if emoji.File == "" {
+			return nil, fmt.Errorf("asset pack %s: emojis[%d].file is required", source, i)
+		}
+		if !strings.EqualFold(path.Ext(emoji.File), ".png") {
+			return nil, fmt.Errorf("asset pack %s: emojis[%d].file must be a PNG image", source, i)
+		}
+		if err := pack.cache(emoji.File); err != nil {
+			return nil, fmt.Errorf("asset pack %s: emojis[%d].file: %w", source, i, err)
+		}
+		pack.emojis[emoji.Key] = emoji
+		pack.keys = append(pack.keys, emoji.Key)
+	}
+	sort.Strings(pack.keys)
+
+	if len(manifest.Backgrounds) == 0 {
+		return nil, fmt.Errorf("asset pack %s: backgrounds must not be empty", source)
+	}
+	for i, background := range manifest.Backgrounds {
+		file := strings.TrimSpace(background)
+		if file == "" {
+			return nil, fmt.Errorf("asset pack %s: backgrounds[%d] must not be empty", source, i)
+		}
+		if err := pack.cache(file); err != nil {
+			return nil, fmt.Errorf("asset pack %s: backgrounds[%d]: %w", source, i, err)
+		}
+		pack.backgrounds = append(pack.backgrounds, file)
+	}
+
+	return pack, nil
+}
+
+// Source names where the pack was loaded from.
+func (p *Pack) Source() string {
+	return p.source
+}
+
+// EmojiKeys returns the sorted emoji keys of the pack.
+func (p *Pack) EmojiKeys() []string {
+	return append([]string(nil), p.keys...)
+}
+
+func (p *Pack) Emoji(key string) (Emoji, bool) {
+	emoji, ok := p.emojis[key]
+	return emoji, ok
+}
+
+func (p *Pack) EmojiCount() int {
+	return len(p.keys)
+}
+
+func (p *Pack) BackgroundCount() int {
+	return len(p.backgrounds)
+}
+
+// image returns the cached decoded image for name. Cached images are shared
+// between callers and must not be modified.
+func (p *Pack) image(name string) (image.Image, error) {
+	img, ok := p.images[name]
+	if !ok {
+		return nil, fmt.Errorf("asset %q is not part of pack %s", name, p.source)
+	}
+	return img, nil
+}
+
+func (p *Pack) cache(name string) error {
+	if _, ok := p.images[name]; ok {
+		return nil
+	}
+	img, err := p.decode(name)
+	if err != nil {
+		return err
+	}
+	p.images[name] = img
+	return nil
+}
+
+func (p *Pack) decode(name string) (image.Image, error) {
+	if !fs.ValidPath(name) {
+		return nil, fmt.Errorf("invalid asset path %q", name)
+	}
+	data, err := fs.ReadFile(p.fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("read asset %q: %w", name, err)
+	}
+
+	var img image.Image
+	switch strings.ToLower(path.Ext(name)) {
+	case ".png":
+		img, err = png.Decode(bytes.NewReader(data))
+	case ".jpg", ".jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("unsupported asset format %q", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode asset %q: %w", name, err)
+	}
+	return img, nil
+}
@@ -0,0 +1,223 @@
+package assets
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestImage(t *testing.T, path string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("MkdirAll returned error: %v", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	defer f.Close()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	img.SetNRGBA(1, 1, color.NRGBA{R: 255, A: 255})
+	if strings.HasSuffix(path, ".png") {
+		err = png.Encode(f, img)
+	} else {
+		err = jpeg.Encode(f, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("encode %s returned error: %v", path, err)
+	}
+}
+
+func writeTestPack(t *testing.T, manifest string, images ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, name := range images {
+		writeTestImage(t, filepath.Join(dir, name))
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestFile), []byte(manifest), 0o600); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+	return dir
+}
+
+const validTestManifest = `
+emojis:
+  - key: cat
+    emoji: "🐱"
+    file: emoji/cat.png
+    category: animal
+  - key: dog
+    emoji: "🐶"
+    file: emoji/dog.png
+backgrounds:
+  - bg/one.jpg
+  - bg/two.png
+`
+
+func TestLoadPack(t *testing.T) {
+	t.Parallel()
+
+	dir := writeTestPack(t, validTestManifest, "emoji/cat.png", "emoji/dog.png", "bg/one.jpg", "bg/two.png")
+	pack, err := LoadPack(dir)
+	if err != nil {
+		t.Fatalf("LoadPack returned error: %v", err)
+	}
+
+	if pack.EmojiCount() != 2 {
+		t.Fatalf("EmojiCount() = %d, want 2", pack.EmojiCount())
+	}
+	if pack.BackgroundCount() != 2 {
+		t.Fatalf("BackgroundCount() = %d, want 2", pack.BackgroundCount())
+	}
+	if keys := pack.EmojiKeys(); strings.Join(keys, ",") != "cat,dog" {
+		t.Fatalf("EmojiKeys() = %v, want [cat dog]", keys)
+	}
+	cat, ok := pack.Emoji("cat")
+	if !ok {
+		t.Fatalf("Emoji(cat) not found")
+	}
+	if cat.Char != "🐱" || cat.Category != "animal" {
+		t.Fatalf("Emoji(cat) = %+v, want char and category from manifest", cat)
+	}
+	if dog, _ := pack.Emoji("dog"); dog.Category != "" {
+		t.Fatalf("Emoji(dog).Category = %q, want empty", dog.Category)
+	}
+	if pack.Source() != filepath.Clean(dir) {
+		t.Fatalf("Source() = %q, want %q", pack.Source(), filepath.Clean(dir))
+	}
+}
+
+func TestLoadPackRejectsInvalidPacks(t *testing.T) {
+	t.Parallel()
+
+	allImages := []string{"emoji/cat.png", "emoji/dog.png", "bg/one.jpg", "bg/two.png"}
+	tests := []struct {
+		name     string
+		manifest string
+		images   []string
+		wantErr  string
+	}{
+		{
+			name:     "empty manifest",
+			manifest: "",
+			wantErr:  "emojis must not be empty",
+		},
+		{
+			name:     "unknown manifest field",
+			manifest: "emoji:\n  - key: cat\n",
+			wantErr:  "decode asset pack",
+		},
+		{
+			name:     "missing emoji file",
+			manifest: validTestManifest,
+			images:   []string{"emoji/cat.png", "bg/one.jpg", "bg/two.png"},
+			wantErr:  "emojis[1].file",
+		},
+		{
+			name:     "duplicate key",
+			manifest: strings.Replace(validTestManifest, "key: dog", "key: cat", 1),
+			images:   allImages,
+			wantErr:  "emojis[1].key duplicates",
+		},
+		{
+			name:     "invalid key",
+			manifest: strings.Replace(validTestManifest, "key: dog", "key: \"dog face\"", 1),
+			images:   allImages,
+			wantErr:  "emojis[1].key",
+		},
+		{
+			name:     "missing emoji character",
+			manifest: strings.Replace(validTestManifest, `emoji: "🐶"`, `emoji: ""`, 1),
+			images:   allImages,
+			wantErr:  "emojis[1].emoji is required",
+		},
+		{
+			name:     "non png emoji",
+			manifest: strings.Replace(validTestManifest, "file: emoji/dog.png", "file: bg/one.jpg", 1),
+			images:   allImages,
+			wantErr:  "must be a PNG image",
+		},
+		{
+			name:     "path outside pack",
+			manifest: strings.Replace(validTestManifest, "file: emoji/dog.png", "file: ../dog.png", 1),
+			images:   allImages,
+			wantErr:  "invalid asset path",
+		},
+		{
+			name:     "no backgrounds",
+			manifest: strings.Split(validTestManifest, "backgrounds:")[0],
+			images:   allImages,
+			wantErr:  "backgrounds must not be empty",
+		},
+		{
+			name:     "missing background",
+			manifest: validTestManifest,
+			images:   []string{"emoji/cat.png", "emoji/dog.png", "bg/one.jpg"},
+			wantErr:  "backgrounds[1]",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeTestPack(t, tt.manifest, tt.images...)
+			_, err := LoadPack(dir)
+			if err == nil {
+				t.Fatalf("LoadPack expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadPack error = %q, want substring %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadPackRejectsMissingDirectory(t *testing.T) {
+	t.Parallel()
+
+	if _, err := LoadPack(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatalf("LoadPack expected error for missing directory")
+	}
+}
+
+func TestEmbeddedPack(t *testing.T) {
+	t.Parallel()
+
+	pack := Embedded()
+	if pack.Source() != "embedded" {
+		t.Fatalf("Source() = %q, want embedded", pack.Source())
+	}
+	if pack.EmojiCount() == 0 || pack.BackgroundCount() == 0 {
+		t.Fatalf("embedded pack emojis=%d backgrounds=%d, want both non-zero", pack.EmojiCount(), pack.BackgroundCount())
+	}
+	if Current() != pack {
+		t.Fatalf("Current() without Use should return the embedded pack")
+	}
+	first, err := LoadEmojiByKey(pack.EmojiKeys()[0])
+	if err != nil {
+		t.Fatalf("LoadEmojiByKey returned error: %v", err)
+	}
+	second, err := LoadEmojiByKey(pack.EmojiKeys()[0])
+	if err != nil {
+		t.Fatalf("LoadEmojiByKey returned error: %v", err)
+	}
+	if first != second {
+		t.Fatalf("LoadEmojiByKey decoded the emoji again instead of using the cache")
+	}
+	if _, err := LoadBackground(); err != nil {
+		t.Fatalf("LoadBackground returned error: %v", err)
+	}
+	if _, err := LoadEmojiByKey("does_not_exist"); err == nil {
+		t.Fatalf("LoadEmojiByKey expected error for unknown key")
+	}
+}
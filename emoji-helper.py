@@ -4,6 +4,23 @@ import sys
 
 emojis = "🍜🥘🧆🍤🦪🍭🍦🍯🥜🍩🍿🍷🧉🍽🥄🍫🍬🧅🍖🍗🍕🌮🔥🌈🐶🐒🦉🥾💍🌂🚚🚜🛵🧨🧲🔮🎉"
 
+# Categories keep odd_one_out from hiding an emoji among similar ones.
+categories = {
+    "food": "🍜🥘🧆🍤🦪🍭🍦🍯🥜🍩🍿🍫🍬🧅🍖🍗🍕🌮",
+    "drink": "🍷🧉",
+    "tableware": "🍽🥄",
+    "nature": "🔥🌈",
+    "animal": "🐶🐒🦉",
+    "object": "🥾💍🌂🧨🧲🔮🎉",
+    "vehicle": "🚚🚜🛵",
+}
+
+def category(emoji):
+    for name, members in categories.items():
+        if emoji in members:
+            return name
+    return None
+
 def download_emoji():
     for emoji in emojis:
         code = 'u{:x}'.format(ord(emoji))
@@ -12,12 +29,19 @@ def download_emoji():
         urllib.request.urlretrieve(emoji_img_url, f"./assets/image/emoji/{code}.png")
         print(emoji, " downloaded...")
 
-def emoji_map():
-    emoji_map = {}
+def manifest():
+    print("# Embedded captcha asset pack. Paths are relative to this file.")
+    print("# Regenerate the emoji list with `python3 emoji-helper.py manifest`.")
+    print("emojis:")
     for emoji in emojis:
         code = 'u{:x}'.format(ord(emoji))
-        emoji_map[code] = emoji
-    print(json.dumps(emoji_map, ensure_ascii=False))
+        print(f"  - key: {code}")
+        print(f"    emoji: {json.dumps(emoji, ensure_ascii=False)}")
+        print(f"    file: emoji/{code}.png")
+        if category(emoji):
+            print(f"    category: {category(emoji)}")
+    print("backgrounds:")
+    print("  - gopherbg.jpg")
 
 if __name__ == '__main__':
-    globals()[sys.argv[1]]()
\ No newline at end of file
+    globals()[sys.argv[1]]()
@@ -5,11 +5,8 @@ go 1.17
 require (
 	github.com/codenoid/goimagemerge v0.0.0-20211027160205-266d003ce8fc
 	github.com/codenoid/minikv v0.0.0-20211028012128-5cd19256ff8d
+	github.com/disintegration/imaging v1.6.2
+	golang.org/x/image v0.10.0
 	gopkg.in/telebot.v3 v3.3.6
 	gopkg.in/yaml.v2 v2.4.0
 )
-
-require (
-	github.com/disintegration/imaging v1.6.2 // indirect
-	golang.org/x/image v0.10.0 // indirect
-)
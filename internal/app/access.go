@@ -1,11 +1,9 @@
 package app
 
 import (
-	"fmt"
-	"log"
-
 	tele "gopkg.in/telebot.v3"
-	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/challengestore"
+	"toshiki-captcha-bot/internal/logging"
 	"toshiki-captcha-bot/internal/policy"
 )
 
@@ -18,7 +16,7 @@ func isPublicGroupChat(chat *tele.Chat) bool {
 }
 
 func isAllowedCommandChat(chat *tele.Chat) bool {
-	return policy.IsAllowedCommandChat(chat, cfg)
+	return policy.IsAllowedCommandChat(chat, currentConfig())
 }
 
 func leaveChat(chat *tele.Chat, reason string) {
@@ -26,19 +24,27 @@ func leaveChat(chat *tele.Chat, reason string) {
 		return
 	}
 	if bot == nil {
-		log.Printf("warn: leave skipped chat_id=%d reason=%s err=bot_not_initialized", chat.ID, reason)
+		logging.Warn("leave_skipped", "chat_id", chat.ID, "reason", reason, "err", "bot_not_initialized")
+		return
+	}
+	// Log chats are often private groups that would otherwise be left as
+	// unsupported or unauthorized.
+	if currentConfig().IsLogChat(chat.ID) {
+		logging.Info("leave_skipped", "chat_id", chat.ID, "reason", reason, "err", "log_chat")
 		return
 	}
 	if err := bot.Leave(chat); err != nil {
-		log.Printf("warn: failed to leave chat chat_id=%d reason=%s err=%v", chat.ID, reason, err)
+		logging.Warn("failed_to_leave_chat", "chat_id", chat.ID, "reason", reason, "err", err)
 	}
 }
 
+// leaveIfUnsupportedPrivateGroup leaves private groups that are not
+// allowlisted by chat ID and reports whether it did.
 func leaveIfUnsupportedPrivateGroup(chat *tele.Chat, trigger string) bool {
-	if !policy.IsGroupChat(chat) || policy.IsPublicGroupChat(chat) {
+	if !policy.IsGroupChat(chat) || policy.IsSupportedGroupChat(chat, currentConfig()) {
 		return false
 	}
-	log.Printf("Unsupported chat type for captcha bot chat_id=%d chat_type=%s trigger=%s reason=private_group_without_username", chat.ID, chat.Type, trigger)
+	logging.Info("unsupported_chat_type", "chat_id", chat.ID, "chat_type", chat.Type, "trigger", trigger, "reason", "private_group_without_username")
 	leaveChat(chat, "private_group_without_username")
 	return true
 }
@@ -47,14 +53,14 @@ func isContextAuthorized(c tele.Context) bool {
 	if c == nil || c.Chat() == nil {
 		return false
 	}
-	return policy.IsAuthorizedGroupChat(c.Chat(), cfg)
+	return policy.IsAuthorizedGroupChat(c.Chat(), currentConfig())
 }
 
 func isSenderAllowed(c tele.Context) bool {
 	if c == nil || c.Sender() == nil {
 		return false
 	}
-	return policy.IsAllowedUserID(c.Sender().ID, cfg)
+	return policy.IsAllowedUserID(c.Sender().ID, currentConfig())
 }
 
 func logAccessDenied(c tele.Context, event string) {
@@ -66,7 +72,7 @@ func logAccessDenied(c tele.Context, event string) {
 	if c != nil && c.Sender() != nil {
 		userID = c.Sender().ID
 	}
-	log.Printf("Access denied event=%s chat_id=%d user_id=%d public_mode=%t", event, chatID, userID, cfg.IsPublicMode())
+	logging.Info("access_denied", "trigger", event, "chat_id", chatID, "user_id", userID, "public_mode", currentConfig().IsPublicMode())
 }
 
 func onAddedToGroup(c tele.Context) error {
@@ -95,12 +101,12 @@ func onUserLeft(c tele.Context) error {
 	}
 
 	if err := c.Delete(); err != nil {
-		log.Printf("warn: failed to delete leave-event message chat_id=%d err=%v", c.Chat().ID, err)
+		logging.Warn("failed_to_delete_leave_event_message", "chat_id", c.Chat().ID, "err", err)
 	}
 
 	if c.Sender() != nil {
 		cleanupPendingCaptchaForUser(c.Chat(), c.Sender())
-		log.Printf("User left user_id=%d chat_id=%d", c.Sender().ID, c.Chat().ID)
+		logging.Info("user_left", "user_id", c.Sender().ID, "chat_id", c.Chat().ID)
 	}
 
 	return nil
@@ -111,23 +117,21 @@ func cleanupPendingCaptchaForUser(chat *tele.Chat, user *tele.User) {
 		return
 	}
 
-	kvID := fmt.Sprintf("%v-%v", user.ID, chat.ID)
-	value, found := db.Get(kvID)
+	kvID := challengestore.Key(user.ID, chat.ID)
+	status, found := db.Get(kvID)
 	if !found {
 		return
 	}
 
-	if status, ok := value.(captcha.JoinStatus); ok {
-		if bot == nil {
-			log.Printf("warn: pending captcha cleanup skipped reason=bot_not_initialized chat_id=%d user_id=%d", chat.ID, user.ID)
-		} else if status.CaptchaMessage.ID > 0 {
-			if err := bot.Delete(&status.CaptchaMessage); err != nil {
-				log.Printf("warn: failed to delete pending captcha on user leave chat_id=%d user_id=%d message_id=%d err=%v", chat.ID, user.ID, status.CaptchaMessage.ID, err)
-			}
+	if bot == nil {
+		logging.Warn("pending_captcha_cleanup_skipped", "reason", "bot_not_initialized", "chat_id", chat.ID, "user_id", user.ID)
+	} else if status.CaptchaMessage.ID > 0 {
+		if err := bot.Delete(&status.CaptchaMessage); err != nil {
+			logging.Warn("failed_to_delete_pending_captcha_on_user_leave", "chat_id", chat.ID, "user_id", user.ID, "message_id", status.CaptchaMessage.ID, "err", err)
 		}
 	}
 
 	if err := db.Delete(kvID); err != nil {
-		log.Printf("warn: failed to delete pending captcha state on user leave chat_id=%d user_id=%d err=%v", chat.ID, user.ID, err)
+		logging.Warn("failed_to_delete_pending_captcha_state_on_user_leave", "chat_id", chat.ID, "user_id", user.ID, "err", err)
 	}
 }
@@ -1,13 +1,13 @@
 package app
 
 import (
-	"fmt"
 	"testing"
 	"time"
 
-	"github.com/codenoid/minikv"
 	tele "gopkg.in/telebot.v3"
 	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/challengestore"
+	"toshiki-captcha-bot/internal/settings"
 )
 
 func TestCleanupPendingCaptchaForUserDeletesState(t *testing.T) {
@@ -18,12 +18,12 @@ func TestCleanupPendingCaptchaForUserDeletesState(t *testing.T) {
 		bot = origBot
 	})
 
-	db = minikv.New(time.Minute, time.Hour)
+	db = challengestore.NewMemory(time.Minute, time.Hour)
 	bot = nil
 
 	chat := &tele.Chat{ID: -100123}
 	user := &tele.User{ID: 1001}
-	key := fmt.Sprintf("%v-%v", user.ID, chat.ID)
+	key := challengestore.Key(user.ID, chat.ID)
 	db.Set(key, captcha.JoinStatus{
 		UserID:  user.ID,
 		ChatID:  chat.ID,
@@ -53,10 +53,35 @@ func TestCleanupPendingCaptchaForUserNoopForMissingEntry(t *testing.T) {
 		bot = origBot
 	})
 
-	db = minikv.New(time.Minute, time.Hour)
+	db = challengestore.NewMemory(time.Minute, time.Hour)
 	bot = nil
 
 	chat := &tele.Chat{ID: -100123}
 	user := &tele.User{ID: 1001}
 	cleanupPendingCaptchaForUser(chat, user)
 }
+
+func TestLeaveIfUnsupportedPrivateGroup(t *testing.T) {
+	origCfg := cfg
+	origBot := bot
+	t.Cleanup(func() {
+		cfg = origCfg
+		bot = origBot
+	})
+	bot = nil
+
+	config := settings.DefaultRuntimeConfig()
+	config.Bot.AdminUserIDs = []int64{1001}
+	config.Groups = []settings.GroupTopicConfig{{ID: "-1001234567890"}}
+	cfg = mustValidatedRuntimeConfig(t, config)
+
+	if leaveIfUnsupportedPrivateGroup(&tele.Chat{ID: -1001234567890, Type: tele.ChatSuperGroup}, "test") {
+		t.Fatalf("allowlisted private group was left")
+	}
+	if leaveIfUnsupportedPrivateGroup(&tele.Chat{ID: -1, Type: tele.ChatSuperGroup, Username: "somegroup"}, "test") {
+		t.Fatalf("public group was left")
+	}
+	if !leaveIfUnsupportedPrivateGroup(&tele.Chat{ID: -1002, Type: tele.ChatSuperGroup}, "test") {
+		t.Fatalf("unlisted private group was not left")
+	}
+}
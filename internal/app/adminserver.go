@@ -0,0 +1,188 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"toshiki-captcha-bot/internal/challengestore"
+	"toshiki-captcha-bot/internal/logging"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+// adminServer is the optional HTTP listener for operational endpoints such
+// as health checks and metrics. Features mount their handlers before start.
+type adminServer struct {
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+func newAdminServer() *adminServer {
+	mux := http.NewServeMux()
+	return &adminServer{
+		mux: mux,
+		server: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Handle mounts handler at pattern.
+func (s *adminServer) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// start binds listen and serves in the background.
+func (s *adminServer) start(listen string) error {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Error("admin_server_stopped", "listen", listen, "err", err)
+		}
+	}()
+	logging.Info("admin_server_listening", "listen", listener.Addr())
+	return nil
+}
+
+// stop shuts the server down. It is a no-op on a nil server.
+func (s *adminServer) stop() {
+	if s == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookShutdownWindow)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		logging.Warn("failed_to_shut_down_admin_server", "err", err)
+	}
+}
+
+// startAdminServer mounts the health endpoints, and metrics when enabled,
+// and starts serving. It returns nil when admin_server.listen is unset.
+func startAdminServer(config settings.RuntimeConfig) (*adminServer, error) {
+	if !config.AdminServerEnabled() {
+		return nil, nil
+	}
+	server := newAdminServer()
+	server.Handle(settings.HealthzPath, http.HandlerFunc(serveHealthz))
+	server.Handle(settings.ReadyzPath, http.HandlerFunc(serveReadyz))
+	if config.Metrics.Enabled {
+		server.Handle(config.Metrics.Path, metricsRegistry.Handler())
+		logging.Info("metrics_endpoint_mounted", "path", config.Metrics.Path)
+	}
+	if err := server.start(config.AdminServer.Listen); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// readiness records what /readyz reports on.
+type readiness struct {
+	mu             sync.Mutex
+	botInitialized bool
+	lastUpdatesAt  time.Time
+}
+
+var health = &readiness{}
+
+func (r *readiness) markBotInitialized() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.botInitialized = true
+}
+
+// markUpdatesReceived records a successful getUpdates call or webhook
+// request.
+func (r *readiness) markUpdatesReceived(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastUpdatesAt = now
+}
+
+type readinessCheck struct {
+	name   string
+	ok     bool
+	detail string
+}
+
+// check evaluates every readiness condition at now.
+func (r *readiness) check(now time.Time, threshold time.Duration, store challengestore.Store, shuttingDown bool) []readinessCheck {
+	r.mu.Lock()
+	botInitialized, lastUpdatesAt := r.botInitialized, r.lastUpdatesAt
+	r.mu.Unlock()
+
+	checks := make([]readinessCheck, 0, 4)
+	if botInitialized {
+		checks = append(checks, readinessCheck{name: "bot", ok: true, detail: "initialized"})
+	} else {
+		checks = append(checks, readinessCheck{name: "bot", detail: "not initialized"})
+	}
+
+	switch age := now.Sub(lastUpdatesAt); {
+	case lastUpdatesAt.IsZero():
+		checks = append(checks, readinessCheck{name: "updates", detail: "none received yet"})
+	case age > threshold:
+		checks = append(checks, readinessCheck{name: "updates", detail: fmt.Sprintf("last received %s ago, threshold %s", age.Round(time.Second), threshold)})
+	default:
+		checks = append(checks, readinessCheck{name: "updates", ok: true, detail: fmt.Sprintf("last received %s ago", age.Round(time.Second))})
+	}
+
+	switch {
+	case store == nil:
+		checks = append(checks, readinessCheck{name: "store", detail: "not opened"})
+	default:
+		if err := store.Check(); err != nil {
+			checks = append(checks, readinessCheck{name: "store", detail: err.Error()})
+		} else {
+			checks = append(checks, readinessCheck{name: "store", ok: true, detail: "reachable"})
+		}
+	}
+
+	if shuttingDown {
+		checks = append(checks, readinessCheck{name: "shutdown", detail: "in progress"})
+	}
+	return checks
+}
+
+func isShutdownRequested() bool {
+	select {
+	case <-shutdownRequested:
+		return true
+	default:
+		return false
+	}
+}
+
+// serveHealthz reports that the process is alive.
+func serveHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// serveReadyz reports 200 when every readiness check passes and 503
+// otherwise, listing each check on its own line.
+func serveReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := health.check(time.Now(), currentConfig().AdminServer.ReadyThreshold, db, isShutdownRequested())
+
+	status := http.StatusOK
+	lines := make([]string, 0, len(checks))
+	for _, check := range checks {
+		state := "ok"
+		if !check.ok {
+			state = "fail"
+			status = http.StatusServiceUnavailable
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s (%s)", check.name, state, check.detail))
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, strings.Join(lines, "\n"))
+}
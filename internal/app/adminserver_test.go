@@ -0,0 +1,147 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"toshiki-captcha-bot/internal/challengestore"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+type unreachableStore struct {
+	challengestore.Store
+}
+
+func (unreachableStore) Check() error {
+	return errors.New("disk full")
+}
+
+func TestReadinessCheck(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := challengestore.NewMemory(time.Minute, time.Minute)
+	tests := []struct {
+		name           string
+		botInitialized bool
+		lastUpdatesAt  time.Time
+		store          challengestore.Store
+		shuttingDown   bool
+		wantFailed     []string
+	}{
+		{
+			name:           "ready",
+			botInitialized: true,
+			lastUpdatesAt:  now.Add(-30 * time.Second),
+			store:          store,
+		},
+		{
+			name:       "starting up",
+			store:      store,
+			wantFailed: []string{"bot: not initialized", "updates: none received yet"},
+		},
+		{
+			name:           "updates stale",
+			botInitialized: true,
+			lastUpdatesAt:  now.Add(-3 * time.Minute),
+			store:          store,
+			wantFailed:     []string{"updates: last received 3m0s ago, threshold 2m0s"},
+		},
+		{
+			name:           "store unreachable",
+			botInitialized: true,
+			lastUpdatesAt:  now,
+			store:          unreachableStore{},
+			wantFailed:     []string{"store: disk full"},
+		},
+		{
+			name:           "store not opened",
+			botInitialized: true,
+			lastUpdatesAt:  now,
+			wantFailed:     []string{"store: not opened"},
+		},
+		{
+			name:           "shutting down",
+			botInitialized: true,
+			lastUpdatesAt:  now,
+			store:          store,
+			shuttingDown:   true,
+			wantFailed:     []string{"shutdown: in progress"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := &readiness{}
+			if tt.botInitialized {
+				r.markBotInitialized()
+			}
+			if !tt.lastUpdatesAt.IsZero() {
+				r.markUpdatesReceived(tt.lastUpdatesAt)
+			}
+
+			var failed []string
+			for _, check := range r.check(now, 2*time.Minute, tt.store, tt.shuttingDown) {
+				if !check.ok {
+					failed = append(failed, check.name+": "+check.detail)
+				}
+			}
+			if strings.Join(failed, "\n") != strings.Join(tt.wantFailed, "\n") {
+				t.Fatalf("failed checks = %q, want %q", failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestStartAdminServer(t *testing.T) {
+	t.Parallel()
+
+	server, err := startAdminServer(settings.DefaultRuntimeConfig())
+	if err != nil || server != nil {
+		t.Fatalf("startAdminServer without listen = %v, %v; want nil, nil", server, err)
+	}
+
+	tests := []struct {
+		name        string
+		metrics     bool
+		path        string
+		wantStatus  int
+		wantContent string
+	}{
+		{name: "healthz", path: settings.HealthzPath, wantStatus: http.StatusOK, wantContent: "ok\n"},
+		{name: "metrics mounted", metrics: true, path: "/metrics", wantStatus: http.StatusOK, wantContent: "# TYPE captcha_bot_pending_challenges gauge"},
+		{name: "metrics disabled", path: "/metrics", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := settings.DefaultRuntimeConfig()
+			config.AdminServer.Listen = "127.0.0.1:0"
+			config.Metrics.Enabled = tt.metrics
+			server, err := startAdminServer(config)
+			if err != nil {
+				t.Fatalf("startAdminServer returned error: %v", err)
+			}
+			t.Cleanup(server.stop)
+
+			recorder := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("GET %s status = %d, want %d", tt.path, recorder.Code, tt.wantStatus)
+			}
+			if !strings.Contains(recorder.Body.String(), tt.wantContent) {
+				t.Fatalf("GET %s body = %q, want substring %q", tt.path, recorder.Body.String(), tt.wantContent)
+			}
+		})
+	}
+}
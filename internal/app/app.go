@@ -2,14 +2,14 @@ package app
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 
-	"github.com/codenoid/minikv"
 	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/challengestore"
 	"toshiki-captcha-bot/internal/cli"
 	"toshiki-captcha-bot/internal/commandscope"
+	"toshiki-captcha-bot/internal/logging"
 	"toshiki-captcha-bot/internal/settings"
 	"toshiki-captcha-bot/internal/version"
 )
@@ -18,16 +18,14 @@ var (
 	bot *tele.Bot
 
 	cfg = settings.DefaultRuntimeConfig()
-	db  *minikv.KV
+	db  challengestore.Store
 
-	commandScopeStatePath = commandscope.PathForConfig(settings.DefaultConfigPath)
+	commandScopeStatePath   = commandscope.PathForConfig(settings.DefaultConfigPath)
+	challengeStoreStatePath = challengestore.PathForConfig(settings.DefaultConfigPath)
 )
 
 // Main bootstraps and runs the Telegram bot process.
 func Main() {
-	log.SetFlags(log.LstdFlags | log.Lmsgprefix)
-	log.SetPrefix("[captcha-bot] ")
-
 	opts, err := cli.ParseArgs(os.Args[1:], settings.DefaultConfigPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n\n%s", err, cli.UsageText(settings.DefaultConfigPath))
@@ -42,53 +40,112 @@ func Main() {
 		fmt.Print(version.Text())
 		return
 	}
+	if opts.Command != cli.CommandRun {
+		os.Exit(runSubcommand(opts, os.Stdout, os.Stderr))
+	}
 
+	configPath = opts.ConfigPath
 	commandScopeStatePath = commandscope.PathForConfig(opts.ConfigPath)
+	challengeStoreStatePath = challengestore.PathForConfig(opts.ConfigPath)
 
 	loadedCfg, err := settings.Load(opts.ConfigPath)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		logging.Fatal("config_load_failed", "path", opts.ConfigPath, "err", err)
 	}
-	cfg = loadedCfg
-	db = minikv.New(cfg.Captcha.Expiration, cfg.Captcha.CleanupInterval)
-	log.Printf(
-		"Loaded config path=%q poll_timeout=%s request_timeout=%s public_mode=%t admin_user_ids=%d groups=%d topic_mappings=%d captcha_expiration=%s max_failures=%d",
-		opts.ConfigPath,
-		cfg.Bot.PollTimeout,
-		cfg.Bot.RequestTimeout,
-		cfg.IsPublicMode(),
-		cfg.AdminUserCount(),
-		cfg.GroupCount(),
-		cfg.TopicMappingCount(),
-		cfg.Captcha.Expiration,
-		cfg.Captcha.MaxFailures,
+	setConfig(loadedCfg)
+	configureLogging(loadedCfg)
+	logging.Info(
+		"config_loaded",
+		"path", opts.ConfigPath,
+		"mode", loadedCfg.Bot.Mode,
+		"poll_timeout", loadedCfg.Bot.PollTimeout,
+		"request_timeout", loadedCfg.Bot.RequestTimeout,
+		"public_mode", loadedCfg.IsPublicMode(),
+		"admin_user_ids", loadedCfg.AdminUserCount(),
+		"groups", loadedCfg.GroupCount(),
+		"topic_mappings", loadedCfg.TopicMappingCount(),
+		"captcha_expiration", loadedCfg.Captcha.Expiration,
+		"max_failures", loadedCfg.Captcha.MaxFailures,
+		"captcha_store", loadedCfg.Captcha.Store,
 	)
+	if err := installAssetPack(loadedCfg); err != nil {
+		logging.Fatal("asset_pack_load_failed", "dir", loadedCfg.Assets.Dir, "err", err)
+	}
+	startChallengePool(loadedCfg)
+
+	persisted, err := openChallengeStore()
+	if err != nil {
+		logging.Fatal("challenge_store_open_failed", "err", err)
+	}
 
 	// listen for janitor expiration removal ( 5*time.Second )
-	db.OnEvicted(onEvicted)
+	db.OnEvicted(trackedEviction)
+
+	admin, err := startAdminServer(loadedCfg)
+	if err != nil {
+		logging.Fatal("admin_server_start_failed", "listen", loadedCfg.AdminServer.Listen, "err", err)
+	}
+
+	poller, err := newPoller(loadedCfg)
+	if err != nil {
+		logging.Fatal("update_delivery_config_failed", "err", err)
+	}
 
 	b, err := tele.NewBot(tele.Settings{
-		Token:  cfg.Bot.Token,
-		Poller: &tele.LongPoller{Timeout: cfg.Bot.PollTimeout},
-		Client: &http.Client{Timeout: cfg.Bot.RequestTimeout},
+		Token:   loadedCfg.Bot.Token,
+		Poller:  trackedPoller{poller},
+		Client:  &http.Client{Timeout: loadedCfg.Bot.RequestTimeout, Transport: newAPITransport(nil)},
+		OnError: logHandlerError,
+		// trackedPoller runs every update in its own goroutine.
+		Synchronous: true,
 	})
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal("bot_init_failed", "err", err)
+	}
+	health.markBotInitialized()
+	logging.Info("bot_initialized", "username", "@"+b.Me.Username, "id", b.Me.ID)
+
+	if hook, ok := poller.(*webhookPoller); ok {
+		if err := hook.register(b); err != nil {
+			logging.Fatal("webhook_registration_failed", "public_url", loadedCfg.Bot.Webhook.PublicURL, "err", err)
+		}
+	} else {
+		// getUpdates is rejected while a webhook from a previous webhook-mode
+		// run is still registered.
+		if err := b.RemoveWebhook(); err != nil {
+			logging.Warn("failed_to_remove_stale_webhook_before_polling", "err", err)
+		}
 	}
-	log.Printf("Bot initialized username=@%s id=%d", b.Me.Username, b.Me.ID)
 
 	bot = b
 	syncBotCommands(b)
+	reconcilePendingChallenges(persisted)
 
+	b.Handle("/start", onStart)
 	b.Handle("/help", onHelp)
 	b.Handle("/version", onVersion)
 	b.Handle("/ping", onPing)
 	b.Handle("/testcaptcha", onTestCaptcha)
+	b.Handle("/approve", onApprove)
+	b.Handle("/unban", onUnban)
+	b.Handle("/reject", onReject)
+	b.Handle("/pending", onPending)
+	b.Handle("/reload", onReload)
 	b.Handle(tele.OnAddedToGroup, onAddedToGroup)
 	b.Handle(tele.OnUserJoined, onJoin)
+	b.Handle(tele.OnChatJoinRequest, onJoinRequest)
+	b.Handle(&tele.InlineButton{Unique: modlogUnbanUnique}, onModlogUnban)
+	b.Handle(&tele.InlineButton{Unique: modlogApproveUnique}, onModlogApprove)
+	b.Handle(&tele.InlineButton{Unique: pendingApproveUnique}, onPendingApprove)
+	b.Handle(&tele.InlineButton{Unique: pendingRejectUnique}, onPendingReject)
+	b.Handle(&tele.InlineButton{Unique: pendingReissueUnique}, onPendingReissue)
 	b.Handle(tele.OnCallback, handleAnswer)
 	b.Handle(tele.OnUserLeft, onUserLeft)
 
-	log.Printf("Bot started and polling updates")
-	b.Start()
+	if loadedCfg.IsWebhookMode() {
+		logging.Info("bot_started", "mode", loadedCfg.Bot.Mode, "listen", loadedCfg.Bot.Webhook.Listen, "public_url", loadedCfg.Bot.Webhook.PublicURL)
+	} else {
+		logging.Info("bot_started", "mode", loadedCfg.Bot.Mode)
+	}
+	runUntilShutdown(b, admin)
 }
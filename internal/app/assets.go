@@ -0,0 +1,51 @@
+package app
+
+import (
+	"fmt"
+
+	"toshiki-captcha-bot/assets"
+	"toshiki-captcha-bot/internal/logging"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+// installAssetPack switches rendering to the pack configured in assets.dir,
+// or to the embedded pack when no directory is configured. A configured pack
+// that cannot be used is an error; the active pack is left unchanged.
+func installAssetPack(config settings.RuntimeConfig) error {
+	pack, err := loadConfiguredAssetPack(config)
+	if err != nil {
+		return err
+	}
+	useAssetPack(pack)
+	return nil
+}
+
+// useAssetPack makes pack the active one; nil selects the embedded pack.
+func useAssetPack(pack *assets.Pack) {
+	assets.Use(pack)
+
+	active := assets.Current()
+	logging.Info("asset_pack_loaded", "source", active.Source(), "emojis", active.EmojiCount(), "backgrounds", active.BackgroundCount())
+}
+
+// loadConfiguredAssetPack returns the pack from assets.dir, or nil when no
+// directory is configured. The embedded pack is checked against the captcha
+// difficulty by settings validation; a configured pack is checked here.
+func loadConfiguredAssetPack(config settings.RuntimeConfig) (*assets.Pack, error) {
+	if config.Assets.Dir == "" {
+		return nil, nil
+	}
+	pack, err := assets.LoadPack(config.Assets.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("assets.dir: %w", err)
+	}
+	if required := config.Captcha.AnswerCount + config.Captcha.DecoyCount; pack.EmojiCount() < required {
+		return nil, fmt.Errorf(
+			"assets.dir: asset pack %s has %d emoji, captcha.answer_count + captcha.decoy_count requires %d",
+			pack.Source(),
+			pack.EmojiCount(),
+			required,
+		)
+	}
+	return pack, nil
+}
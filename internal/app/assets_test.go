@@ -0,0 +1,98 @@
+package app
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"toshiki-captcha-bot/assets"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+func TestLoadConfiguredAssetPack(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no directory keeps embedded pack", func(t *testing.T) {
+		t.Parallel()
+
+		pack, err := loadConfiguredAssetPack(mustValidatedRuntimeConfig(t, settings.DefaultRuntimeConfig()))
+		if err != nil {
+			t.Fatalf("loadConfiguredAssetPack returned error: %v", err)
+		}
+		if pack != nil {
+			t.Fatalf("pack = %v, want nil", pack.Source())
+		}
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := mustValidatedRuntimeConfig(t, settings.DefaultRuntimeConfig())
+		cfg.Assets.Dir = filepath.Join(t.TempDir(), "missing")
+		if _, err := loadConfiguredAssetPack(cfg); err == nil {
+			t.Fatalf("loadConfiguredAssetPack expected error for missing directory")
+		}
+	})
+
+	t.Run("pack smaller than difficulty", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := mustValidatedRuntimeConfig(t, settings.DefaultRuntimeConfig())
+		cfg.Assets.Dir = writeTestAssetPack(t, 1)
+		_, err := loadConfiguredAssetPack(cfg)
+		if err == nil || !strings.Contains(err.Error(), "requires 10") {
+			t.Fatalf("loadConfiguredAssetPack error = %v, want difficulty error", err)
+		}
+	})
+
+	t.Run("pack larger than embedded pool", func(t *testing.T) {
+		t.Parallel()
+
+		config := settings.DefaultRuntimeConfig()
+		config.Assets.Dir = writeTestAssetPack(t, assets.Embedded().EmojiCount()+2)
+		config.Captcha.AnswerCount = assets.Embedded().EmojiCount()
+		config.Captcha.DecoyCount = 2
+		pack, err := loadConfiguredAssetPack(mustValidatedRuntimeConfig(t, config))
+		if err != nil {
+			t.Fatalf("loadConfiguredAssetPack returned error: %v", err)
+		}
+		if pack == nil || pack.EmojiCount() != assets.Embedded().EmojiCount()+2 {
+			t.Fatalf("pack = %v, want the configured pack", pack)
+		}
+	})
+}
+
+// writeTestAssetPack writes a pack with count emoji to a temporary directory
+// and returns its path.
+func writeTestAssetPack(t *testing.T, count int) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.png"), testPNG(t), 0o600); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+	var manifest strings.Builder
+	manifest.WriteString("emojis:\n")
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&manifest, "  - key: e%d\n    emoji: \"%d\"\n    file: a.png\n", i, i)
+	}
+	manifest.WriteString("backgrounds:\n  - a.png\n")
+	if err := os.WriteFile(filepath.Join(dir, "manifest.yaml"), []byte(manifest.String()), 0o600); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+	return dir
+}
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+
+	var buf strings.Builder
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("png.Encode returned error: %v", err)
+	}
+	return []byte(buf.String())
+}
@@ -2,12 +2,12 @@ package app
 
 import (
 	"fmt"
-	"log"
 	"sort"
 	"strings"
 
 	tele "gopkg.in/telebot.v3"
 	"toshiki-captcha-bot/internal/commandscope"
+	"toshiki-captcha-bot/internal/logging"
 	"toshiki-captcha-bot/internal/settings"
 	"toshiki-captcha-bot/internal/version"
 )
@@ -30,6 +30,11 @@ func helpText() string {
 		"/version show build and runtime version details (public)",
 		"/ping check bot reachability and latency in ms (admin ids only)",
 		"/testcaptcha manually trigger a captcha challenge by replying to a user message (admin only)",
+		"/approve let a user in: clear their pending captcha and lift restrictions, by reply or user ID (admin only)",
+		"/unban lift any ban on a user in this group, by reply or user ID (admin only)",
+		"/reject fail a user's pending captcha now and apply the failure action, by reply or user ID (admin only)",
+		"/pending list pending captchas in this chat with approve, reject and re-issue buttons (admin only)",
+		"/reload reload the config file and show what changed (admin ids only)",
 		"",
 		"credits:",
 		"author: " + authorInfo,
@@ -40,9 +45,9 @@ func helpText() string {
 
 func onHelp(c tele.Context) error {
 	chatID, userID := commandContextIDs(c)
-	log.Printf("Help requested chat_id=%d user_id=%d", chatID, userID)
+	logging.Debug("help_requested", "chat_id", chatID, "user_id", userID)
 	if c == nil || c.Chat() == nil {
-		log.Printf("warn: help skipped reason=missing_chat_context user_id=%d", userID)
+		logging.Warn("help_skipped", "reason", "missing_chat_context", "user_id", userID)
 		return nil
 	}
 	if leaveIfUnsupportedPrivateGroup(c.Chat(), "help") {
@@ -56,16 +61,16 @@ func onHelp(c tele.Context) error {
 		return nil
 	}
 	if _, err := sendWithConfiguredTopic(c.Chat(), helpText(), tele.ModeDefault, nil); err != nil {
-		log.Printf("warn: failed to send help response chat_id=%d user_id=%d err=%v", chatID, userID, err)
+		logging.Warn("failed_to_send_help_response", "chat_id", chatID, "user_id", userID, "err", err)
 	}
 	return nil
 }
 
 func onVersion(c tele.Context) error {
 	chatID, userID := commandContextIDs(c)
-	log.Printf("Version requested chat_id=%d user_id=%d", chatID, userID)
+	logging.Debug("version_requested", "chat_id", chatID, "user_id", userID)
 	if c == nil || c.Chat() == nil {
-		log.Printf("warn: version skipped reason=missing_chat_context user_id=%d", userID)
+		logging.Warn("version_skipped", "reason", "missing_chat_context", "user_id", userID)
 		return nil
 	}
 	if leaveIfUnsupportedPrivateGroup(c.Chat(), "version") {
@@ -79,7 +84,7 @@ func onVersion(c tele.Context) error {
 		return nil
 	}
 	if _, err := sendWithConfiguredTopic(c.Chat(), version.MarkdownText(), tele.ModeMarkdown, nil); err != nil {
-		log.Printf("warn: failed to send version response chat_id=%d user_id=%d err=%v", chatID, userID, err)
+		logging.Warn("failed_to_send_version_response", "chat_id", chatID, "user_id", userID, "err", err)
 	}
 	return nil
 }
@@ -92,15 +97,15 @@ func syncBotCommands(b *tele.Bot) {
 
 	public := publicBotCommands()
 	if err := b.SetCommands(public); err != nil {
-		log.Printf("warn: failed to register default bot commands err=%v", err)
+		logging.Warn("failed_to_register_default_bot_commands", "err", err)
 	} else {
-		log.Printf("Bot commands updated scope=default count=%d", len(public))
+		logging.Info("bot_commands_updated", "scope", "default", "count", len(public))
 	}
 
-	desiredScopes := desiredAdminCommandScopes(b, cfg)
+	desiredScopes := desiredAdminCommandScopes(b, currentConfig())
 	reconcileAdminCommandScopes(b, desiredScopes)
 	if len(desiredScopes) == 0 {
-		log.Printf("Bot commands admin scopes skipped reason=no_admin_user_ids")
+		logging.Info("bot_commands_admin_scopes_skipped", "reason", "no_admin_user_ids")
 	}
 }
 
@@ -110,10 +115,10 @@ func clearLegacyAdminCommandScopes(b *tele.Bot) {
 	}
 	legacyScope := tele.CommandScope{Type: tele.CommandScopeAllChatAdmin}
 	if err := b.DeleteCommands(legacyScope); err != nil {
-		log.Printf("warn: failed to delete legacy admin command scope scope=%s err=%v", legacyScope.Type, err)
+		logging.Warn("failed_to_delete_legacy_admin_command_scope", "scope", legacyScope.Type, "err", err)
 		return
 	}
-	log.Printf("Bot commands deleted legacy scope=%s", legacyScope.Type)
+	logging.Info("bot_commands_deleted_legacy", "scope", legacyScope.Type)
 }
 
 func desiredAdminCommandScopes(b *tele.Bot, config settings.RuntimeConfig) []tele.CommandScope {
@@ -137,49 +142,49 @@ func reconcileAdminCommandScopes(b *tele.Bot, desiredScopes []tele.CommandScope)
 
 	previousScopes, err := commandscope.Load(commandScopeStatePath)
 	if err != nil {
-		log.Printf("warn: failed to load command scope state path=%q err=%v", commandScopeStatePath, err)
+		logging.Warn("failed_to_load_command_scope_state", "path", commandScopeStatePath, "err", err)
 	}
 
 	staleScopes := commandscope.DiffScopes(previousScopes, desiredScopes)
 	failedDeletes := make([]tele.CommandScope, 0)
 	for _, scope := range staleScopes {
 		if err := b.DeleteCommands(scope); err != nil {
-			log.Printf(
-				"warn: failed to delete stale admin bot command scope scope=%s chat_id=%d user_id=%d err=%v",
-				scope.Type,
-				scope.ChatID,
-				scope.UserID,
-				err,
+			logging.Warn(
+				"failed_to_delete_stale_admin_bot_command_scope",
+				"scope", scope.Type,
+				"chat_id", scope.ChatID,
+				"user_id", scope.UserID,
+				"err", err,
 			)
 			failedDeletes = append(failedDeletes, scope)
 			continue
 		}
-		log.Printf("Bot commands deleted stale scope=%s chat_id=%d user_id=%d", scope.Type, scope.ChatID, scope.UserID)
+		logging.Info("bot_commands_deleted_stale", "scope", scope.Type, "chat_id", scope.ChatID, "user_id", scope.UserID)
 	}
 
 	success := 0
 	for _, scope := range desiredScopes {
 		scopeCommands := scopedAdminCommands(scope)
 		if err := b.SetCommands(scopeCommands, scope); err != nil {
-			log.Printf(
-				"warn: failed to register admin bot commands scope=%s chat_id=%d user_id=%d err=%v",
-				scope.Type,
-				scope.ChatID,
-				scope.UserID,
-				err,
+			logging.Warn(
+				"failed_to_register_admin_bot_commands",
+				"scope", scope.Type,
+				"chat_id", scope.ChatID,
+				"user_id", scope.UserID,
+				"err", err,
 			)
 			continue
 		}
 		success++
 	}
-	log.Printf("Bot commands updated admin_scopes=%d success=%d stale_deleted=%d", len(desiredScopes), success, len(staleScopes)-len(failedDeletes))
+	logging.Info("bot_commands_updated", "admin_scopes", len(desiredScopes), "success", success, "stale_deleted", len(staleScopes)-len(failedDeletes))
 
 	nextState := commandscope.MergeScopes(desiredScopes, failedDeletes)
 	if err := commandscope.Save(commandScopeStatePath, nextState); err != nil {
-		log.Printf("warn: failed to save command scope state path=%q err=%v", commandScopeStatePath, err)
+		logging.Warn("failed_to_save_command_scope_state", "path", commandScopeStatePath, "err", err)
 		return
 	}
-	log.Printf("Bot commands state saved path=%q scopes=%d", commandScopeStatePath, len(nextState))
+	logging.Debug("bot_commands_state_saved", "path", commandScopeStatePath, "scopes", len(nextState))
 }
 
 func publicBotCommands() []tele.Command {
@@ -194,6 +199,7 @@ func adminPrivateBotCommands() []tele.Command {
 		{Text: "help", Description: "show this help message"},
 		{Text: "version", Description: "show build and runtime version details"},
 		{Text: "ping", Description: "check bot reachability and latency in ms"},
+		{Text: "reload", Description: "reload the config file"},
 	}
 }
 
@@ -203,6 +209,11 @@ func adminGroupBotCommands() []tele.Command {
 		{Text: "version", Description: "show build and runtime version details"},
 		{Text: "ping", Description: "check bot reachability and latency in ms"},
 		{Text: "testcaptcha", Description: "manually trigger a captcha challenge"},
+		{Text: "approve", Description: "let a user in without solving the captcha"},
+		{Text: "unban", Description: "lift any ban on a user in this group"},
+		{Text: "reject", Description: "fail a pending captcha now"},
+		{Text: "pending", Description: "list pending captchas in this chat"},
+		{Text: "reload", Description: "reload the config file"},
 	}
 }
 
@@ -225,17 +236,26 @@ func resolveConfiguredGroupChatIDs(b *tele.Bot, groups []settings.GroupTopicConf
 	ids := make([]int64, 0, len(groups))
 	seen := make(map[int64]struct{}, len(groups))
 	for _, group := range groups {
+		// Groups configured by numeric ID need no lookup; this is also the
+		// only way to reach private groups, which have no username.
+		if chatID, ok := group.ChatID(); ok {
+			if _, dup := seen[chatID]; !dup {
+				seen[chatID] = struct{}{}
+				ids = append(ids, chatID)
+			}
+			continue
+		}
 		chat, err := b.ChatByUsername(group.ID)
 		if err != nil {
-			log.Printf("warn: failed to resolve group chat_id by username group=%s err=%v", group.ID, err)
+			logging.Warn("failed_to_resolve_group_chat_id_by_username", "group", group.ID, "err", err)
 			continue
 		}
 		if chat == nil {
-			log.Printf("warn: resolved group is nil group=%s", group.ID)
+			logging.Warn("resolved_group_is_nil", "group", group.ID)
 			continue
 		}
 		if !isPublicGroupChat(chat) {
-			log.Printf("warn: resolved group is not supported for admin command scope group=%s chat_id=%d chat_type=%s", group.ID, chat.ID, chat.Type)
+			logging.Warn("resolved_group_is_not_supported_for_admin_command_scope", "group", group.ID, "chat_id", chat.ID, "chat_type", chat.Type)
 			continue
 		}
 		if _, ok := seen[chat.ID]; ok {
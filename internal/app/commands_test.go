@@ -20,6 +20,11 @@ func TestHelpText(t *testing.T) {
 		"/version",
 		"/ping",
 		"/testcaptcha",
+		"/approve",
+		"/unban",
+		"/reject",
+		"/pending",
+		"/reload",
 		"admin ids only",
 		projectURL,
 		authorInfo,
@@ -51,12 +56,12 @@ func TestAdminPrivateBotCommands(t *testing.T) {
 	t.Parallel()
 
 	cmds := adminPrivateBotCommands()
-	if len(cmds) != 3 {
-		t.Fatalf("private admin command count = %d, want 3", len(cmds))
+	if len(cmds) != 4 {
+		t.Fatalf("private admin command count = %d, want 4", len(cmds))
 	}
 
-	got := []string{cmds[0].Text, cmds[1].Text, cmds[2].Text}
-	want := []string{"help", "version", "ping"}
+	got := []string{cmds[0].Text, cmds[1].Text, cmds[2].Text, cmds[3].Text}
+	want := []string{"help", "version", "ping", "reload"}
 	if !reflect.DeepEqual(got, want) {
 		t.Fatalf("private admin commands = %v, want %v", got, want)
 	}
@@ -66,12 +71,15 @@ func TestAdminGroupBotCommands(t *testing.T) {
 	t.Parallel()
 
 	cmds := adminGroupBotCommands()
-	if len(cmds) != 4 {
-		t.Fatalf("group admin command count = %d, want 4", len(cmds))
+	if len(cmds) != 9 {
+		t.Fatalf("group admin command count = %d, want 9", len(cmds))
 	}
 
-	got := []string{cmds[0].Text, cmds[1].Text, cmds[2].Text, cmds[3].Text}
-	want := []string{"help", "version", "ping", "testcaptcha"}
+	got := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		got = append(got, cmd.Text)
+	}
+	want := []string{"help", "version", "ping", "testcaptcha", "approve", "unban", "reject", "pending", "reload"}
 	if !reflect.DeepEqual(got, want) {
 		t.Fatalf("group admin commands = %v, want %v", got, want)
 	}
@@ -86,14 +94,17 @@ func TestScopedAdminCommands(t *testing.T) {
 	private := scopedAdminCommands(privateScope)
 	group := scopedAdminCommands(groupScope)
 
-	privateTexts := []string{private[0].Text, private[1].Text, private[2].Text}
-	groupTexts := []string{group[0].Text, group[1].Text, group[2].Text, group[3].Text}
+	privateTexts := []string{private[0].Text, private[1].Text, private[2].Text, private[3].Text}
+	groupTexts := make([]string, 0, len(group))
+	for _, cmd := range group {
+		groupTexts = append(groupTexts, cmd.Text)
+	}
 
-	if !reflect.DeepEqual(privateTexts, []string{"help", "version", "ping"}) {
-		t.Fatalf("private scope commands = %v, want %v", privateTexts, []string{"help", "version", "ping"})
+	if !reflect.DeepEqual(privateTexts, []string{"help", "version", "ping", "reload"}) {
+		t.Fatalf("private scope commands = %v, want %v", privateTexts, []string{"help", "version", "ping", "reload"})
 	}
-	if !reflect.DeepEqual(groupTexts, []string{"help", "version", "ping", "testcaptcha"}) {
-		t.Fatalf("group scope commands = %v, want %v", groupTexts, []string{"help", "version", "ping", "testcaptcha"})
+	if !reflect.DeepEqual(groupTexts, []string{"help", "version", "ping", "testcaptcha", "approve", "unban", "reject", "pending", "reload"}) {
+		t.Fatalf("group scope commands = %v, want %v", groupTexts, []string{"help", "version", "ping", "testcaptcha", "approve", "unban", "reject", "pending", "reload"})
 	}
 }
 
@@ -169,3 +180,15 @@ func TestAdminOnlyCommandErrorText(t *testing.T) {
 		t.Fatalf("adminOnlyCommandErrorText missing prefix: %q", got)
 	}
 }
+
+func TestResolveConfiguredGroupChatIDsUsesNumericIDs(t *testing.T) {
+	t.Parallel()
+
+	// Groups configured by chat ID must not need a Bot API lookup, so a nil
+	// bot is enough here.
+	groups := []settings.GroupTopicConfig{{ID: "-1002"}, {ID: "-1001"}, {ID: "-1002"}}
+	got := resolveConfiguredGroupChatIDs(nil, groups)
+	if len(got) != 2 || got[0] != -1002 || got[1] != -1001 {
+		t.Fatalf("resolveConfiguredGroupChatIDs() = %v, want [-1002 -1001]", got)
+	}
+}
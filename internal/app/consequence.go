@@ -0,0 +1,148 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/i18n"
+	"toshiki-captcha-bot/internal/logging"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+// memberModerator is the part of the Bot API used to apply captcha
+// consequences and resolve join requests. *tele.Bot satisfies it.
+type memberModerator interface {
+	Ban(chat *tele.Chat, member *tele.ChatMember, revokeMessages ...bool) error
+	Unban(chat *tele.Chat, user *tele.User, forBanned ...bool) error
+	Restrict(chat *tele.Chat, member *tele.ChatMember) error
+	ApproveJoinRequest(chat tele.Recipient, user *tele.User) error
+	DeclineJoinRequest(chat tele.Recipient, user *tele.User) error
+}
+
+// captchaFailureAction returns the action for a user who reached
+// captcha.max_failures. Manual test challenges never carry a consequence.
+func captchaFailureAction(status captcha.JoinStatus, chat *tele.Chat) settings.CaptchaAction {
+	return resolveCaptchaFailureAction(status, chat, currentConfig())
+}
+
+func resolveCaptchaFailureAction(status captcha.JoinStatus, chat *tele.Chat, config settings.RuntimeConfig) settings.CaptchaAction {
+	if status.ManualChallenge {
+		return settings.CaptchaAction{Action: settings.CaptchaActionNone}
+	}
+	return resolvePolicyForChat(chat, config).OnFailure
+}
+
+// captchaTimeoutAction returns the action for a user whose captcha expired.
+func captchaTimeoutAction(status captcha.JoinStatus, chat *tele.Chat) settings.CaptchaAction {
+	return resolveCaptchaTimeoutAction(status, chat, currentConfig())
+}
+
+func resolveCaptchaTimeoutAction(status captcha.JoinStatus, chat *tele.Chat, config settings.RuntimeConfig) settings.CaptchaAction {
+	if status.ManualChallenge {
+		return settings.CaptchaAction{Action: settings.CaptchaActionNone}
+	}
+	return resolvePolicyForChat(chat, config).OnTimeout
+}
+
+// applyCaptchaAction carries out action against userID in chat.
+//
+//   - ban removes the user for good.
+//   - ban_for removes the user until now plus the configured duration.
+//   - kick bans and immediately unbans so the user can join and retry.
+//   - mute keeps the user in the group without any rights.
+//   - none leaves the captcha restriction to run out on its own.
+func applyCaptchaAction(api memberModerator, chat *tele.Chat, userID int64, action settings.CaptchaAction, now time.Time) error {
+	if chat == nil {
+		return fmt.Errorf("missing target chat")
+	}
+	user := &tele.User{ID: userID}
+
+	switch action.Action {
+	case settings.CaptchaActionBan:
+		if err := api.Ban(chat, &tele.ChatMember{User: user}, false); err != nil {
+			return fmt.Errorf("ban user: %w", err)
+		}
+	case settings.CaptchaActionBanFor:
+		member := &tele.ChatMember{User: user, RestrictedUntil: now.Add(action.Duration).Unix()}
+		if err := api.Ban(chat, member, false); err != nil {
+			return fmt.Errorf("ban user for %s: %w", action.Duration, err)
+		}
+	case settings.CaptchaActionKick:
+		if err := api.Ban(chat, &tele.ChatMember{User: user}, false); err != nil {
+			return fmt.Errorf("kick user: %w", err)
+		}
+		if err := api.Unban(chat, user, true); err != nil {
+			return fmt.Errorf("unban kicked user: %w", err)
+		}
+	case settings.CaptchaActionMute:
+		// RestrictedUntil 0 keeps the restriction until an admin lifts it.
+		member := &tele.ChatMember{User: user, Rights: tele.NoRights()}
+		if err := api.Restrict(chat, member); err != nil {
+			return fmt.Errorf("mute user: %w", err)
+		}
+	case settings.CaptchaActionNone:
+	default:
+		return fmt.Errorf("unknown captcha action %q", action.Action)
+	}
+	return nil
+}
+
+// enforceCaptchaAction applies action with the global bot, logs the
+// outcome and returns the error, if any. reason names the trigger, e.g.
+// failure or timeout.
+func enforceCaptchaAction(chat *tele.Chat, userID int64, action settings.CaptchaAction, reason string) error {
+	if action.Action == settings.CaptchaActionNone {
+		return nil
+	}
+	var chatID int64
+	if chat != nil {
+		chatID = chat.ID
+	}
+	if bot == nil {
+		logging.Warn("captcha_action_skipped", "reason", "bot_not_initialized", "chat_id", chatID, "user_id", userID, "action", action.Action)
+		return fmt.Errorf("bot not initialized")
+	}
+	err := applyCaptchaAction(bot, chat, userID, action, time.Now())
+	recordCaptchaAction(chatID, action.Action, err)
+	if err != nil {
+		logging.Warn("failed_to_apply_captcha_action", "chat_id", chatID, "user_id", userID, "action", action.Action, "trigger", reason, "err", err)
+		return err
+	}
+	logging.Info("captcha_action_applied", "chat_id", chatID, "user_id", userID, "action", action.Action, "trigger", reason)
+	return nil
+}
+
+// captchaActionOutcome describes what happened to the user, for use in
+// group notices. It is empty for none.
+func captchaActionOutcome(msgs i18n.Messages, action settings.CaptchaAction) string {
+	switch action.Action {
+	case settings.CaptchaActionBan:
+		return msgs.Text(i18n.OutcomeBanned)
+	case settings.CaptchaActionBanFor:
+		return msgs.Text(i18n.OutcomeBannedFor, msgs.Duration(action.Duration))
+	case settings.CaptchaActionKick:
+		return msgs.Text(i18n.OutcomeKicked)
+	case settings.CaptchaActionMute:
+		return msgs.Text(i18n.OutcomeMuted)
+	default:
+		return ""
+	}
+}
+
+// captchaFailureCallbackText is the alert shown to the user who failed.
+func captchaFailureCallbackText(msgs i18n.Messages, action settings.CaptchaAction) string {
+	switch action.Action {
+	case settings.CaptchaActionBan:
+		return msgs.Text(i18n.FailureAlertBanned)
+	case settings.CaptchaActionBanFor:
+		return msgs.Text(i18n.FailureAlertBannedFor, msgs.Duration(action.Duration))
+	case settings.CaptchaActionKick:
+		return msgs.Text(i18n.FailureAlertKicked)
+	case settings.CaptchaActionMute:
+		return msgs.Text(i18n.FailureAlertMuted)
+	default:
+		return msgs.Text(i18n.FailureAlertNoAction)
+	}
+}
@@ -0,0 +1,263 @@
+package app
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/i18n"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+type moderatorCall struct {
+	method string
+	userID int64
+	until  int64
+	rights tele.Rights
+	flag   bool
+}
+
+type mockMemberModerator struct {
+	calls      []moderatorCall
+	banErr     error
+	approveErr error
+}
+
+func (m *mockMemberModerator) Ban(_ *tele.Chat, member *tele.ChatMember, revokeMessages ...bool) error {
+	call := moderatorCall{method: "ban", userID: member.User.ID, until: member.RestrictedUntil}
+	if len(revokeMessages) > 0 {
+		call.flag = revokeMessages[0]
+	}
+	m.calls = append(m.calls, call)
+	return m.banErr
+}
+
+func (m *mockMemberModerator) Unban(_ *tele.Chat, user *tele.User, forBanned ...bool) error {
+	call := moderatorCall{method: "unban", userID: user.ID}
+	if len(forBanned) > 0 {
+		call.flag = forBanned[0]
+	}
+	m.calls = append(m.calls, call)
+	return nil
+}
+
+func (m *mockMemberModerator) Restrict(_ *tele.Chat, member *tele.ChatMember) error {
+	m.calls = append(m.calls, moderatorCall{
+		method: "restrict",
+		userID: member.User.ID,
+		until:  member.RestrictedUntil,
+		rights: member.Rights,
+	})
+	return nil
+}
+
+func (m *mockMemberModerator) ApproveJoinRequest(_ tele.Recipient, user *tele.User) error {
+	m.calls = append(m.calls, moderatorCall{method: "approve", userID: user.ID})
+	return m.approveErr
+}
+
+func (m *mockMemberModerator) DeclineJoinRequest(_ tele.Recipient, user *tele.User) error {
+	m.calls = append(m.calls, moderatorCall{method: "decline", userID: user.ID})
+	return nil
+}
+
+func (m *mockMemberModerator) Delete(msg tele.Editable) error {
+	m.calls = append(m.calls, moderatorCall{method: "delete"})
+	return nil
+}
+
+func TestApplyCaptchaAction(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0)
+	chat := &tele.Chat{ID: -100123}
+
+	tests := []struct {
+		name   string
+		action settings.CaptchaAction
+		want   []moderatorCall
+	}{
+		{
+			name:   "ban",
+			action: settings.CaptchaAction{Action: settings.CaptchaActionBan},
+			want:   []moderatorCall{{method: "ban", userID: 42}},
+		},
+		{
+			name:   "ban for duration",
+			action: settings.CaptchaAction{Action: settings.CaptchaActionBanFor, Duration: time.Hour},
+			want:   []moderatorCall{{method: "ban", userID: 42, until: now.Add(time.Hour).Unix()}},
+		},
+		{
+			name:   "kick",
+			action: settings.CaptchaAction{Action: settings.CaptchaActionKick},
+			want: []moderatorCall{
+				{method: "ban", userID: 42},
+				{method: "unban", userID: 42, flag: true},
+			},
+		},
+		{
+			name:   "mute",
+			action: settings.CaptchaAction{Action: settings.CaptchaActionMute},
+			want:   []moderatorCall{{method: "restrict", userID: 42, rights: tele.NoRights()}},
+		},
+		{
+			name:   "none",
+			action: settings.CaptchaAction{Action: settings.CaptchaActionNone},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			api := &mockMemberModerator{}
+			if err := applyCaptchaAction(api, chat, 42, tt.action, now); err != nil {
+				t.Fatalf("applyCaptchaAction returned error: %v", err)
+			}
+			if len(api.calls) != len(tt.want) {
+				t.Fatalf("calls = %+v, want %+v", api.calls, tt.want)
+			}
+			for i := range tt.want {
+				if api.calls[i] != tt.want[i] {
+					t.Fatalf("calls[%d] = %+v, want %+v", i, api.calls[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestApplyCaptchaActionKickStopsOnBanError(t *testing.T) {
+	t.Parallel()
+
+	api := &mockMemberModerator{banErr: errors.New("not enough rights")}
+	err := applyCaptchaAction(api, &tele.Chat{ID: -1}, 42, settings.CaptchaAction{Action: settings.CaptchaActionKick}, time.Now())
+	if err == nil {
+		t.Fatalf("applyCaptchaAction returned nil error")
+	}
+	if len(api.calls) != 1 || api.calls[0].method != "ban" {
+		t.Fatalf("calls = %+v, want a single ban attempt", api.calls)
+	}
+}
+
+func TestApplyCaptchaActionRejectsInvalidInput(t *testing.T) {
+	t.Parallel()
+
+	api := &mockMemberModerator{}
+	if err := applyCaptchaAction(api, nil, 42, settings.CaptchaAction{Action: settings.CaptchaActionBan}, time.Now()); err == nil {
+		t.Fatalf("applyCaptchaAction(nil chat) returned nil error")
+	}
+	if err := applyCaptchaAction(api, &tele.Chat{ID: -1}, 42, settings.CaptchaAction{Action: "explode"}, time.Now()); err == nil {
+		t.Fatalf("applyCaptchaAction(unknown action) returned nil error")
+	}
+	if len(api.calls) != 0 {
+		t.Fatalf("calls = %+v, want none", api.calls)
+	}
+}
+
+func TestResolveCaptchaActions(t *testing.T) {
+	t.Parallel()
+
+	config := settings.DefaultRuntimeConfig()
+	config.Bot.AdminUserIDs = []int64{1001}
+	config.Captcha.OnFailure = settings.CaptchaAction{Action: settings.CaptchaActionKick}
+	config.Captcha.OnTimeout = settings.CaptchaAction{Action: settings.CaptchaActionMute}
+	config.Groups = []settings.GroupTopicConfig{
+		{ID: "@strictgroup", OnFailure: settings.CaptchaAction{Action: settings.CaptchaActionBanFor, Duration: 24 * time.Hour}},
+		{ID: "@othergroup"},
+	}
+	config = mustValidatedRuntimeConfig(t, config)
+
+	strict := &tele.Chat{ID: -1, Username: "StrictGroup"}
+	other := &tele.Chat{ID: -2, Username: "othergroup"}
+
+	if got := resolveCaptchaFailureAction(captcha.JoinStatus{}, strict, config); got.Action != settings.CaptchaActionBanFor || got.Duration != 24*time.Hour {
+		t.Fatalf("failure action for strict group = %+v, want ban_for 24h", got)
+	}
+	if got := resolveCaptchaTimeoutAction(captcha.JoinStatus{}, strict, config); got.Action != settings.CaptchaActionMute {
+		t.Fatalf("timeout action for strict group = %+v, want global mute", got)
+	}
+	if got := resolveCaptchaFailureAction(captcha.JoinStatus{}, other, config); got.Action != settings.CaptchaActionKick {
+		t.Fatalf("failure action for other group = %+v, want global kick", got)
+	}
+	if got := resolveCaptchaFailureAction(captcha.JoinStatus{}, nil, config); got.Action != settings.CaptchaActionKick {
+		t.Fatalf("failure action without chat = %+v, want global kick", got)
+	}
+
+	manual := captcha.JoinStatus{ManualChallenge: true}
+	if got := resolveCaptchaFailureAction(manual, strict, config); got.Action != settings.CaptchaActionNone {
+		t.Fatalf("failure action for manual challenge = %+v, want none", got)
+	}
+	if got := resolveCaptchaTimeoutAction(manual, strict, config); got.Action != settings.CaptchaActionNone {
+		t.Fatalf("timeout action for manual challenge = %+v, want none", got)
+	}
+}
+
+func TestCaptchaActionTexts(t *testing.T) {
+	t.Parallel()
+
+	status := captcha.JoinStatus{UserID: 42, UserFullName: "Alice"}
+
+	tests := []struct {
+		name         string
+		action       settings.CaptchaAction
+		wantNotice   string
+		wantCallback string
+		wantContact  bool
+	}{
+		{
+			name:         "ban",
+			action:       settings.CaptchaAction{Action: settings.CaptchaActionBan},
+			wantNotice:   "has been banned,",
+			wantCallback: "you have been banned",
+			wantContact:  true,
+		},
+		{
+			name:         "ban for",
+			action:       settings.CaptchaAction{Action: settings.CaptchaActionBanFor, Duration: 2 * time.Hour},
+			wantNotice:   "has been banned for 2 hours",
+			wantCallback: "banned for 2 hours",
+			wantContact:  true,
+		},
+		{
+			name:         "kick",
+			action:       settings.CaptchaAction{Action: settings.CaptchaActionKick},
+			wantNotice:   "may rejoin to try again",
+			wantCallback: "You may rejoin",
+		},
+		{
+			name:         "mute",
+			action:       settings.CaptchaAction{Action: settings.CaptchaActionMute},
+			wantNotice:   "has been muted",
+			wantCallback: "you have been muted",
+			wantContact:  true,
+		},
+		{
+			name:         "none",
+			action:       settings.CaptchaAction{Action: settings.CaptchaActionNone},
+			wantNotice:   "[Alice](tg://user?id=42) captcha failed.",
+			wantCallback: "Captcha failed.",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			notice := captchaFailureNoticeText(i18n.For("en"), status, tt.action, 15*time.Second)
+			if !strings.Contains(notice, tt.wantNotice) {
+				t.Fatalf("notice = %q, want it to contain %q", notice, tt.wantNotice)
+			}
+			if got := strings.Contains(notice, "contact administrator"); got != tt.wantContact {
+				t.Fatalf("notice contact hint = %t, want %t: %q", got, tt.wantContact, notice)
+			}
+			if got := captchaFailureCallbackText(i18n.For("en"), tt.action); !strings.Contains(got, tt.wantCallback) {
+				t.Fatalf("callback text = %q, want it to contain %q", got, tt.wantCallback)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/i18n"
+	"toshiki-captcha-bot/internal/logging"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+// startPayloadPrefix marks /start deep link payloads that open a captcha.
+// Payloads are limited to 64 characters of A-Z, a-z, 0-9, _ and -.
+const startPayloadPrefix = "captcha_"
+
+// startTokenBytes is the entropy of a deep link token before encoding.
+const startTokenBytes = 12
+
+// openingPrompts holds the keys of prompts currently being turned into a
+// challenge, either through /start or by the group fallback, so a prompt is
+// only opened once.
+var openingPrompts = newPromptClaims()
+
+type promptClaims struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+func newPromptClaims() *promptClaims {
+	return &promptClaims{keys: make(map[string]struct{})}
+}
+
+// claim reports whether key was free and marks it as being opened.
+func (p *promptClaims) claim(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, busy := p.keys[key]; busy {
+		return false
+	}
+	p.keys[key] = struct{}{}
+	return true
+}
+
+func (p *promptClaims) release(key string) {
+	p.mu.Lock()
+	delete(p.keys, key)
+	p.mu.Unlock()
+}
+
+func newStartToken() (string, error) {
+	buf := make([]byte, startTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate start token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func captchaStartLink(botUsername, token string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s%s", botUsername, startPayloadPrefix, token)
+}
+
+// parseStartPayload returns the token of a captcha deep link payload.
+func parseStartPayload(payload string) (string, bool) {
+	payload = strings.TrimSpace(payload)
+	if !strings.HasPrefix(payload, startPayloadPrefix) {
+		return "", false
+	}
+	token := strings.TrimPrefix(payload, startPayloadPrefix)
+	return token, token != ""
+}
+
+func captchaPromptText(msgs i18n.Messages, user *tele.User, expiration time.Duration) string {
+	return msgs.Text(i18n.PromptText, markdownMention(user), msgs.Duration(expiration))
+}
+
+func captchaPromptMarkup(msgs i18n.Messages, botUsername, token string) *tele.ReplyMarkup {
+	return &tele.ReplyMarkup{
+		InlineKeyboard: [][]tele.InlineButton{{
+			{Text: msgs.Text(i18n.PromptButton), URL: captchaStartLink(botUsername, token)},
+		}},
+	}
+}
+
+func sendCaptchaPrompt(chat *tele.Chat, user *tele.User, token string, policy settings.ChatPolicy) (*tele.Message, error) {
+	if bot == nil || bot.Me == nil {
+		return nil, fmt.Errorf("bot is not initialized")
+	}
+	msgs := messagesFor(policy)
+	text := captchaPromptText(msgs, user, policy.Expiration)
+	return sendWithConfiguredTopic(chat, text, tele.ModeMarkdown, captchaPromptMarkup(msgs, bot.Me.Username, token))
+}
+
+// issuePrivateCaptchaPrompt posts the deep link prompt for a new member
+// when captcha.delivery is private. The member is already restricted; the
+// restriction is restored if the prompt cannot be posted.
+func issuePrivateCaptchaPrompt(chat *tele.Chat, targetUser *tele.User, kvID string, policy settings.ChatPolicy, chatMember, originalMember *tele.ChatMember, manualChallenge bool) error {
+	token, err := newStartToken()
+	if err != nil {
+		logging.Error("captcha_prompt_generation_failed", "chat_id", chat.ID, "user_id", targetUser.ID, "err", err)
+		if !manualChallenge {
+			restoreUserRestriction(chat, targetUser, originalMember, "captcha_generation_failed")
+		}
+		return nil
+	}
+
+	msg, err := sendCaptchaPrompt(chat, targetUser, token, policy)
+	if err != nil {
+		logging.Error("failed_to_send_captcha_prompt", "chat_id", chat.ID, "user_id", targetUser.ID, "err", err)
+		if !manualChallenge {
+			restoreUserRestriction(chat, targetUser, originalMember, "captcha_send_failed")
+		}
+		return nil
+	}
+
+	if !manualChallenge {
+		// Start the restriction window from when the prompt is visible.
+		applyCaptchaRestriction(chatMember, policy.Expiration)
+		if err := restrictMember(chat, chatMember); err != nil {
+			logging.Warn("failed_to_refresh_user_restriction_window", "chat_id", chat.ID, "user_id", targetUser.ID, "err", err)
+			postModerationRecord(moderationRecord{event: modlogRestrictFailed, chat: chat, userID: targetUser.ID, userName: userDisplayName(targetUser), err: err})
+		}
+	}
+
+	status := newJoinStatus(targetUser, chat, captchaChallenge{}, *msg, manualChallenge)
+	status.ChatUsername = chat.Username
+	status.StartToken = token
+	if err := db.Set(kvID, status, policy.Expiration); err != nil {
+		logging.Warn("failed_to_persist_captcha_state", "chat_id", chat.ID, "user_id", targetUser.ID, "err", err)
+	}
+	recordChallengeIssued(status)
+	postChallengeIssuedRecord(status)
+	armGroupDeliveryFallback(kvID, status, policy.Expiration)
+	logging.Info(
+		"captcha_prompt_issued",
+		"chat_id", chat.ID,
+		"user_id", targetUser.ID,
+		"prompt_message_id", msg.ID,
+		"delivery", currentConfig().Captcha.Delivery,
+	)
+	return nil
+}
+
+// groupFallbackDelay returns how long a prompt waits to be opened before the
+// challenge is posted in the group. remaining is the time left until the
+// captcha expires.
+func groupFallbackDelay(remaining, expiration time.Duration) time.Duration {
+	delay := remaining - expiration/2
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// armGroupDeliveryFallback schedules the in-group challenge for a prompt
+// when captcha.delivery is private_with_fallback.
+func armGroupDeliveryFallback(kvID string, status captcha.JoinStatus, remaining time.Duration) {
+	if currentConfig().Captcha.Delivery != settings.CaptchaDeliveryPrivateWithFallback || status.StartToken == "" {
+		return
+	}
+	delay := groupFallbackDelay(remaining, policyForChat(captchaGroupChat(status)).Expiration)
+	token := status.StartToken
+	inFlight.Go(func() {
+		sleepUntilShutdown(delay)
+		select {
+		case <-shutdownRequested:
+			return
+		default:
+		}
+		fallBackToGroupChallenge(kvID, token)
+	})
+}
+
+// fallBackToGroupChallenge replaces an unopened prompt with a regular
+// challenge posted in the group.
+func fallBackToGroupChallenge(kvID, token string) {
+	if !openingPrompts.claim(kvID) {
+		return
+	}
+	defer openingPrompts.release(kvID)
+
+	status, found := db.Get(kvID)
+	if !found || status.StartToken != token {
+		return
+	}
+
+	group := captchaGroupChat(status)
+	challenge, err := buildCaptchaChallengeForChat(group)
+	if err != nil {
+		logging.Error("captcha_generation_failed_for_group_fallback", "chat_id", status.ChatID, "user_id", status.UserID, "err", err)
+		return
+	}
+	user := &tele.User{ID: status.UserID, FirstName: status.UserFullName}
+	msg, err := sendCaptchaChallenge(group, challenge.ImageBytes, genCaption(user, challenge.Type, policyForChat(group)), challenge.Markup)
+	if err != nil && !errors.Is(err, errCaptchaSendTimeout) {
+		logging.Warn("failed_to_send_group_fallback_captcha", "chat_id", status.ChatID, "user_id", status.UserID, "err", err)
+		return
+	}
+
+	prompt := status.CaptchaMessage
+	message := tele.Message{Chat: group}
+	if msg != nil {
+		message = *msg
+	}
+	applyCaptchaChallenge(&status, challenge, message)
+	status.StartToken = ""
+	if err := db.Update(kvID, status); err != nil {
+		logging.Warn("failed_to_persist_group_fallback_captcha_state", "chat_id", status.ChatID, "user_id", status.UserID, "err", err)
+	}
+	if prompt.ID > 0 {
+		if err := bot.Delete(&prompt); err != nil {
+			logging.Warn("failed_to_delete_captcha_prompt", "chat_id", status.ChatID, "user_id", status.UserID, "message_id", prompt.ID, "err", err)
+		}
+	}
+	logging.Info("captcha_fell_back_to_group", "chat_id", status.ChatID, "user_id", status.UserID, "challenge_message_id", message.ID)
+}
+
+// findChallengeByStartToken returns the pending prompt of userID whose deep
+// link carries token.
+func findChallengeByStartToken(userID int64, token string) (string, captcha.JoinStatus, bool) {
+	if token == "" {
+		return "", captcha.JoinStatus{}, false
+	}
+	for _, record := range db.List() {
+		if record.Status.StartToken == token && record.Status.UserID == userID {
+			return record.Key, record.Status, true
+		}
+	}
+	return "", captcha.JoinStatus{}, false
+}
+
+// onStart opens the captcha behind a deep link. Without a captcha payload
+// it answers like /help.
+func onStart(c tele.Context) error {
+	if c == nil || c.Chat() == nil || c.Message() == nil {
+		return nil
+	}
+	token, ok := parseStartPayload(c.Message().Payload)
+	if !ok || c.Chat().Type != tele.ChatPrivate {
+		return onHelp(c)
+	}
+	if c.Sender() == nil {
+		logging.Warn("captcha_start_skipped", "reason", "missing_sender", "chat_id", c.Chat().ID)
+		return nil
+	}
+
+	kvID, status, found := findChallengeByStartToken(c.Sender().ID, token)
+	if found && !openingPrompts.claim(kvID) {
+		logging.Info("captcha_start_ignored", "reason", "already_opening", "chat_id", status.ChatID, "user_id", status.UserID)
+		return nil
+	}
+	if found {
+		defer openingPrompts.release(kvID)
+		// Re-read under the claim: the prompt may have been opened since.
+		status, found = db.Get(kvID)
+		found = found && status.StartToken == token
+	}
+	if !found {
+		logging.Info("captcha_start_rejected", "reason", "unknown_token", "chat_id", c.Chat().ID, "user_id", c.Sender().ID)
+		// The group is unknown here, so the default language is used.
+		if err := c.Send(messagesFor(policyForChat(nil)).Text(i18n.StartLinkExpired)); err != nil {
+			logging.Warn("failed_to_send_captcha_start_rejection", "chat_id", c.Chat().ID, "user_id", c.Sender().ID, "err", err)
+		}
+		return nil
+	}
+
+	group := captchaGroupChat(status)
+	policy := policyForChat(group)
+	challenge, err := buildCaptchaChallengeForChat(group)
+	if err != nil {
+		logging.Error("captcha_generation_failed_for_private_delivery", "chat_id", status.ChatID, "user_id", status.UserID, "err", err)
+		if err := c.Send(messagesFor(policy).Text(i18n.StartPrepareFailed)); err != nil {
+			logging.Warn("failed_to_send_captcha_start_failure", "chat_id", c.Chat().ID, "user_id", c.Sender().ID, "err", err)
+		}
+		return nil
+	}
+
+	msg, err := sendCaptchaChallenge(c.Chat(), challenge.ImageBytes, genCaption(c.Sender(), challenge.Type, policy), challenge.Markup)
+	if err != nil && !errors.Is(err, errCaptchaSendTimeout) {
+		logging.Error("failed_to_send_private_captcha_challenge", "chat_id", status.ChatID, "user_id", status.UserID, "err", err)
+		return nil
+	}
+
+	prompt := status.CaptchaMessage
+	message := tele.Message{Chat: c.Chat()}
+	if msg != nil {
+		message = *msg
+	}
+	applyCaptchaChallenge(&status, challenge, message)
+	status.StartToken = ""
+	if err := db.Update(kvID, status); err != nil {
+		logging.Warn("failed_to_persist_private_captcha_state", "chat_id", status.ChatID, "user_id", status.UserID, "err", err)
+	}
+	if prompt.ID > 0 {
+		if err := bot.Delete(&prompt); err != nil {
+			logging.Warn("failed_to_delete_captcha_prompt", "chat_id", status.ChatID, "user_id", status.UserID, "message_id", prompt.ID, "err", err)
+		}
+	}
+	logging.Info(
+		"captcha_opened_in_private_chat",
+		"chat_id", status.ChatID,
+		"user_id", status.UserID,
+		"private_chat_id", c.Chat().ID,
+		"challenge_message_id", message.ID,
+	)
+	return nil
+}
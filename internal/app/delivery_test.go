@@ -0,0 +1,151 @@
+package app
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/challengestore"
+	"toshiki-captcha-bot/internal/i18n"
+)
+
+// startPayloadPattern is the character set Telegram accepts in /start deep
+// link payloads.
+var startPayloadPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func TestNewStartTokenIsValidDeepLinkPayload(t *testing.T) {
+	t.Parallel()
+
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		token, err := newStartToken()
+		if err != nil {
+			t.Fatalf("newStartToken returned error: %v", err)
+		}
+		if payload := startPayloadPrefix + token; !startPayloadPattern.MatchString(payload) {
+			t.Fatalf("payload %q is not a valid deep link payload", payload)
+		}
+		if seen[token] {
+			t.Fatalf("newStartToken returned duplicate token %q", token)
+		}
+		seen[token] = true
+	}
+}
+
+func TestParseStartPayload(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		payload   string
+		wantToken string
+		wantOK    bool
+	}{
+		{name: "captcha payload", payload: "captcha_abc-DEF_1", wantToken: "abc-DEF_1", wantOK: true},
+		{name: "surrounding spaces", payload: " captcha_abc ", wantToken: "abc", wantOK: true},
+		{name: "empty token", payload: "captcha_"},
+		{name: "empty payload", payload: ""},
+		{name: "other payload", payload: "hello"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			token, ok := parseStartPayload(tt.payload)
+			if token != tt.wantToken || ok != tt.wantOK {
+				t.Fatalf("parseStartPayload(%q) = %q, %t, want %q, %t", tt.payload, token, ok, tt.wantToken, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCaptchaPromptMarkup(t *testing.T) {
+	t.Parallel()
+
+	markup := captchaPromptMarkup(i18n.For("en"), "somebot", "tok")
+	if len(markup.InlineKeyboard) != 1 || len(markup.InlineKeyboard[0]) != 1 {
+		t.Fatalf("prompt keyboard = %+v, want a single button", markup.InlineKeyboard)
+	}
+	if got, want := markup.InlineKeyboard[0][0].URL, "https://t.me/somebot?start=captcha_tok"; got != want {
+		t.Fatalf("prompt button URL = %q, want %q", got, want)
+	}
+
+	text := captchaPromptText(i18n.For("en"), &tele.User{ID: 42, FirstName: "Alice"}, time.Minute)
+	if !strings.Contains(text, "[Alice](tg://user?id=42)") || !strings.Contains(text, "1 minute") {
+		t.Fatalf("prompt text = %q, want mention and expiration", text)
+	}
+}
+
+func TestGroupFallbackDelay(t *testing.T) {
+	t.Parallel()
+
+	if got := groupFallbackDelay(time.Minute, time.Minute); got != 30*time.Second {
+		t.Fatalf("groupFallbackDelay(fresh) = %s, want 30s", got)
+	}
+	if got := groupFallbackDelay(40*time.Second, time.Minute); got != 10*time.Second {
+		t.Fatalf("groupFallbackDelay(after restart) = %s, want 10s", got)
+	}
+	if got := groupFallbackDelay(10*time.Second, time.Minute); got != 0 {
+		t.Fatalf("groupFallbackDelay(past fallback point) = %s, want 0", got)
+	}
+}
+
+func TestPromptClaims(t *testing.T) {
+	t.Parallel()
+
+	claims := newPromptClaims()
+	if !claims.claim("1-2") {
+		t.Fatalf("first claim = false, want true")
+	}
+	if claims.claim("1-2") {
+		t.Fatalf("second claim = true, want false")
+	}
+	if !claims.claim("1-3") {
+		t.Fatalf("claim(other key) = false, want true")
+	}
+	claims.release("1-2")
+	if !claims.claim("1-2") {
+		t.Fatalf("claim after release = false, want true")
+	}
+}
+
+func TestFindChallengeByStartToken(t *testing.T) {
+	origDB := db
+	t.Cleanup(func() {
+		db = origDB
+	})
+	db = challengestore.NewMemory(time.Minute, time.Hour)
+
+	group := &tele.Chat{ID: -1001, Type: tele.ChatSuperGroup}
+	prompt := captcha.JoinStatus{UserID: 42, ChatID: group.ID, StartToken: "tok", CaptchaMessage: tele.Message{ID: 3, Chat: group}}
+	opened := captcha.JoinStatus{UserID: 42, ChatID: -1002, CaptchaMessage: tele.Message{ID: 4, Chat: &tele.Chat{ID: 42, Type: tele.ChatPrivate}}}
+	for _, status := range []captcha.JoinStatus{prompt, opened} {
+		if err := db.Set(challengestore.Key(status.UserID, status.ChatID), status, time.Minute); err != nil {
+			t.Fatalf("Set returned error: %v", err)
+		}
+	}
+
+	key, status, found := findChallengeByStartToken(42, "tok")
+	if !found || key != challengestore.Key(42, group.ID) || status.StartToken != "tok" {
+		t.Fatalf("findChallengeByStartToken(owner) = %q, %+v, %t", key, status, found)
+	}
+	if _, _, found := findChallengeByStartToken(43, "tok"); found {
+		t.Fatalf("findChallengeByStartToken(other user) found a challenge")
+	}
+	if _, _, found := findChallengeByStartToken(42, ""); found {
+		t.Fatalf("findChallengeByStartToken(empty token) found a challenge")
+	}
+
+	// Challenges opened in a private chat answer to their group.
+	if got := captchaGroupChat(opened); got.ID != -1002 {
+		t.Fatalf("captchaGroupChat(opened) = %+v, want group -1002", got)
+	}
+	if got := captchaGroupChat(prompt); got != group {
+		t.Fatalf("captchaGroupChat(prompt) = %+v, want prompt chat", got)
+	}
+}
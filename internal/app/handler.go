@@ -5,17 +5,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"image/jpeg"
-	"log"
-	"math/rand"
 	"net"
 	"strings"
 	"time"
 
-	gim "github.com/codenoid/goimagemerge"
 	tele "gopkg.in/telebot.v3"
-	assetstore "toshiki-captcha-bot/assets"
 	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/challengestore"
+	"toshiki-captcha-bot/internal/i18n"
+	"toshiki-captcha-bot/internal/logging"
+	"toshiki-captcha-bot/internal/settings"
 )
 
 type adminCommandResponder interface {
@@ -24,14 +23,10 @@ type adminCommandResponder interface {
 	Send(what interface{}, opts ...interface{}) error
 }
 
-const (
-	captchaAnswerCount = 4
-	captchaDecoyCount  = 6
-)
-
 var errCaptchaSendTimeout = errors.New("captcha challenge send timeout")
 
 type captchaChallenge struct {
+	Type       string
 	AnswerKeys []string
 	Buttons    []tele.InlineButton
 	Markup     *tele.ReplyMarkup
@@ -40,11 +35,11 @@ type captchaChallenge struct {
 
 func onPing(c tele.Context) error {
 	if c == nil || c.Chat() == nil {
-		log.Printf("warn: ping skipped reason=missing_chat_context")
+		logging.Warn("ping_skipped", "reason", "missing_chat_context")
 		return nil
 	}
 	if c.Sender() == nil {
-		log.Printf("warn: ping skipped reason=missing_sender chat_id=%d", c.Chat().ID)
+		logging.Warn("ping_skipped", "reason", "missing_sender", "chat_id", c.Chat().ID)
 		return nil
 	}
 	if leaveIfUnsupportedPrivateGroup(c.Chat(), "ping") {
@@ -82,54 +77,55 @@ func onPing(c tele.Context) error {
 			threadID = incoming.ThreadID
 		}
 	}
-	log.Printf(
-		"Ping received chat_id=%d chat_type=%s user_id=%d username=%q message_id=%d request_thread_id=%d configured_topic_thread_id=%d",
-		chatID,
-		chatType,
-		userID,
-		username,
-		messageID,
-		threadID,
-		topicThreadIDForChat(c.Chat()),
+	logging.Debug(
+		"ping_received",
+		"chat_id", chatID,
+		"chat_type", chatType,
+		"user_id", userID,
+		"username", username,
+		"message_id", messageID,
+		"request_thread_id", threadID,
+		"configured_topic_thread_id", topicThreadIDForChat(c.Chat()),
 	)
 
 	start := time.Now()
 	opts := buildSendOptionsWithTopic(tele.ModeDefault, nil, threadID)
-	log.Printf("Ping send attempt chat_id=%d user_id=%d thread_id=%d", chatID, userID, threadID)
+	logging.Debug("ping_send_attempt", "chat_id", chatID, "user_id", userID, "thread_id", threadID)
 	msg, err := bot.Send(c.Chat(), "pong...", opts)
 	if err != nil && threadID != 0 && strings.Contains(err.Error(), "message thread not found") {
-		log.Printf(
-			"warn: ping send failed with thread not found chat_id=%d user_id=%d thread_id=%d err=%v fallback=chat_root",
-			chatID,
-			userID,
-			threadID,
-			err,
+		logging.Warn(
+			"ping_send_failed_with_thread_not_found",
+			"chat_id", chatID,
+			"user_id", userID,
+			"thread_id", threadID,
+			"err", err,
+			"fallback", "chat_root",
 		)
 		// Fallback to chat root when thread reference is stale or invalid.
 		msg, err = bot.Send(c.Chat(), "pong...", buildSendOptionsWithTopic(tele.ModeDefault, nil, 0))
 	}
 	if err != nil {
-		log.Printf("warn: failed to send ping response chat_id=%d err=%v", chatID, err)
+		logging.Warn("failed_to_send_ping_response", "chat_id", chatID, "err", err)
 		return nil
 	}
 
 	latencyMS := time.Since(start).Milliseconds()
-	log.Printf("Ping sent chat_id=%d user_id=%d response_message_id=%d latency_ms=%d", chatID, userID, msg.ID, latencyMS)
+	logging.Info("ping_sent", "chat_id", chatID, "user_id", userID, "response_message_id", msg.ID, "latency_ms", latencyMS)
 	if _, err := bot.Edit(msg, fmt.Sprintf("pong %d ms", latencyMS)); err != nil {
-		log.Printf("warn: failed to edit ping response chat_id=%d message_id=%d err=%v", chatID, msg.ID, err)
+		logging.Warn("failed_to_edit_ping_response", "chat_id", chatID, "message_id", msg.ID, "err", err)
 		return nil
 	}
-	log.Printf("Ping completed chat_id=%d user_id=%d response_message_id=%d latency_ms=%d", chatID, userID, msg.ID, latencyMS)
+	logging.Info("ping_completed", "chat_id", chatID, "user_id", userID, "response_message_id", msg.ID, "latency_ms", latencyMS)
 	return nil
 }
 
 func onTestCaptcha(c tele.Context) error {
 	if c == nil || c.Chat() == nil {
-		log.Printf("warn: testcaptcha skipped reason=missing_chat_context")
+		logging.Warn("testcaptcha_skipped", "reason", "missing_chat_context")
 		return nil
 	}
 	if c.Sender() == nil {
-		log.Printf("warn: testcaptcha skipped reason=missing_sender chat_id=%d", c.Chat().ID)
+		logging.Warn("testcaptcha_skipped", "reason", "missing_sender", "chat_id", c.Chat().ID)
 		return nil
 	}
 	if leaveIfUnsupportedPrivateGroup(c.Chat(), "testcaptcha") {
@@ -148,20 +144,28 @@ func onTestCaptcha(c tele.Context) error {
 		return nil
 	}
 	if c.Chat().Type == tele.ChatPrivate {
-		log.Printf("warn: testcaptcha skipped reason=private_chat_requires_group chat_id=%d user_id=%d", c.Chat().ID, c.Sender().ID)
+		logging.Warn("testcaptcha_skipped", "reason", "private_chat_requires_group", "chat_id", c.Chat().ID, "user_id", c.Sender().ID)
 		return nil
 	}
 
 	targetUser, err := resolveTestCaptchaTargetFromReply(c.Message())
 	if err != nil {
-		log.Printf("warn: testcaptcha target resolution failed chat_id=%d actor_user_id=%d err=%v", c.Chat().ID, c.Sender().ID, err)
+		logging.Warn("testcaptcha_target_resolution_failed", "chat_id", c.Chat().ID, "actor_user_id", c.Sender().ID, "err", err)
 		if sendErr := c.Send("Usage: reply to the target user's message with `/testcaptcha`.", tele.ModeMarkdown); sendErr != nil {
-			log.Printf("warn: failed to send testcaptcha resolution error chat_id=%d actor_user_id=%d err=%v", c.Chat().ID, c.Sender().ID, sendErr)
+			logging.Warn("failed_to_send_testcaptcha_resolution_error", "chat_id", c.Chat().ID, "actor_user_id", c.Sender().ID, "err", sendErr)
 		}
 		return nil
 	}
 
-	log.Printf("Manual captcha trigger chat_id=%d actor_user_id=%d target_user_id=%d target_username=%q", c.Chat().ID, c.Sender().ID, targetUser.ID, targetUser.Username)
+	logging.Info("manual_captcha_trigger", "chat_id", c.Chat().ID, "actor_user_id", c.Sender().ID, "target_user_id", targetUser.ID, "target_username", targetUser.Username)
+	postModerationRecord(moderationRecord{
+		event:     modlogManualChallenge,
+		chat:      c.Chat(),
+		userID:    targetUser.ID,
+		userName:  userDisplayName(targetUser),
+		actorID:   c.Sender().ID,
+		actorName: userDisplayName(c.Sender()),
+	})
 	return issueCaptchaChallenge(c, targetUser, true, true)
 }
 
@@ -170,12 +174,12 @@ func respondAdminOnlyCommandDenied(c adminCommandResponder, command string) {
 		return
 	}
 	if err := c.Send(adminOnlyCommandErrorText(command)); err != nil {
-		log.Printf(
-			"warn: failed to send unauthorized response command=%s chat_id=%d user_id=%d err=%v",
-			command,
-			c.Chat().ID,
-			c.Sender().ID,
-			err,
+		logging.Warn(
+			"failed_to_send_unauthorized_response",
+			"command", command,
+			"chat_id", c.Chat().ID,
+			"user_id", c.Sender().ID,
+			"err", err,
 		)
 	}
 }
@@ -185,11 +189,11 @@ func onJoin(c tele.Context) error {
 		return nil
 	}
 	if c.Sender() == nil {
-		log.Printf("warn: join skipped reason=missing_sender chat_id=%d", c.Chat().ID)
+		logging.Warn("join_skipped", "reason", "missing_sender", "chat_id", c.Chat().ID)
 		return nil
 	}
 	if c.Message() == nil {
-		log.Printf("warn: join skipped reason=missing_message chat_id=%d user_id=%d", c.Chat().ID, c.Sender().ID)
+		logging.Warn("join_skipped", "reason", "missing_message", "chat_id", c.Chat().ID, "user_id", c.Sender().ID)
 		return nil
 	}
 
@@ -207,6 +211,14 @@ func onJoin(c tele.Context) error {
 		return nil
 	}
 
+	// Users let in through a solved join request captcha were already
+	// checked; skip the join message Telegram posts for the approval.
+	if approvedJoinRequests.consume(challengestore.Key(c.Sender().ID, c.Chat().ID), time.Now()) {
+		logging.Info("join_skipped", "reason", "join_request_approved", "chat_id", c.Chat().ID, "user_id", c.Sender().ID)
+		return nil
+	}
+	postModerationRecord(moderationRecord{event: modlogJoin, chat: c.Chat(), userID: c.Sender().ID, userName: userDisplayName(c.Sender())})
+
 	return issueCaptchaChallenge(c, c.Sender(), true, false)
 }
 
@@ -218,20 +230,21 @@ func issueCaptchaChallenge(c tele.Context, targetUser *tele.User, deleteTriggerM
 	// delete any incoming message before challenge solved
 	if deleteTriggerMessage && c.Message() != nil {
 		if err := bot.Delete(c.Message()); err != nil {
-			log.Printf("warn: failed to delete trigger message chat_id=%d user_id=%d err=%v", c.Chat().ID, targetUser.ID, err)
+			logging.Warn("failed_to_delete_trigger_message", "chat_id", c.Chat().ID, "user_id", targetUser.ID, "err", err)
 		}
 	}
 
 	// kvID is combination of user id and chat id
-	kvID := fmt.Sprintf("%v-%v", targetUser.ID, c.Chat().ID)
+	kvID := challengestore.Key(targetUser.ID, c.Chat().ID)
+	policy := policyForChat(c.Chat())
 
 	// skip captcha-generation if data still exist
 	if _, found := db.Get(kvID); found {
-		log.Printf("Captcha already pending chat_id=%d user_id=%d", c.Chat().ID, targetUser.ID)
+		logging.Info("captcha_already_pending", "chat_id", c.Chat().ID, "user_id", targetUser.ID)
 		if manualChallenge {
 			mention := markdownMention(targetUser)
 			if err := c.Send(fmt.Sprintf("Captcha test already in progress for %s.", mention), tele.ModeMarkdown); err != nil {
-				log.Printf("warn: failed to send duplicate manual captcha notice chat_id=%d user_id=%d err=%v", c.Chat().ID, targetUser.ID, err)
+				logging.Warn("failed_to_send_duplicate_manual_captcha_notice", "chat_id", c.Chat().ID, "user_id", targetUser.ID, "err", err)
 			}
 		}
 		return nil
@@ -242,66 +255,79 @@ func issueCaptchaChallenge(c tele.Context, targetUser *tele.User, deleteTriggerM
 	if !manualChallenge {
 		member, err := bot.ChatMemberOf(c.Chat(), targetUser)
 		if err != nil {
-			log.Printf("warn: failed to load member state for restriction chat_id=%d user_id=%d err=%v", c.Chat().ID, targetUser.ID, err)
+			logging.Warn("failed_to_load_member_state_for_restriction", "chat_id", c.Chat().ID, "user_id", targetUser.ID, "err", err)
 			return nil
 		}
 		chatMember = member
 		original := *chatMember
 		originalMember = &original
 
-		applyCaptchaRestriction(chatMember, cfg.Captcha.Expiration)
-		if err := bot.Restrict(c.Chat(), chatMember); err != nil {
-			log.Printf("warn: failed to restrict user chat_id=%d user_id=%d err=%v", c.Chat().ID, targetUser.ID, err)
+		applyCaptchaRestriction(chatMember, policy.Expiration)
+		if err := restrictMember(c.Chat(), chatMember); err != nil {
+			logging.Warn("failed_to_restrict_user", "chat_id", c.Chat().ID, "user_id", targetUser.ID, "err", err)
+			postModerationRecord(moderationRecord{event: modlogRestrictFailed, chat: c.Chat(), userID: targetUser.ID, userName: userDisplayName(targetUser), err: err})
 			if c.Sender() != nil && targetUser.ID != c.Sender().ID {
 				if sendErr := c.Send("Failed to restrict target user. Ensure the target is not an admin and bot has restrict permissions."); sendErr != nil {
-					log.Printf("warn: failed to send restrict failure notice chat_id=%d actor_user_id=%d target_user_id=%d err=%v", c.Chat().ID, c.Sender().ID, targetUser.ID, sendErr)
+					logging.Warn("failed_to_send_restrict_failure_notice", "chat_id", c.Chat().ID, "actor_user_id", c.Sender().ID, "target_user_id", targetUser.ID, "err", sendErr)
 				}
 			}
 			return nil
 		}
-		log.Printf("User restricted pending captcha chat_id=%d user_id=%d until=%d", c.Chat().ID, targetUser.ID, chatMember.RestrictedUntil)
+		logging.Info("user_restricted_pending_captcha", "chat_id", c.Chat().ID, "user_id", targetUser.ID, "until", chatMember.RestrictedUntil)
+	}
+
+	if currentConfig().Captcha.IsPrivateDelivery() {
+		return issuePrivateCaptchaPrompt(c.Chat(), targetUser, kvID, policy, chatMember, originalMember, manualChallenge)
 	}
 
-	challenge, err := buildCaptchaChallenge(captchaAnswerCount, captchaDecoyCount)
+	challenge, err := buildCaptchaChallengeForChat(c.Chat())
 	if err != nil {
-		log.Printf("error: captcha generation failed chat_id=%d user_id=%d err=%v", c.Chat().ID, targetUser.ID, err)
+		logging.Error("captcha_generation_failed", "chat_id", c.Chat().ID, "user_id", targetUser.ID, "err", err)
 		if !manualChallenge {
 			restoreUserRestriction(c.Chat(), targetUser, originalMember, "captcha_generation_failed")
 		}
 		return nil
 	}
 
-	msg, err := sendCaptchaChallenge(c.Chat(), challenge.ImageBytes, genCaption(targetUser), challenge.Markup)
+	msg, err := sendCaptchaChallenge(c.Chat(), challenge.ImageBytes, genCaption(targetUser, challenge.Type, policy), challenge.Markup)
 	if err != nil {
 		if errors.Is(err, errCaptchaSendTimeout) {
 			// Timeout is delivery-uncertain: keep challenge state for callback matching.
 			if !manualChallenge {
-				applyCaptchaRestriction(chatMember, cfg.Captcha.Expiration)
-				if restrictErr := bot.Restrict(c.Chat(), chatMember); restrictErr != nil {
-					log.Printf("warn: failed to extend user restriction after timeout chat_id=%d user_id=%d err=%v", c.Chat().ID, targetUser.ID, restrictErr)
+				applyCaptchaRestriction(chatMember, policy.Expiration)
+				if restrictErr := restrictMember(c.Chat(), chatMember); restrictErr != nil {
+					logging.Warn("failed_to_extend_user_restriction_after_timeout", "chat_id", c.Chat().ID, "user_id", targetUser.ID, "err", restrictErr)
 				}
 			}
 
 			unknownMessage := tele.Message{Chat: c.Chat()}
 			status := newJoinStatus(targetUser, c.Chat(), challenge, unknownMessage, manualChallenge)
-			db.Set(kvID, status, cfg.Captcha.Expiration)
+			if err := db.Set(kvID, status, policy.Expiration); err != nil {
+				logging.Warn("failed_to_persist_captcha_state", "chat_id", c.Chat().ID, "user_id", targetUser.ID, "err", err)
+			}
+			recordChallengeIssued(status)
+			postChallengeIssuedRecord(status)
 			if manualChallenge {
-				log.Printf(
-					"warn: manual captcha delivery uncertain chat_id=%d user_id=%d challenge_message_id=unknown action=wait_for_callback",
-					c.Chat().ID,
-					targetUser.ID,
+				logging.Warn(
+					"manual_captcha_delivery_uncertain",
+					"chat_id", c.Chat().ID,
+					"user_id", targetUser.ID,
+					"challenge_message_id", "unknown",
+					"action", "wait_for_callback",
 				)
 			} else {
-				log.Printf(
-					"warn: captcha delivery uncertain chat_id=%d user_id=%d challenge_message_id=unknown action=keep_restricted_and_wait_for_callback",
-					c.Chat().ID,
-					targetUser.ID,
+				logging.Warn(
+					"captcha_delivery_uncertain",
+					"chat_id", c.Chat().ID,
+					"user_id", targetUser.ID,
+					"challenge_message_id", "unknown",
+					"action", "keep_restricted_and_wait_for_callback",
 				)
 			}
 			return nil
 		}
 
-		log.Printf("error: failed to send captcha challenge chat_id=%d user_id=%d err=%v", c.Chat().ID, targetUser.ID, err)
+		logging.Error("failed_to_send_captcha_challenge", "chat_id", c.Chat().ID, "user_id", targetUser.ID, "err", err)
 		if !manualChallenge {
 			restoreUserRestriction(c.Chat(), targetUser, originalMember, "captcha_send_failed")
 		}
@@ -311,11 +337,12 @@ func issueCaptchaChallenge(c tele.Context, targetUser *tele.User, deleteTriggerM
 	if !manualChallenge {
 		// Refresh restriction window after successful challenge delivery so
 		// expiration starts from when user can actually solve the captcha.
-		applyCaptchaRestriction(chatMember, cfg.Captcha.Expiration)
-		if err := bot.Restrict(c.Chat(), chatMember); err != nil {
-			log.Printf("warn: failed to refresh user restriction window chat_id=%d user_id=%d err=%v", c.Chat().ID, targetUser.ID, err)
+		applyCaptchaRestriction(chatMember, policy.Expiration)
+		if err := restrictMember(c.Chat(), chatMember); err != nil {
+			logging.Warn("failed_to_refresh_user_restriction_window", "chat_id", c.Chat().ID, "user_id", targetUser.ID, "err", err)
+			postModerationRecord(moderationRecord{event: modlogRestrictFailed, chat: c.Chat(), userID: targetUser.ID, userName: userDisplayName(targetUser), err: err})
 			if err := bot.Delete(msg); err != nil {
-				log.Printf("warn: failed to delete captcha after restriction refresh failure chat_id=%d user_id=%d message_id=%d err=%v", c.Chat().ID, targetUser.ID, msg.ID, err)
+				logging.Warn("failed_to_delete_captcha_after_restriction_refresh_failure", "chat_id", c.Chat().ID, "user_id", targetUser.ID, "message_id", msg.ID, "err", err)
 			}
 			restoreUserRestriction(c.Chat(), targetUser, originalMember, "captcha_restriction_refresh_failed")
 			return nil
@@ -323,14 +350,18 @@ func issueCaptchaChallenge(c tele.Context, targetUser *tele.User, deleteTriggerM
 	}
 
 	status := newJoinStatus(targetUser, c.Chat(), challenge, *msg, manualChallenge)
-	db.Set(kvID, status, cfg.Captcha.Expiration)
-	log.Printf(
-		"Captcha issued chat_id=%d user_id=%d challenge_message_id=%d answer_count=%d topic_thread_id=%d",
-		c.Chat().ID,
-		targetUser.ID,
-		msg.ID,
-		len(status.CaptchaAnswer),
-		topicThreadIDForChat(c.Chat()),
+	if err := db.Set(kvID, status, policy.Expiration); err != nil {
+		logging.Warn("failed_to_persist_captcha_state", "chat_id", c.Chat().ID, "user_id", targetUser.ID, "err", err)
+	}
+	recordChallengeIssued(status)
+	postChallengeIssuedRecord(status)
+	logging.Info(
+		"captcha_issued",
+		"chat_id", c.Chat().ID,
+		"user_id", targetUser.ID,
+		"challenge_message_id", msg.ID,
+		"answer_count", len(status.CaptchaAnswer),
+		"topic_thread_id", topicThreadIDForChat(c.Chat()),
 	)
 
 	return nil
@@ -356,6 +387,7 @@ func newJoinStatus(user *tele.User, chat *tele.Chat, challenge captchaChallenge,
 		status.UserFullName = sanitizeName(user.FirstName + " " + user.LastName)
 	}
 	status.ManualChallenge = manualChallenge
+	status.IssuedAt = time.Now()
 	if chat != nil {
 		status.ChatID = chat.ID
 	}
@@ -376,39 +408,36 @@ func restoreUserRestriction(chat *tele.Chat, user *tele.User, member *tele.ChatM
 		return
 	}
 	if bot == nil {
-		log.Printf(
-			"warn: restore skipped reason=bot_not_initialized chat_id=%d user_id=%d restore_reason=%s",
-			chat.ID,
-			user.ID,
-			reason,
+		logging.Warn(
+			"restore_skipped",
+			"reason", "bot_not_initialized",
+			"chat_id", chat.ID,
+			"user_id", user.ID,
+			"restore_reason", reason,
 		)
 		return
 	}
 	if member.User == nil {
 		member.User = user
 	}
-	if err := bot.Restrict(chat, member); err != nil {
-		log.Printf(
-			"warn: failed to restore user restriction state chat_id=%d user_id=%d reason=%s err=%v",
-			chat.ID,
-			user.ID,
-			reason,
-			err,
+	if err := restrictMember(chat, member); err != nil {
+		logging.Warn(
+			"failed_to_restore_user_restriction_state",
+			"chat_id", chat.ID,
+			"user_id", user.ID,
+			"reason", reason,
+			"err", err,
 		)
 		return
 	}
-	log.Printf(
-		"User restriction state restored chat_id=%d user_id=%d reason=%s",
-		chat.ID,
-		user.ID,
-		reason,
+	logging.Info(
+		"user_restriction_state_restored",
+		"chat_id", chat.ID,
+		"user_id", user.ID,
+		"reason", reason,
 	)
 }
 
-func shouldBanOnCaptchaFailure(status captcha.JoinStatus) bool {
-	return !status.ManualChallenge
-}
-
 func markdownMention(user *tele.User) string {
 	if user == nil {
 		return "[user](tg://user?id=0)"
@@ -430,68 +459,81 @@ func captchaFailureUserMention(status captcha.JoinStatus) string {
 	return fmt.Sprintf(`[%v](tg://user?id=%v)`, displayName, status.UserID)
 }
 
-func captchaFailureNoticeText(status captcha.JoinStatus, banned bool, failureNoticeTTL time.Duration) string {
+func captchaFailureNoticeText(msgs i18n.Messages, status captcha.JoinStatus, action settings.CaptchaAction, failureNoticeTTL time.Duration) string {
 	mention := captchaFailureUserMention(status)
-	if banned {
-		msg := "Captcha failed, %v has been banned, please contact administrator if %v are real human with non-automated account"
-		msg += "\n\n this message will automatically removed in %s..."
-		return fmt.Sprintf(msg, mention, mention, humanizeDuration(failureNoticeTTL))
+	outcome := captchaActionOutcome(msgs, action)
+	if outcome == "" {
+		return msgs.Text(i18n.FailureNoticeNoAction, mention)
 	}
-	return fmt.Sprintf("%v captcha failed.", mention)
+
+	msg := msgs.Text(i18n.FailureNotice, mention, outcome)
+	if action.Action != settings.CaptchaActionKick {
+		msg += msgs.Text(i18n.FailureNoticeContact, mention)
+	}
+	msg += msgs.Text(i18n.FailureNoticeRemoval, msgs.Duration(failureNoticeTTL))
+	return msg
 }
 
-func captchaSuccessCallbackText(status captcha.JoinStatus) string {
+func captchaSuccessCallbackText(msgs i18n.Messages, status captcha.JoinStatus) string {
+	if status.JoinRequest {
+		return msgs.Text(i18n.SuccessJoinRequest)
+	}
 	if status.ManualChallenge {
-		return "Manual test captcha completed successfully."
+		return msgs.Text(i18n.SuccessManual)
 	}
-	return "Successfully joined."
+	return msgs.Text(i18n.SuccessJoined)
 }
 
-func notYourCaptchaCallbackResponse() *tele.CallbackResponse {
+func notYourCaptchaCallbackResponse(msgs i18n.Messages) *tele.CallbackResponse {
 	return &tele.CallbackResponse{
-		Text:      "This is not your captcha challenge. Please solve your own challenge.",
+		Text:      msgs.Text(i18n.NotYourCaptcha),
 		ShowAlert: true,
 	}
 }
 
-func captchaTimeoutNoticeText(status captcha.JoinStatus) string {
-	return fmt.Sprintf("Captcha timeout, %v did not resolve the challenge in time.", captchaFailureUserMention(status))
+func captchaTimeoutNoticeText(msgs i18n.Messages, status captcha.JoinStatus) string {
+	return msgs.Text(i18n.TimeoutNotice, captchaFailureUserMention(status))
 }
 
-func sendCaptchaFailureNotice(status captcha.JoinStatus, targetChat *tele.Chat, banned bool) {
+func sendCaptchaFailureNotice(status captcha.JoinStatus, targetChat *tele.Chat, action settings.CaptchaAction) {
 	if targetChat == nil {
-		log.Printf("warn: failed to send captcha failure notice reason=missing_target_chat user_id=%d", status.UserID)
+		logging.Warn("failed_to_send_captcha_failure_notice", "reason", "missing_target_chat", "user_id", status.UserID)
 		return
 	}
 
-	msg := captchaFailureNoticeText(status, banned, cfg.Captcha.FailureNoticeTTL)
+	policy := policyForChat(targetChat)
+	msgs := messagesFor(policy)
+	msg := captchaFailureNoticeText(msgs, status, action, policy.FailureNoticeTTL)
 	msgr, err := sendWithConfiguredTopic(targetChat, msg, tele.ModeMarkdown, nil)
 	if err != nil {
-		log.Printf("warn: failed to send captcha failure notice chat_id=%d user_id=%d banned=%t err=%v", targetChat.ID, status.UserID, banned, err)
+		logging.Warn("failed_to_send_captcha_failure_notice", "chat_id", targetChat.ID, "user_id", status.UserID, "action", action.Action, "err", err)
 		return
 	}
 
-	if !banned {
+	// Only notices announcing a consequence mention the auto-removal.
+	if captchaActionOutcome(msgs, action) == "" {
 		return
 	}
 
-	go func(msgr *tele.Message, chatID int64, userID int64) {
-		time.Sleep(cfg.Captcha.FailureNoticeTTL)
+	chatID := targetChat.ID
+	ttl := policy.FailureNoticeTTL
+	inFlight.Go(func() {
+		sleepUntilShutdown(ttl)
 		if err := bot.Delete(msgr); err != nil {
-			log.Printf("warn: failed to delete failure notice message chat_id=%d user_id=%d err=%v", chatID, userID, err)
+			logging.Warn("failed_to_delete_failure_notice_message", "chat_id", chatID, "user_id", status.UserID, "err", err)
 		}
-	}(msgr, targetChat.ID, status.UserID)
+	})
 }
 
 func sendCaptchaTimeoutNotice(status captcha.JoinStatus, targetChat *tele.Chat) {
 	if targetChat == nil {
-		log.Printf("warn: failed to send captcha timeout notice reason=missing_target_chat user_id=%d", status.UserID)
+		logging.Warn("failed_to_send_captcha_timeout_notice", "reason", "missing_target_chat", "user_id", status.UserID)
 		return
 	}
 
-	msg := captchaTimeoutNoticeText(status)
+	msg := captchaTimeoutNoticeText(messagesFor(policyForChat(targetChat)), status)
 	if _, err := sendWithConfiguredTopic(targetChat, msg, tele.ModeMarkdown, nil); err != nil {
-		log.Printf("warn: failed to send captcha timeout notice chat_id=%d user_id=%d err=%v", targetChat.ID, status.UserID, err)
+		logging.Warn("failed_to_send_captcha_timeout_notice", "chat_id", targetChat.ID, "user_id", status.UserID, "err", err)
 	}
 }
 
@@ -506,6 +548,9 @@ func sendCaptchaChallenge(chat *tele.Chat, imageBytes []byte, caption string, ma
 	}
 
 	if isTimeoutLikeError(err) {
+		if chat != nil {
+			sendTimeouts.Inc(chatLabel(chat.ID))
+		}
 		return nil, fmt.Errorf("%w: %v", errCaptchaSendTimeout, err)
 	}
 
@@ -541,125 +586,124 @@ func isTimeoutLikeError(err error) bool {
 
 func handleAnswer(c tele.Context) error {
 	if c == nil || c.Chat() == nil || c.Callback() == nil || c.Callback().Sender == nil || c.Callback().Message == nil {
-		log.Printf(
-			"warn: callback skipped reason=missing_callback_context has_context=%t has_chat=%t has_callback=%t has_sender=%t has_message=%t",
-			c != nil,
-			c != nil && c.Chat() != nil,
-			c != nil && c.Callback() != nil,
-			c != nil && c.Callback() != nil && c.Callback().Sender != nil,
-			c != nil && c.Callback() != nil && c.Callback().Message != nil,
+		logging.Warn(
+			"callback_skipped",
+			"reason", "missing_callback_context",
+			"has_context", c != nil,
+			"has_chat", c != nil && c.Chat() != nil,
+			"has_callback", c != nil && c.Callback() != nil,
+			"has_sender", c != nil && c.Callback() != nil && c.Callback().Sender != nil,
+			"has_message", c != nil && c.Callback() != nil && c.Callback().Message != nil,
 		)
 		return nil
 	}
 
-	if c.Chat().Type == tele.ChatPrivate {
-		return nil
-	}
-	if !isContextAuthorized(c) {
-		logAccessDenied(c, "callback")
-		return nil
-	}
-
-	// kvID is combination of user id and chat id
-	kvID := fmt.Sprintf("%v-%v", c.Callback().Sender.ID, c.Chat().ID)
-
 	messageID := c.Callback().Message.ID
 	answer := strings.TrimSpace(c.Callback().Data)
 	answer = strings.Split(answer, "|")[0]
 
-	status := captcha.JoinStatus{}
-	if data, found := db.Get(kvID); !found {
-		c.Respond(notYourCaptchaCallbackResponse())
-		log.Printf("Answer rejected (missing challenge) chat_id=%d user_id=%d", c.Chat().ID, c.Callback().Sender.ID)
-		return nil
+	var (
+		kvID   string
+		status captcha.JoinStatus
+		found  bool
+	)
+	// groupChat is the chat the challenge gates. It differs from c.Chat()
+	// when the challenge was delivered in a private chat.
+	groupChat := c.Chat()
+	if c.Chat().Type == tele.ChatPrivate {
+		kvID, status, found = findPrivateChallenge(c.Callback().Sender.ID, c.Chat().ID, messageID)
+		if found {
+			groupChat = captchaGroupChat(status)
+		}
 	} else {
-		status = data.(captcha.JoinStatus)
+		if !isContextAuthorized(c) {
+			logAccessDenied(c, "callback")
+			return nil
+		}
+		// kvID is combination of user id and chat id
+		kvID = challengestore.Key(c.Callback().Sender.ID, c.Chat().ID)
+		status, found = db.Get(kvID)
+	}
+	policy := policyForChat(groupChat)
+	msgs := messagesFor(policy)
+	if !found {
+		c.Respond(notYourCaptchaCallbackResponse(msgs))
+		logging.Info("answer_rejected", "reason", "missing_challenge", "chat_id", c.Chat().ID, "user_id", c.Callback().Sender.ID)
+		return nil
 	}
 
 	if bindCaptchaMessageIfUnset(&status, c.Callback().Message) {
 		if err := db.Update(kvID, status); err != nil {
-			log.Printf("warn: failed to persist captcha message binding chat_id=%d user_id=%d message_id=%d err=%v", c.Chat().ID, c.Callback().Sender.ID, messageID, err)
+			logging.Warn("failed_to_persist_captcha_message_binding", "chat_id", groupChat.ID, "user_id", c.Callback().Sender.ID, "message_id", messageID, "err", err)
 		}
-		log.Printf("Captcha message bound chat_id=%d user_id=%d message_id=%d", c.Chat().ID, c.Callback().Sender.ID, messageID)
+		logging.Debug("captcha_message_bound", "chat_id", groupChat.ID, "user_id", c.Callback().Sender.ID, "message_id", messageID)
 	} else if messageID != status.CaptchaMessage.ID {
-		c.Respond(notYourCaptchaCallbackResponse())
-		log.Printf("Answer rejected (message mismatch) chat_id=%d user_id=%d got_message_id=%d expected_message_id=%d", c.Chat().ID, c.Callback().Sender.ID, messageID, status.CaptchaMessage.ID)
+		c.Respond(notYourCaptchaCallbackResponse(msgs))
+		logging.Info("answer_rejected", "reason", "message_mismatch", "chat_id", groupChat.ID, "user_id", c.Callback().Sender.ID, "got_message_id", messageID, "expected_message_id", status.CaptchaMessage.ID)
 		return nil
 	}
 
-	correct, expected := isNextCaptchaAnswer(status, answer)
+	correct, expected := captcha.ValidateAnswer(status, answer)
 	if correct {
 		status.SolvedCaptcha++
 	} else {
 		status.FailCaptcha++
-		db.Update(kvID, status)
-		log.Printf(
-			"Answer rejected (wrong sequence) chat_id=%d user_id=%d got=%q expected=%q solved=%d total=%d",
-			c.Chat().ID,
-			c.Callback().Sender.ID,
-			answer,
-			expected,
-			status.SolvedCaptcha,
-			len(status.CaptchaAnswer),
+		if err := db.Update(kvID, status); err != nil {
+			logging.Warn("failed_to_persist_captcha_failure_count", "chat_id", groupChat.ID, "user_id", c.Callback().Sender.ID, "err", err)
+		}
+		logging.Info(
+			"answer_rejected",
+			"reason", "wrong_answer",
+			"chat_id", groupChat.ID,
+			"user_id", c.Callback().Sender.ID,
+			"got", answer,
+			"expected", expected,
+			"solved", status.SolvedCaptcha,
+			"total", len(status.CaptchaAnswer),
 		)
 
-		if status.FailCaptcha >= cfg.Captcha.MaxFailures {
-			db.Delete(kvID)
-			targetChat := status.CaptchaMessage.Chat
-			if targetChat == nil {
-				targetChat = c.Chat()
-			}
-
-			if status.CaptchaMessage.ID > 0 {
-				if err := bot.Delete(&status.CaptchaMessage); err != nil {
-					log.Printf("warn: failed to delete failed captcha message chat_id=%d user_id=%d err=%v", c.Chat().ID, c.Sender().ID, err)
-				}
-			}
-
-			if !shouldBanOnCaptchaFailure(status) {
-				c.Respond(&tele.CallbackResponse{Text: "Captcha failed.", ShowAlert: true})
-				sendCaptchaFailureNotice(status, targetChat, false)
-				log.Printf("Manual captcha failed chat_id=%d user_id=%d solved=%d failed=%d", c.Chat().ID, status.UserID, status.SolvedCaptcha, status.FailCaptcha)
-				return nil
-			}
-
-			c.Respond(&tele.CallbackResponse{Text: "Captcha failed, you have been banned, please contact admin with your another account.", ShowAlert: true})
-			if err := bot.Ban(targetChat, &tele.ChatMember{User: &tele.User{ID: status.UserID}}, false); err != nil {
-				log.Printf("warn: failed to ban failed captcha user chat_id=%d user_id=%d err=%v", c.Chat().ID, status.UserID, err)
+		if status.FailCaptcha >= policy.MaxFailures {
+			if status.JoinRequest {
+				c.Respond(&tele.CallbackResponse{Text: msgs.Text(i18n.JoinRequestFailedAlert), ShowAlert: true})
+			} else {
+				action := captchaFailureAction(status, captchaNoticeChat(status, groupChat))
+				c.Respond(&tele.CallbackResponse{Text: captchaFailureCallbackText(msgs, action), ShowAlert: true})
 			}
-			sendCaptchaFailureNotice(status, targetChat, true)
-			log.Printf("Captcha failed chat_id=%d user_id=%d solved=%d failed=%d", c.Chat().ID, c.Sender().ID, status.SolvedCaptcha, status.FailCaptcha)
+			failCaptchaChallenge(kvID, status, groupChat, "failure", nil)
 			return nil
 		}
 
-		challenge, err := buildCaptchaChallenge(captchaAnswerCount, captchaDecoyCount)
+		challenge, err := buildCaptchaChallengeForChat(groupChat)
 		if err != nil {
-			log.Printf("error: failed to regenerate captcha challenge chat_id=%d user_id=%d err=%v", c.Chat().ID, c.Sender().ID, err)
-			c.Respond(&tele.CallbackResponse{Text: "Wrong sequence. Please continue with the current puzzle.", ShowAlert: true})
+			logging.Error("failed_to_regenerate_captcha_challenge", "chat_id", groupChat.ID, "user_id", c.Sender().ID, "err", err)
+			c.Respond(&tele.CallbackResponse{Text: msgs.Text(i18n.WrongAnswer), ShowAlert: true})
 			return nil
 		}
 
 		file := tele.FromReader(bytes.NewReader(challenge.ImageBytes))
 		photo := &tele.Photo{File: file}
-		photo.Caption = genCaption(c.Sender())
+		photo.Caption = genCaptionForStatus(c.Sender(), challenge.Type, status)
 
 		newMsg, err := sendWithConfiguredTopic(c.Chat(), photo, tele.ModeMarkdown, challenge.Markup)
 		if err != nil {
-			log.Printf("error: failed to send regenerated captcha challenge chat_id=%d user_id=%d err=%v", c.Chat().ID, c.Sender().ID, err)
-			c.Respond(&tele.CallbackResponse{Text: "Wrong sequence. Please continue with the current puzzle.", ShowAlert: true})
+			logging.Error("failed_to_send_regenerated_captcha_challenge", "chat_id", groupChat.ID, "user_id", c.Sender().ID, "err", err)
+			c.Respond(&tele.CallbackResponse{Text: msgs.Text(i18n.WrongAnswer), ShowAlert: true})
 			return nil
 		}
 
 		oldMessage := status.CaptchaMessage
 		applyCaptchaChallenge(&status, challenge, *newMsg)
-		db.Update(kvID, status)
+		if err := db.Update(kvID, status); err != nil {
+			logging.Warn("failed_to_persist_regenerated_captcha_state", "chat_id", groupChat.ID, "user_id", c.Sender().ID, "err", err)
+		}
 		if oldMessage.ID > 0 {
 			if err := bot.Delete(&oldMessage); err != nil {
-				log.Printf("warn: failed to delete previous captcha message chat_id=%d user_id=%d message_id=%d err=%v", c.Chat().ID, c.Sender().ID, oldMessage.ID, err)
+				logging.Warn("failed_to_delete_previous_captcha_message", "chat_id", groupChat.ID, "user_id", c.Sender().ID, "message_id", oldMessage.ID, "err", err)
 			}
 		}
-		c.Respond(&tele.CallbackResponse{Text: "Wrong sequence. A new puzzle has been generated.", ShowAlert: true})
-		log.Printf("Captcha regenerated chat_id=%d user_id=%d old_message_id=%d new_message_id=%d failed=%d", c.Chat().ID, c.Sender().ID, oldMessage.ID, newMsg.ID, status.FailCaptcha)
+		regenerations.Inc(chatLabel(groupChat.ID))
+		c.Respond(&tele.CallbackResponse{Text: msgs.Text(i18n.WrongAnswerNew), ShowAlert: true})
+		logging.Info("captcha_regenerated", "chat_id", groupChat.ID, "user_id", c.Sender().ID, "old_message_id", oldMessage.ID, "new_message_id", newMsg.ID, "failed", status.FailCaptcha)
 		return nil
 	}
 
@@ -676,41 +720,49 @@ func handleAnswer(c tele.Context) error {
 	}
 	status.Buttons = newButtons
 
-	db.Update(kvID, status)
+	if err := db.Update(kvID, status); err != nil {
+		logging.Warn("failed_to_persist_captcha_progress", "chat_id", groupChat.ID, "user_id", c.Sender().ID, "err", err)
+	}
 
-	updateBtn := captchaMarkupFromButtons(newButtons)
+	updateBtn := captchaMarkupFromButtons(newButtons, currentConfig().Captcha.ButtonsPerRow)
 	if len(newButtons) == 0 {
-		log.Printf("warn: no captcha buttons available for update chat_id=%d user_id=%d", c.Chat().ID, c.Sender().ID)
+		logging.Warn("no_captcha_buttons_available_for_update", "chat_id", groupChat.ID, "user_id", c.Sender().ID)
 		return nil
 	}
 	if _, err := bot.Edit(c.Callback(), updateBtn); err != nil {
-		log.Printf("warn: failed to update captcha keyboard chat_id=%d user_id=%d err=%v", c.Chat().ID, c.Sender().ID, err)
+		logging.Warn("failed_to_update_captcha_keyboard", "chat_id", groupChat.ID, "user_id", c.Sender().ID, "err", err)
 	}
 
-	if status.SolvedCaptcha >= len(status.CaptchaAnswer) {
-		db.Delete(kvID)
-		c.Respond(&tele.CallbackResponse{Text: captchaSuccessCallbackText(status), ShowAlert: true})
+	if status.IsSolved() {
+		if err := db.Delete(kvID); err != nil {
+			logging.Warn("failed_to_delete_solved_captcha_state", "chat_id", groupChat.ID, "user_id", c.Sender().ID, "err", err)
+		}
+		recordChallengeCompleted(status, resultSolved, time.Now())
+		record := statusRecord(modlogSolved, status)
+		if !status.IssuedAt.IsZero() {
+			record.solveTime = time.Since(status.IssuedAt)
+		}
+		postModerationRecord(record)
+		c.Respond(&tele.CallbackResponse{Text: captchaSuccessCallbackText(msgs, status), ShowAlert: true})
 		if status.CaptchaMessage.ID > 0 {
 			if err := bot.Delete(&status.CaptchaMessage); err != nil {
-				log.Printf("warn: failed to delete solved captcha message chat_id=%d user_id=%d err=%v", c.Chat().ID, c.Sender().ID, err)
+				logging.Warn("failed_to_delete_solved_captcha_message", "chat_id", groupChat.ID, "user_id", c.Sender().ID, "err", err)
 			}
 		}
 
 		if status.ManualChallenge {
-			log.Printf("Manual captcha solved chat_id=%d user_id=%d solved=%d failed=%d", c.Chat().ID, c.Sender().ID, status.SolvedCaptcha, status.FailCaptcha)
+			logging.Info("manual_captcha_solved", "chat_id", groupChat.ID, "user_id", c.Sender().ID, "solved", status.SolvedCaptcha, "failed", status.FailCaptcha)
 			return nil
 		}
 
-		chatMember, err := bot.ChatMemberOf(c.Chat(), c.Sender())
-		if err != nil {
-			log.Printf("warn: failed to load member state for unrestrict chat_id=%d user_id=%d err=%v", c.Chat().ID, c.Sender().ID, err)
+		if status.JoinRequest {
+			resolveJoinRequest(status, true, "solved")
+			logging.Info("join_request_captcha_solved", "chat_id", groupChat.ID, "user_id", c.Sender().ID, "solved", status.SolvedCaptcha, "failed", status.FailCaptcha)
 			return nil
 		}
-		chatMember.Rights = tele.NoRestrictions()
-		if err := bot.Restrict(c.Chat(), chatMember); err != nil {
-			log.Printf("warn: failed to restore user permissions chat_id=%d user_id=%d err=%v", c.Chat().ID, c.Sender().ID, err)
-		}
-		log.Printf("Captcha solved chat_id=%d user_id=%d solved=%d failed=%d", c.Chat().ID, c.Sender().ID, status.SolvedCaptcha, status.FailCaptcha)
+
+		releaseCaptchaRestriction(groupChat, c.Sender())
+		logging.Info("captcha_solved", "chat_id", groupChat.ID, "user_id", c.Sender().ID, "solved", status.SolvedCaptcha, "failed", status.FailCaptcha)
 
 		return nil
 	}
@@ -718,70 +770,125 @@ func handleAnswer(c tele.Context) error {
 	return nil
 }
 
-func buildCaptchaChallenge(answerCount, decoyCount int) (captchaChallenge, error) {
-	challengeCount := answerCount + decoyCount
-	if challengeCount <= 0 || answerCount <= 0 {
-		return captchaChallenge{}, fmt.Errorf("invalid captcha challenge size answer_count=%d decoy_count=%d", answerCount, decoyCount)
+// captchaNoticeChat returns the chat failure notices and actions for status
+// go to: the chat of the challenge message, or groupChat when the challenge
+// was shown in a private chat.
+func captchaNoticeChat(status captcha.JoinStatus, groupChat *tele.Chat) *tele.Chat {
+	targetChat := status.CaptchaMessage.Chat
+	if targetChat == nil || status.IsPrivate() {
+		targetChat = groupChat
 	}
+	return targetChat
+}
 
-	emojiKeys := make([]string, 0, len(captcha.Emojis))
-	for key := range captcha.Emojis {
-		emojiKeys = append(emojiKeys, key)
+// failCaptchaChallenge ends the challenge stored under kvID as failed. The
+// challenge and its message are removed, a join request is declined, and
+// otherwise the failure action is applied and the failure notice posted.
+// reason names the trigger, e.g. failure; actor is the admin who rejected
+// the user, if any.
+func failCaptchaChallenge(kvID string, status captcha.JoinStatus, groupChat *tele.Chat, reason string, actor *tele.User) {
+	if err := db.Delete(kvID); err != nil {
+		logging.Warn("failed_to_delete_failed_captcha_state", "chat_id", groupChat.ID, "user_id", status.UserID, "err", err)
+	}
+	recordChallengeCompleted(status, resultFailed, time.Now())
+	targetChat := captchaNoticeChat(status, groupChat)
+
+	if status.CaptchaMessage.ID > 0 {
+		if err := bot.Delete(&status.CaptchaMessage); err != nil {
+			logging.Warn("failed_to_delete_failed_captcha_message", "chat_id", groupChat.ID, "user_id", status.UserID, "err", err)
+		}
 	}
-	if len(emojiKeys) < challengeCount {
-		return captchaChallenge{}, fmt.Errorf(
-			"insufficient emoji pool available=%d required=%d",
-			len(emojiKeys),
-			challengeCount,
-		)
+
+	record := statusRecord(modlogFailed, status)
+	if actor != nil {
+		record.event = modlogRejected
+		record.actorID, record.actorName = actor.ID, userDisplayName(actor)
 	}
 
-	rand.Shuffle(len(emojiKeys), func(i, j int) {
-		emojiKeys[i], emojiKeys[j] = emojiKeys[j], emojiKeys[i]
-	})
+	if status.JoinRequest {
+		resolveJoinRequest(status, false, reason)
+		sendJoinRequestDeclinedNotice(status, false)
+		postModerationRecord(record)
+		logging.Info("join_request_captcha_failed", "chat_id", groupChat.ID, "user_id", status.UserID, "solved", status.SolvedCaptcha, "failed", status.FailCaptcha, "trigger", reason)
+		return
+	}
 
-	answerKeys := append([]string(nil), emojiKeys[:answerCount]...)
-	challengeKeys := append([]string(nil), emojiKeys[:challengeCount]...)
-	rand.Shuffle(len(challengeKeys), func(i, j int) {
-		challengeKeys[i], challengeKeys[j] = challengeKeys[j], challengeKeys[i]
-	})
+	action := captchaFailureAction(status, targetChat)
+	if status.ManualChallenge {
+		sendCaptchaFailureNotice(status, targetChat, action)
+		postModerationRecord(record)
+		logging.Info("manual_captcha_failed", "chat_id", groupChat.ID, "user_id", status.UserID, "solved", status.SolvedCaptcha, "failed", status.FailCaptcha, "trigger", reason)
+		return
+	}
 
-	imgBytes, err := renderCaptchaImage(answerKeys)
+	record.action = action
+	record.actionErr = enforceCaptchaAction(targetChat, status.UserID, action, reason)
+	sendCaptchaFailureNotice(status, targetChat, action)
+	postModerationRecord(record)
+	logging.Info("captcha_failed", "chat_id", groupChat.ID, "user_id", status.UserID, "solved", status.SolvedCaptcha, "failed", status.FailCaptcha, "action", action.Action, "trigger", reason)
+}
+
+func buildCaptchaChallenge(kind string, config settings.CaptchaConfig) (captchaChallenge, error) {
+	challenge, err := captcha.Lookup(kind)
 	if err != nil {
-		return captchaChallenge{}, fmt.Errorf("render captcha image: %w", err)
+		return captchaChallenge{}, err
 	}
 
-	buttons := make([]tele.InlineButton, 0, len(challengeKeys))
-	for _, key := range challengeKeys {
-		emoji := captcha.Emojis[key]
-		buttons = append(buttons, tele.InlineButton{Text: emoji, Unique: key})
+	puzzle, err := challenge.Generate(captcha.Options{AnswerCount: config.AnswerCount, DecoyCount: config.DecoyCount})
+	if err != nil {
+		return captchaChallenge{}, err
+	}
+
+	imgBytes, err := challenge.Render(puzzle, captchaImageOptions(config.Image))
+	if err != nil {
+		return captchaChallenge{}, fmt.Errorf("render captcha image: %w", err)
 	}
 
 	return captchaChallenge{
-		AnswerKeys: answerKeys,
-		Buttons:    buttons,
-		Markup:     captchaMarkupFromButtons(buttons),
+		Type:       challenge.Type(),
+		AnswerKeys: puzzle.AnswerKeys,
+		Buttons:    puzzle.Buttons,
+		Markup:     captchaMarkupFromButtons(puzzle.Buttons, config.ButtonsPerRow),
 		ImageBytes: imgBytes,
 	}, nil
 }
 
-func captchaMarkupFromButtons(buttons []tele.InlineButton) *tele.ReplyMarkup {
+func captchaImageOptions(config settings.CaptchaImageConfig) captcha.ImageOptions {
+	return captcha.ImageOptions{
+		Scale:          config.Scale,
+		Jitter:         config.Jitter,
+		HueShift:       config.HueShift,
+		NoiseLines:     config.NoiseLines,
+		NoiseDots:      config.NoiseDots,
+		BackgroundCrop: config.BackgroundCrop,
+	}
+}
+
+// buildCaptchaChallengeForChat returns a challenge of the type configured
+// for chat, preferring a pre-rendered one from the pool.
+func buildCaptchaChallengeForChat(chat *tele.Chat) (captchaChallenge, error) {
+	kind := challengeTypeForChat(chat)
+	if challenge, ok := currentChallengePool().take(kind); ok {
+		return challenge, nil
+	}
+	return buildCaptchaChallenge(kind, currentConfig().Captcha)
+}
+
+func captchaMarkupFromButtons(buttons []tele.InlineButton, perRow int) *tele.ReplyMarkup {
 	markup := &tele.ReplyMarkup{
 		Selective:      true,
 		InlineKeyboard: [][]tele.InlineButton{},
 	}
-	if len(buttons) == 0 {
-		return markup
+	if perRow <= 0 {
+		perRow = len(buttons)
 	}
-	if len(buttons) <= 5 {
-		markup.InlineKeyboard = append(markup.InlineKeyboard, append([]tele.InlineButton(nil), buttons...))
-		return markup
+	for start := 0; start < len(buttons); start += perRow {
+		end := start + perRow
+		if end > len(buttons) {
+			end = len(buttons)
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, append([]tele.InlineButton(nil), buttons[start:end]...))
 	}
-	markup.InlineKeyboard = append(
-		markup.InlineKeyboard,
-		append([]tele.InlineButton(nil), buttons[:5]...),
-		append([]tele.InlineButton(nil), buttons[5:]...),
-	)
 	return markup
 }
 
@@ -794,85 +901,58 @@ func applyCaptchaChallenge(status *captcha.JoinStatus, challenge captchaChalleng
 		status.CaptchaAnswer = append(status.CaptchaAnswer, strings.TrimSpace(key))
 	}
 	status.SolvedCaptcha = 0
+	status.ChallengeType = challenge.Type
 	status.CaptchaMessage = message
 	status.Buttons = append([]tele.InlineButton(nil), challenge.Buttons...)
 }
 
-func renderCaptchaImage(answerKeys []string) ([]byte, error) {
-	bgImg, err := assetstore.LoadBackground()
-	if err != nil {
-		return nil, fmt.Errorf("load background asset: %w", err)
-	}
-
-	captchaGrids := make([]*gim.Grid, 0, len(answerKeys))
-	for i, key := range answerKeys {
-		emojiImg, err := assetstore.LoadEmojiByKey(key)
-		if err != nil {
-			return nil, fmt.Errorf("load emoji asset key=%s: %w", key, err)
-		}
-
-		x := 10
-		if i > 0 {
-			x = i * 100
-		}
-		captchaGrids = append(captchaGrids, &gim.Grid{
-			Image:   emojiImg,
-			OffsetX: x,
-			OffsetY: 120,
-			Rotate:  float64(rand.Intn(200)),
-		})
-	}
-
-	grids := []*gim.Grid{
-		{
-			Image: bgImg,
-			Grids: captchaGrids,
-		},
+func releaseCaptchaRestriction(chat *tele.Chat, user *tele.User) {
+	if chat == nil || user == nil {
+		return
 	}
-
-	rgba, err := gim.New(grids, 1, 1).Merge()
+	chatMember, err := bot.ChatMemberOf(chat, user)
 	if err != nil {
-		return nil, fmt.Errorf("merge captcha layers: %w", err)
+		logging.Warn("failed_to_load_member_state_for_unrestrict", "chat_id", chat.ID, "user_id", user.ID, "err", err)
+		return
 	}
-
-	var img bytes.Buffer
-	if err := jpeg.Encode(&img, rgba, &jpeg.Options{Quality: 100}); err != nil {
-		return nil, fmt.Errorf("encode captcha image: %w", err)
+	chatMember.Rights = tele.NoRestrictions()
+	if err := restrictMember(chat, chatMember); err != nil {
+		logging.Warn("failed_to_restore_user_permissions", "chat_id", chat.ID, "user_id", user.ID, "err", err)
 	}
-
-	return img.Bytes(), nil
 }
 
-func isNextCaptchaAnswer(status captcha.JoinStatus, answer string) (bool, string) {
-	if status.SolvedCaptcha < 0 || status.SolvedCaptcha >= len(status.CaptchaAnswer) {
-		return false, ""
+func onEvicted(key string, val captcha.JoinStatus) {
+	logging.Info("captcha_expired", "chat_id", val.ChatID, "user_id", val.UserID)
+	recordChallengeCompleted(val, resultTimeout, time.Now())
+	targetChat := captchaGroupChat(val)
+	if val.CaptchaMessage.ID > 0 {
+		if err := bot.Delete(&val.CaptchaMessage); err != nil {
+			logging.Warn("failed_to_delete_expired_captcha_message", "chat_id", val.ChatID, "user_id", val.UserID, "err", err)
+		}
 	}
-	expected := strings.TrimSpace(status.CaptchaAnswer[status.SolvedCaptcha])
-	return answer == expected, expected
-}
 
-func onEvicted(key string, value interface{}) {
-	if val, ok := value.(captcha.JoinStatus); ok {
-		log.Printf("Captcha expired chat_id=%d user_id=%d", val.ChatID, val.UserID)
-		targetChat := val.CaptchaMessage.Chat
-		if targetChat == nil {
-			targetChat = &tele.Chat{ID: val.ChatID}
-		}
-		if val.CaptchaMessage.ID > 0 {
-			if err := bot.Delete(&val.CaptchaMessage); err != nil {
-				log.Printf("warn: failed to delete expired captcha message chat_id=%d user_id=%d err=%v", val.ChatID, val.UserID, err)
-			}
-		}
+	if val.JoinRequest {
+		resolveJoinRequest(val, false, "timeout")
+		sendJoinRequestDeclinedNotice(val, true)
+		postModerationRecord(statusRecord(modlogTimeout, val))
+		return
+	}
 
-		if !shouldBanOnCaptchaFailure(val) {
-			sendCaptchaTimeoutNotice(val, targetChat)
-			log.Printf("Manual captcha expired chat_id=%d user_id=%d", val.ChatID, val.UserID)
-			return
-		}
+	if val.ManualChallenge {
+		sendCaptchaTimeoutNotice(val, targetChat)
+		postModerationRecord(statusRecord(modlogTimeout, val))
+		logging.Info("manual_captcha_expired", "chat_id", val.ChatID, "user_id", val.UserID)
+		return
+	}
 
-		sendCaptchaFailureNotice(val, targetChat, true)
-		if err := bot.Ban(targetChat, &tele.ChatMember{User: &tele.User{ID: val.UserID}}, false); err != nil {
-			log.Printf("warn: failed to ban user after captcha expiry chat_id=%d user_id=%d err=%v", val.ChatID, val.UserID, err)
-		}
+	action := captchaTimeoutAction(val, targetChat)
+	if action.Action == settings.CaptchaActionNone {
+		sendCaptchaTimeoutNotice(val, targetChat)
+	} else {
+		sendCaptchaFailureNotice(val, targetChat, action)
 	}
+	record := statusRecord(modlogTimeout, val)
+	record.action = action
+	record.actionErr = enforceCaptchaAction(targetChat, val.UserID, action, "timeout")
+	postModerationRecord(record)
 }
@@ -10,96 +10,10 @@ import (
 
 	tele "gopkg.in/telebot.v3"
 	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/i18n"
+	"toshiki-captcha-bot/internal/settings"
 )
 
-func TestIsNextCaptchaAnswer(t *testing.T) {
-	t.Parallel()
-
-	tests := []struct {
-		name         string
-		status       captcha.JoinStatus
-		answer       string
-		wantOK       bool
-		wantExpected string
-	}{
-		{
-			name: "first step correct",
-			status: captcha.JoinStatus{
-				CaptchaAnswer: []string{"u1", "u2", "u3", "u4"},
-				SolvedCaptcha: 0,
-			},
-			answer:       "u1",
-			wantOK:       true,
-			wantExpected: "u1",
-		},
-		{
-			name: "first step wrong",
-			status: captcha.JoinStatus{
-				CaptchaAnswer: []string{"u1", "u2", "u3", "u4"},
-				SolvedCaptcha: 0,
-			},
-			answer:       "u2",
-			wantOK:       false,
-			wantExpected: "u1",
-		},
-		{
-			name: "duplicate previous tap is wrong",
-			status: captcha.JoinStatus{
-				CaptchaAnswer: []string{"u1", "u2", "u3", "u4"},
-				SolvedCaptcha: 1,
-			},
-			answer:       "u1",
-			wantOK:       false,
-			wantExpected: "u2",
-		},
-		{
-			name: "next step correct",
-			status: captcha.JoinStatus{
-				CaptchaAnswer: []string{"u1", "u2", "u3", "u4"},
-				SolvedCaptcha: 2,
-			},
-			answer:       "u3",
-			wantOK:       true,
-			wantExpected: "u3",
-		},
-		{
-			name: "out of range solved index",
-			status: captcha.JoinStatus{
-				CaptchaAnswer: []string{"u1", "u2", "u3", "u4"},
-				SolvedCaptcha: 4,
-			},
-			answer:       "u4",
-			wantOK:       false,
-			wantExpected: "",
-		},
-		{
-			name: "empty answers",
-			status: captcha.JoinStatus{
-				CaptchaAnswer: []string{},
-				SolvedCaptcha: 0,
-			},
-			answer:       "u1",
-			wantOK:       false,
-			wantExpected: "",
-		},
-	}
-
-	for _, tt := range tests {
-		tt := tt
-		t.Run(tt.name, func(t *testing.T) {
-			t.Parallel()
-
-			gotOK, gotExpected := isNextCaptchaAnswer(tt.status, tt.answer)
-			if gotOK != tt.wantOK {
-				t.Fatalf("ok = %v, want %v", gotOK, tt.wantOK)
-			}
-			if gotExpected != tt.wantExpected {
-				t.Fatalf("expected = %q, want %q", gotExpected, tt.wantExpected)
-			}
-		})
-	}
-}
-
 type mockAdminCommandResponder struct {
 	chat      *tele.Chat
 	sender    *tele.User
@@ -176,25 +90,16 @@ func TestRespondAdminOnlyCommandDenied(t *testing.T) {
 	})
 }
 
-func TestRenderCaptchaImageWithMissingAsset(t *testing.T) {
-	t.Parallel()
-
-	_, err := renderCaptchaImage([]string{"does_not_exist"})
-	if err == nil {
-		t.Fatalf("renderCaptchaImage expected error for missing asset key")
-	}
-	if !strings.Contains(err.Error(), "load emoji asset key=does_not_exist") {
-		t.Fatalf("renderCaptchaImage error = %q, want emoji-asset load error", err.Error())
-	}
-}
-
 func TestBuildCaptchaChallenge(t *testing.T) {
 	t.Parallel()
 
-	challenge, err := buildCaptchaChallenge(4, 6)
+	challenge, err := buildCaptchaChallenge(captcha.TypeEmojiSequence, settings.DefaultRuntimeConfig().Captcha)
 	if err != nil {
 		t.Fatalf("buildCaptchaChallenge returned error: %v", err)
 	}
+	if challenge.Type != captcha.TypeEmojiSequence {
+		t.Fatalf("challenge type = %q, want %q", challenge.Type, captcha.TypeEmojiSequence)
+	}
 
 	if len(challenge.AnswerKeys) != 4 {
 		t.Fatalf("answer key count = %d, want 4", len(challenge.AnswerKeys))
@@ -223,6 +128,24 @@ func TestBuildCaptchaChallenge(t *testing.T) {
 	}
 }
 
+func TestCaptchaImageOptions(t *testing.T) {
+	t.Parallel()
+
+	got := captchaImageOptions(settings.CaptchaImageConfig{Jitter: true, NoiseDots: true})
+	want := captcha.ImageOptions{Jitter: true, NoiseDots: true}
+	if got != want {
+		t.Fatalf("captchaImageOptions() = %+v, want %+v", got, want)
+	}
+}
+
+func TestBuildCaptchaChallengeRejectsUnknownType(t *testing.T) {
+	t.Parallel()
+
+	if _, err := buildCaptchaChallenge("crossword", settings.DefaultRuntimeConfig().Captcha); err == nil {
+		t.Fatalf("buildCaptchaChallenge expected error for unknown type")
+	}
+}
+
 func TestApplyCaptchaChallenge(t *testing.T) {
 	t.Parallel()
 
@@ -231,6 +154,7 @@ func TestApplyCaptchaChallenge(t *testing.T) {
 		FailCaptcha:   2,
 	}
 	challenge := captchaChallenge{
+		Type:       captcha.TypeOddOneOut,
 		AnswerKeys: []string{"u1", "u2", "u3", "u4"},
 		Buttons: []tele.InlineButton{
 			{Text: "A", Unique: "u1"},
@@ -256,6 +180,9 @@ func TestApplyCaptchaChallenge(t *testing.T) {
 	if len(status.Buttons) != 2 {
 		t.Fatalf("button count = %d, want 2", len(status.Buttons))
 	}
+	if status.ChallengeType != captcha.TypeOddOneOut {
+		t.Fatalf("challenge type = %q, want %q", status.ChallengeType, captcha.TypeOddOneOut)
+	}
 
 	challenge.Buttons[0].Text = "mutated"
 	if status.Buttons[0].Text == "mutated" {
@@ -276,7 +203,7 @@ func TestCaptchaMarkupFromButtons(t *testing.T) {
 			{Unique: "u4"},
 			{Unique: "u5"},
 		}
-		markup := captchaMarkupFromButtons(buttons)
+		markup := captchaMarkupFromButtons(buttons, 5)
 
 		if len(markup.InlineKeyboard) != 1 {
 			t.Fatalf("rows = %d, want 1", len(markup.InlineKeyboard))
@@ -298,7 +225,7 @@ func TestCaptchaMarkupFromButtons(t *testing.T) {
 			{Unique: "u6"},
 			{Unique: "u7"},
 		}
-		markup := captchaMarkupFromButtons(buttons)
+		markup := captchaMarkupFromButtons(buttons, 5)
 
 		if len(markup.InlineKeyboard) != 2 {
 			t.Fatalf("rows = %d, want 2", len(markup.InlineKeyboard))
@@ -310,6 +237,29 @@ func TestCaptchaMarkupFromButtons(t *testing.T) {
 			t.Fatalf("row1 size = %d, want 2", len(markup.InlineKeyboard[1]))
 		}
 	})
+
+	t.Run("configured row width", func(t *testing.T) {
+		t.Parallel()
+
+		buttons := make([]tele.InlineButton, 10)
+		for i := range buttons {
+			buttons[i] = tele.InlineButton{Unique: fmt.Sprintf("u%d", i)}
+		}
+		markup := captchaMarkupFromButtons(buttons, 3)
+
+		wantRows := []int{3, 3, 3, 1}
+		if len(markup.InlineKeyboard) != len(wantRows) {
+			t.Fatalf("rows = %d, want %d", len(markup.InlineKeyboard), len(wantRows))
+		}
+		for i, want := range wantRows {
+			if got := len(markup.InlineKeyboard[i]); got != want {
+				t.Fatalf("row%d size = %d, want %d", i, got, want)
+			}
+		}
+		if markup.InlineKeyboard[3][0].Unique != "u9" {
+			t.Fatalf("last button = %q, want u9", markup.InlineKeyboard[3][0].Unique)
+		}
+	})
 }
 
 type timeoutErr struct{}
@@ -434,6 +384,7 @@ func TestNewJoinStatus(t *testing.T) {
 	}
 	chat := &tele.Chat{ID: -100123}
 	challenge := captchaChallenge{
+		Type:       captcha.TypeOddOneOut,
 		AnswerKeys: []string{"u1", "u2", "u3", "u4"},
 		Buttons: []tele.InlineButton{
 			{Unique: "u1"},
@@ -466,17 +417,6 @@ func TestNewJoinStatus(t *testing.T) {
 	}
 }
 
-func TestShouldBanOnCaptchaFailure(t *testing.T) {
-	t.Parallel()
-
-	if got := shouldBanOnCaptchaFailure(captcha.JoinStatus{}); !got {
-		t.Fatalf("shouldBanOnCaptchaFailure(non-manual) = %t, want true", got)
-	}
-	if got := shouldBanOnCaptchaFailure(captcha.JoinStatus{ManualChallenge: true}); got {
-		t.Fatalf("shouldBanOnCaptchaFailure(manual) = %t, want false", got)
-	}
-}
-
 func TestCaptchaFailureNoticeText(t *testing.T) {
 	t.Parallel()
 
@@ -485,7 +425,7 @@ func TestCaptchaFailureNoticeText(t *testing.T) {
 		UserFullName: "Alice",
 	}
 
-	bannedText := captchaFailureNoticeText(status, true, 15*time.Second)
+	bannedText := captchaFailureNoticeText(i18n.For("en"), status, settings.CaptchaAction{Action: settings.CaptchaActionBan}, 15*time.Second)
 	if !strings.Contains(bannedText, "has been banned") {
 		t.Fatalf("banned notice missing ban statement: %q", bannedText)
 	}
@@ -493,7 +433,7 @@ func TestCaptchaFailureNoticeText(t *testing.T) {
 		t.Fatalf("banned notice missing ttl text: %q", bannedText)
 	}
 
-	manualText := captchaFailureNoticeText(status, false, 15*time.Second)
+	manualText := captchaFailureNoticeText(i18n.For("en"), status, settings.CaptchaAction{Action: settings.CaptchaActionNone}, 15*time.Second)
 	if !strings.Contains(manualText, "[Alice](tg://user?id=42) captcha failed.") {
 		t.Fatalf("manual notice missing failure statement: %q", manualText)
 	}
@@ -505,12 +445,12 @@ func TestCaptchaFailureNoticeText(t *testing.T) {
 func TestCaptchaSuccessCallbackText(t *testing.T) {
 	t.Parallel()
 
-	normalText := captchaSuccessCallbackText(captcha.JoinStatus{})
+	normalText := captchaSuccessCallbackText(i18n.For("en"), captcha.JoinStatus{})
 	if normalText != "Successfully joined." {
 		t.Fatalf("normal success text = %q, want %q", normalText, "Successfully joined.")
 	}
 
-	manualText := captchaSuccessCallbackText(captcha.JoinStatus{ManualChallenge: true})
+	manualText := captchaSuccessCallbackText(i18n.For("en"), captcha.JoinStatus{ManualChallenge: true})
 	if manualText != "Manual test captcha completed successfully." {
 		t.Fatalf("manual success text = %q, want %q", manualText, "Manual test captcha completed successfully.")
 	}
@@ -519,7 +459,7 @@ func TestCaptchaSuccessCallbackText(t *testing.T) {
 func TestNotYourCaptchaCallbackResponse(t *testing.T) {
 	t.Parallel()
 
-	resp := notYourCaptchaCallbackResponse()
+	resp := notYourCaptchaCallbackResponse(i18n.For("en"))
 	if resp == nil {
 		t.Fatalf("notYourCaptchaCallbackResponse returned nil")
 	}
@@ -539,7 +479,7 @@ func TestCaptchaTimeoutNoticeText(t *testing.T) {
 		UserFullName: "Alice",
 	}
 
-	timeoutText := captchaTimeoutNoticeText(status)
+	timeoutText := captchaTimeoutNoticeText(i18n.For("en"), status)
 	if !strings.Contains(timeoutText, "[Alice](tg://user?id=42)") {
 		t.Fatalf("timeout notice missing mention: %q", timeoutText)
 	}
@@ -598,3 +538,47 @@ func TestResolveTestCaptchaTargetFromReply(t *testing.T) {
 		}
 	})
 }
+
+// BenchmarkBuildCaptchaChallenge measures the per-join cost of rendering a
+// challenge on demand from the decoded asset cache.
+func BenchmarkBuildCaptchaChallenge(b *testing.B) {
+	config := settings.DefaultRuntimeConfig().Captcha
+	for _, kind := range captcha.Types() {
+		kind := kind
+		b.Run(kind, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := buildCaptchaChallenge(kind, config); err != nil {
+					b.Fatalf("buildCaptchaChallenge returned error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkBuildCaptchaChallengeFromPool measures the per-join cost when the
+// pre-render worker has a challenge ready.
+func BenchmarkBuildCaptchaChallengeFromPool(b *testing.B) {
+	config := settings.DefaultRuntimeConfig().Captcha
+	const poolSize = 32
+	for _, kind := range captcha.Types() {
+		kind := kind
+		b.Run(kind, func(b *testing.B) {
+			pool := newChallengePool([]string{kind}, poolSize, func(kind string) (captchaChallenge, error) {
+				return buildCaptchaChallenge(kind, config)
+			})
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if len(pool.ready[kind]) == 0 {
+					b.StopTimer()
+					pool.fill(nil)
+					b.StartTimer()
+				}
+				if _, ok := pool.take(kind); !ok {
+					b.Fatalf("take returned no challenge")
+				}
+			}
+		})
+	}
+}
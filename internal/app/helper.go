@@ -3,19 +3,44 @@ package app
 import (
 	"fmt"
 	"strings"
-	"time"
 
 	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/i18n"
 	"toshiki-captcha-bot/internal/settings"
 )
 
-func genCaption(user *tele.User) string {
-	desc := fmt.Sprintf(
-		"Select all the emoji you see in the picture in exact left-to-right order."+
-			"\n\n Max failure: %d mistake \n Duration: %s"+
-			"\n\n Please leave group immediately if you are not ready with the bot",
-		cfg.Captcha.MaxFailures,
-		humanizeDuration(cfg.Captcha.Expiration),
+func genCaption(user *tele.User, kind string, policy settings.ChatPolicy) string {
+	msgs := messagesFor(policy)
+	return genCaptionWithClosing(user, kind, policy, msgs.Text(i18n.CaptionClosingGroup))
+}
+
+// genJoinRequestCaption builds the caption for a challenge sent to the
+// private chat of a user asking to join the group with groupUsername.
+func genJoinRequestCaption(user *tele.User, kind string, policy settings.ChatPolicy, groupUsername string) string {
+	msgs := messagesFor(policy)
+	closing := msgs.Text(i18n.CaptionClosingJoinRequest, joinRequestGroupName(msgs, groupUsername))
+	return genCaptionWithClosing(user, kind, policy, closing)
+}
+
+// genCaptionForStatus picks the caption matching where status is delivered,
+// using the policy of the group the challenge belongs to.
+func genCaptionForStatus(user *tele.User, kind string, status captcha.JoinStatus) string {
+	policy := policyForChat(captchaGroupChat(status))
+	if status.JoinRequest {
+		return genJoinRequestCaption(user, kind, policy, status.ChatUsername)
+	}
+	return genCaption(user, kind, policy)
+}
+
+func genCaptionWithClosing(user *tele.User, kind string, policy settings.ChatPolicy, closing string) string {
+	msgs := messagesFor(policy)
+	desc := msgs.Text(
+		i18n.CaptionBody,
+		challengeInstruction(msgs, kind),
+		policy.MaxFailures,
+		msgs.Duration(policy.Expiration),
+		closing,
 	)
 
 	if user == nil {
@@ -33,6 +58,41 @@ func genCaption(user *tele.User) string {
 	return caption
 }
 
+// challengeInstruction returns the instruction for kind in the language of
+// msgs. Unknown kinds use the default challenge's instruction.
+func challengeInstruction(msgs i18n.Messages, kind string) string {
+	challenge, err := captcha.Lookup(kind)
+	if err != nil {
+		challenge, _ = captcha.Lookup(captcha.DefaultType)
+	}
+	return msgs.Text(i18n.InstructionKey(challenge.Type()))
+}
+
+// policyForChat returns the captcha policy in effect for chat.
+func policyForChat(chat *tele.Chat) settings.ChatPolicy {
+	return resolvePolicyForChat(chat, currentConfig())
+}
+
+func resolvePolicyForChat(chat *tele.Chat, config settings.RuntimeConfig) settings.ChatPolicy {
+	if chat == nil {
+		return config.PolicyForChat(0, "")
+	}
+	return config.PolicyForChat(chat.ID, chat.Username)
+}
+
+// messagesFor returns the member-facing texts in the language of policy.
+func messagesFor(policy settings.ChatPolicy) i18n.Messages {
+	return i18n.For(policy.Language)
+}
+
+func challengeTypeForChat(chat *tele.Chat) string {
+	return resolveChallengeTypeForChat(chat, currentConfig())
+}
+
+func resolveChallengeTypeForChat(chat *tele.Chat, config settings.RuntimeConfig) string {
+	return resolvePolicyForChat(chat, config).Challenge
+}
+
 func escapeTelegramMarkdown(text string) string {
 	replacer := strings.NewReplacer(
 		"\\", "\\\\",
@@ -45,34 +105,6 @@ func escapeTelegramMarkdown(text string) string {
 	return replacer.Replace(text)
 }
 
-func humanizeDuration(d time.Duration) string {
-	if d%time.Hour == 0 && d >= time.Hour {
-		hours := int(d / time.Hour)
-		if hours == 1 {
-			return "1 hour"
-		}
-		return fmt.Sprintf("%d hours", hours)
-	}
-
-	if d%time.Minute == 0 && d >= time.Minute {
-		minutes := int(d / time.Minute)
-		if minutes == 1 {
-			return "1 minute"
-		}
-		return fmt.Sprintf("%d minutes", minutes)
-	}
-
-	if d%time.Second == 0 {
-		seconds := int(d / time.Second)
-		if seconds == 1 {
-			return "1 second"
-		}
-		return fmt.Sprintf("%d seconds", seconds)
-	}
-
-	return d.String()
-}
-
 func buildSendOptionsWithTopic(parseMode tele.ParseMode, markup *tele.ReplyMarkup, topicID int) *tele.SendOptions {
 	opts := &tele.SendOptions{
 		ParseMode: parseMode,
@@ -85,7 +117,7 @@ func buildSendOptionsWithTopic(parseMode tele.ParseMode, markup *tele.ReplyMarku
 }
 
 func topicThreadIDForChat(chat *tele.Chat) int {
-	return resolveTopicThreadIDForChat(chat, cfg)
+	return resolveTopicThreadIDForChat(chat, currentConfig())
 }
 
 func resolveTopicThreadIDForChat(chat *tele.Chat, config settings.RuntimeConfig) int {
@@ -94,7 +126,7 @@ func resolveTopicThreadIDForChat(chat *tele.Chat, config settings.RuntimeConfig)
 	}
 
 	// Public mode discards all groups topic configuration by design.
-	return config.TopicForChatUsername(chat.Username)
+	return config.TopicForChat(chat.ID, chat.Username)
 }
 
 func sendWithConfiguredTopic(chat *tele.Chat, what interface{}, parseMode tele.ParseMode, markup *tele.ReplyMarkup) (*tele.Message, error) {
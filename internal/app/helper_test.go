@@ -3,8 +3,11 @@ package app
 import (
 	"strings"
 	"testing"
+	"time"
 
 	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/i18n"
 	"toshiki-captcha-bot/internal/settings"
 )
 
@@ -138,6 +141,64 @@ func TestTopicThreadIDForChat(t *testing.T) {
 	}
 }
 
+func TestChallengeTypeForChat(t *testing.T) {
+	t.Parallel()
+
+	privateCfg := func(t *testing.T) settings.RuntimeConfig {
+		cfg := settings.DefaultRuntimeConfig()
+		cfg.Bot.AdminUserIDs = []int64{1001}
+		cfg.Captcha.Challenge = captcha.TypeArithmetic
+		cfg.Groups = []settings.GroupTopicConfig{
+			{ID: "@somegroup", Challenge: captcha.TypeOddOneOut},
+			{ID: "@othergroup"},
+		}
+		return mustValidatedRuntimeConfig(t, cfg)
+	}(t)
+
+	tests := []struct {
+		name     string
+		cfg      settings.RuntimeConfig
+		chat     *tele.Chat
+		wantType string
+	}{
+		{
+			name:     "nil chat uses global type",
+			cfg:      privateCfg,
+			chat:     nil,
+			wantType: captcha.TypeArithmetic,
+		},
+		{
+			name:     "public mode uses default type",
+			cfg:      mustValidatedRuntimeConfig(t, settings.DefaultRuntimeConfig()),
+			chat:     &tele.Chat{Type: tele.ChatSuperGroup, Username: "somegroup"},
+			wantType: captcha.TypeEmojiSequence,
+		},
+		{
+			name:     "group override wins",
+			cfg:      privateCfg,
+			chat:     &tele.Chat{Type: tele.ChatSuperGroup, Username: "SomeGroup"},
+			wantType: captcha.TypeOddOneOut,
+		},
+		{
+			name:     "group without override uses global type",
+			cfg:      privateCfg,
+			chat:     &tele.Chat{Type: tele.ChatSuperGroup, Username: "othergroup"},
+			wantType: captcha.TypeArithmetic,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := resolveChallengeTypeForChat(tt.chat, tt.cfg); got != tt.wantType {
+				t.Fatalf("resolveChallengeTypeForChat() = %q, want %q", got, tt.wantType)
+			}
+		})
+	}
+}
+
 func TestEscapeTelegramMarkdown(t *testing.T) {
 	t.Parallel()
 
@@ -152,18 +213,81 @@ func TestEscapeTelegramMarkdown(t *testing.T) {
 func TestGenCaptionEscapesDisplayName(t *testing.T) {
 	t.Parallel()
 
-	oldCfg := cfg
-	cfg = mustValidatedRuntimeConfig(t, settings.DefaultRuntimeConfig())
-	t.Cleanup(func() {
-		cfg = oldCfg
-	})
+	policy := mustValidatedRuntimeConfig(t, settings.DefaultRuntimeConfig()).PolicyForChatUsername("")
 
 	user := &tele.User{
 		ID:        1234,
 		FirstName: "a_b*[x]",
 	}
-	caption := genCaption(user)
+	caption := genCaption(user, captcha.TypeEmojiSequence, policy)
 	if !strings.Contains(caption, `[a\_b\*\[x\]](tg://user?id=1234)`) {
 		t.Fatalf("caption mention is not escaped correctly: %q", caption)
 	}
 }
+
+func TestGenCaptionDescribesChallengeType(t *testing.T) {
+	t.Parallel()
+
+	policy := mustValidatedRuntimeConfig(t, settings.DefaultRuntimeConfig()).PolicyForChatUsername("")
+
+	msgs := i18n.For(policy.Language)
+
+	for _, kind := range captcha.Types() {
+		key := i18n.InstructionKey(kind)
+		if !msgs.Has(key) {
+			t.Fatalf("%s catalog is missing %s", msgs.Language(), key)
+		}
+		if caption := genCaption(nil, kind, policy); !strings.HasPrefix(caption, msgs.Text(key)) {
+			t.Fatalf("caption for %q = %q, want prefix %q", kind, caption, msgs.Text(key))
+		}
+	}
+}
+
+func TestResolvePolicyForChat(t *testing.T) {
+	t.Parallel()
+
+	config := settings.DefaultRuntimeConfig()
+	config.Bot.AdminUserIDs = []int64{1001}
+	config.Groups = []settings.GroupTopicConfig{
+		{ID: "@strictgroup", Expiration: 3 * time.Minute, MaxFailures: 1, Language: "zh"},
+		{ID: "@othergroup"},
+	}
+	config = mustValidatedRuntimeConfig(t, config)
+
+	strict := resolvePolicyForChat(&tele.Chat{ID: -1, Username: "StrictGroup"}, config)
+	if strict.Expiration != 3*time.Minute || strict.MaxFailures != 1 || strict.Language != "zh" {
+		t.Fatalf("policy for strict group = %+v, want overrides", strict)
+	}
+	if strict.FailureNoticeTTL != config.Captcha.FailureNoticeTTL {
+		t.Fatalf("policy for strict group FailureNoticeTTL = %s, want global %s", strict.FailureNoticeTTL, config.Captcha.FailureNoticeTTL)
+	}
+
+	for _, chat := range []*tele.Chat{nil, {ID: -2, Username: "othergroup"}} {
+		if got := resolvePolicyForChat(chat, config); got != config.PolicyForChatUsername("") {
+			t.Fatalf("policy for %+v = %+v, want global policy", chat, got)
+		}
+	}
+}
+
+func TestGenCaptionUsesChatPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy := mustValidatedRuntimeConfig(t, settings.DefaultRuntimeConfig()).PolicyForChatUsername("")
+	policy.MaxFailures = 5
+	policy.Expiration = 3 * time.Minute
+
+	caption := genCaption(nil, captcha.TypeArithmetic, policy)
+	if !strings.Contains(caption, "Max failure: 5 mistake") || !strings.Contains(caption, "Duration: 3 minutes") {
+		t.Fatalf("caption = %q, want policy limits", caption)
+	}
+
+	policy.Language = "zh"
+	caption = genCaption(nil, captcha.TypeArithmetic, policy)
+	msgs := i18n.For("zh")
+	if !strings.HasPrefix(caption, msgs.Text(i18n.InstructionKey(captcha.TypeArithmetic))) {
+		t.Fatalf("zh caption = %q, want translated instruction", caption)
+	}
+	if !strings.Contains(caption, "5 次") || !strings.Contains(caption, "3 分钟") {
+		t.Fatalf("zh caption = %q, want policy limits", caption)
+	}
+}
@@ -0,0 +1,241 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/challengestore"
+	"toshiki-captcha-bot/internal/i18n"
+	"toshiki-captcha-bot/internal/logging"
+)
+
+// joinApprovalMemoTTL bounds how long an approval is remembered while
+// waiting for the join message Telegram posts after approveChatJoinRequest.
+const joinApprovalMemoTTL = 2 * time.Minute
+
+// approvedJoinRequests remembers users the bot just let in through a join
+// request so the resulting join message does not start a second captcha.
+var approvedJoinRequests = newJoinApprovalMemo(joinApprovalMemoTTL)
+
+type joinApprovalMemo struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	until map[string]time.Time
+}
+
+func newJoinApprovalMemo(ttl time.Duration) *joinApprovalMemo {
+	return &joinApprovalMemo{ttl: ttl, until: make(map[string]time.Time)}
+}
+
+func (m *joinApprovalMemo) add(key string, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune(now)
+	m.until[key] = now.Add(m.ttl)
+}
+
+// consume reports whether key was approved recently and forgets it.
+func (m *joinApprovalMemo) consume(key string, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune(now)
+	if _, ok := m.until[key]; !ok {
+		return false
+	}
+	delete(m.until, key)
+	return true
+}
+
+func (m *joinApprovalMemo) prune(now time.Time) {
+	for key, until := range m.until {
+		if !now.Before(until) {
+			delete(m.until, key)
+		}
+	}
+}
+
+func onJoinRequest(c tele.Context) error {
+	if c == nil || c.ChatJoinRequest() == nil {
+		return nil
+	}
+	request := c.ChatJoinRequest()
+	if request.Chat == nil || request.Sender == nil {
+		logging.Warn("join_request_skipped", "reason", "missing_chat_or_sender")
+		return nil
+	}
+	if leaveIfUnsupportedPrivateGroup(request.Chat, "join_request") {
+		return nil
+	}
+	if !isContextAuthorized(c) {
+		logAccessDenied(c, "join_request")
+		leaveChat(request.Chat, "unauthorized_group")
+		return nil
+	}
+
+	postModerationRecord(moderationRecord{event: modlogJoinRequest, chat: request.Chat, userID: request.Sender.ID, userName: userDisplayName(request.Sender)})
+	return issueJoinRequestChallenge(request)
+}
+
+// issueJoinRequestChallenge sends the captcha for a join request to the
+// applicant's private chat. The request stays pending until the challenge is
+// solved, failed or expires; if the message cannot be delivered it is left
+// for the group admins to decide.
+func issueJoinRequestChallenge(request *tele.ChatJoinRequest) error {
+	group := request.Chat
+	user := request.Sender
+
+	kvID := challengestore.Key(user.ID, group.ID)
+	if _, found := db.Get(kvID); found {
+		logging.Info("captcha_already_pending_for_join_request", "chat_id", group.ID, "user_id", user.ID)
+		return nil
+	}
+
+	policy := policyForChat(group)
+	challenge, err := buildCaptchaChallengeForChat(group)
+	if err != nil {
+		logging.Error("captcha_generation_failed_for_join_request", "chat_id", group.ID, "user_id", user.ID, "err", err)
+		return nil
+	}
+
+	dm := joinRequestPrivateChat(request)
+	caption := genJoinRequestCaption(user, challenge.Type, policy, group.Username)
+	msg, err := sendCaptchaChallenge(dm, challenge.ImageBytes, caption, challenge.Markup)
+	if err != nil && !errors.Is(err, errCaptchaSendTimeout) {
+		logging.Warn("failed_to_send_join_request_captcha", "chat_id", group.ID, "user_id", user.ID, "err", err, "action", "leave_request_pending")
+		return nil
+	}
+
+	message := tele.Message{Chat: dm}
+	if msg != nil {
+		message = *msg
+	}
+	status := newJoinStatus(user, group, challenge, message, false)
+	status.ChatUsername = group.Username
+	status.JoinRequest = true
+	if err := db.Set(kvID, status, policy.Expiration); err != nil {
+		logging.Warn("failed_to_persist_join_request_captcha_state", "chat_id", group.ID, "user_id", user.ID, "err", err)
+	}
+	recordChallengeIssued(status)
+	postChallengeIssuedRecord(status)
+
+	if msg == nil {
+		logging.Warn("join_request_captcha_delivery_uncertain", "chat_id", group.ID, "user_id", user.ID, "challenge_message_id", "unknown", "action", "wait_for_callback")
+		return nil
+	}
+	logging.Info(
+		"join_request_captcha_issued",
+		"chat_id", group.ID,
+		"user_id", user.ID,
+		"private_chat_id", dm.ID,
+		"challenge_message_id", msg.ID,
+		"answer_count", len(status.CaptchaAnswer),
+	)
+	return nil
+}
+
+// joinRequestPrivateChat returns the chat to message the applicant in.
+// Telegram provides user_chat_id for this; older updates fall back to the
+// user ID, which is the same chat.
+func joinRequestPrivateChat(request *tele.ChatJoinRequest) *tele.Chat {
+	chatID := request.UserChatID
+	if chatID == 0 {
+		chatID = request.Sender.ID
+	}
+	return &tele.Chat{ID: chatID, Type: tele.ChatPrivate}
+}
+
+func joinRequestGroupName(msgs i18n.Messages, username string) string {
+	if username == "" {
+		return msgs.Text(i18n.GroupNameFallback)
+	}
+	return "@" + escapeTelegramMarkdown(username)
+}
+
+// captchaGroupChat returns the group a challenge belongs to. Challenges
+// hosted in a private chat only know the group by ID and username.
+func captchaGroupChat(status captcha.JoinStatus) *tele.Chat {
+	if chat := status.CaptchaMessage.Chat; chat != nil && chat.ID == status.ChatID {
+		return chat
+	}
+	return &tele.Chat{ID: status.ChatID, Username: status.ChatUsername}
+}
+
+// findPrivateChallenge looks up the pending challenge a callback from a
+// private chat answers. Challenges are keyed by group, so the record is found
+// by the private chat and, when already known, the challenge message.
+func findPrivateChallenge(userID, chatID int64, messageID int) (string, captcha.JoinStatus, bool) {
+	var (
+		fallbackKey    string
+		fallbackStatus captcha.JoinStatus
+		fallbackFound  bool
+	)
+	for _, record := range db.List() {
+		status := record.Status
+		if status.UserID != userID || !status.IsPrivate() || status.CaptchaMessage.Chat.ID != chatID {
+			continue
+		}
+		if status.CaptchaMessage.ID == messageID {
+			return record.Key, status, true
+		}
+		if status.CaptchaMessage.ID == 0 && !fallbackFound {
+			fallbackKey, fallbackStatus, fallbackFound = record.Key, status, true
+		}
+	}
+	return fallbackKey, fallbackStatus, fallbackFound
+}
+
+// resolveJoinRequest approves or declines the join request behind status.
+// Failures are logged and returned.
+func resolveJoinRequest(status captcha.JoinStatus, approve bool, reason string) error {
+	if bot == nil {
+		logging.Warn("join_request_resolution_skipped", "reason", "bot_not_initialized", "chat_id", status.ChatID, "user_id", status.UserID)
+		return fmt.Errorf("bot not initialized")
+	}
+	return resolveJoinRequestWith(bot, status, approve, reason)
+}
+
+func resolveJoinRequestWith(api memberModerator, status captcha.JoinStatus, approve bool, reason string) error {
+	group := &tele.Chat{ID: status.ChatID}
+	user := &tele.User{ID: status.UserID}
+	if approve {
+		approvedJoinRequests.add(challengestore.Key(status.UserID, status.ChatID), time.Now())
+		if err := api.ApproveJoinRequest(group, user); err != nil {
+			logging.Warn("failed_to_approve_join_request", "chat_id", status.ChatID, "user_id", status.UserID, "reason", reason, "err", err)
+			return fmt.Errorf("approve join request: %w", err)
+		}
+		logging.Info("join_request_approved", "chat_id", status.ChatID, "user_id", status.UserID, "reason", reason)
+		return nil
+	}
+
+	if err := api.DeclineJoinRequest(group, user); err != nil {
+		logging.Warn("failed_to_decline_join_request", "chat_id", status.ChatID, "user_id", status.UserID, "reason", reason, "err", err)
+		return fmt.Errorf("decline join request: %w", err)
+	}
+	logging.Info("join_request_declined", "chat_id", status.ChatID, "user_id", status.UserID, "reason", reason)
+	return nil
+}
+
+func joinRequestDeclinedText(msgs i18n.Messages, status captcha.JoinStatus, timedOut bool) string {
+	group := joinRequestGroupName(msgs, status.ChatUsername)
+	if timedOut {
+		return msgs.Text(i18n.JoinRequestDeclinedTimeout, group)
+	}
+	return msgs.Text(i18n.JoinRequestDeclinedFailure, group)
+}
+
+// sendJoinRequestDeclinedNotice tells the applicant in their private chat
+// why the request was declined.
+func sendJoinRequestDeclinedNotice(status captcha.JoinStatus, timedOut bool) {
+	chat := status.CaptchaMessage.Chat
+	if chat == nil || bot == nil {
+		return
+	}
+	msgs := messagesFor(policyForChat(captchaGroupChat(status)))
+	if _, err := bot.Send(chat, joinRequestDeclinedText(msgs, status, timedOut), tele.ModeMarkdown); err != nil {
+		logging.Warn("failed_to_send_join_request_decline_notice", "chat_id", status.ChatID, "user_id", status.UserID, "err", err)
+	}
+}
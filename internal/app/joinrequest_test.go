@@ -0,0 +1,141 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/challengestore"
+	"toshiki-captcha-bot/internal/i18n"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+func TestJoinApprovalMemo(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0)
+	memo := newJoinApprovalMemo(time.Minute)
+	memo.add("1-2", now)
+
+	if memo.consume("1-3", now) {
+		t.Fatalf("consume(unknown key) = true, want false")
+	}
+	if !memo.consume("1-2", now.Add(30*time.Second)) {
+		t.Fatalf("consume(approved key) = false, want true")
+	}
+	if memo.consume("1-2", now.Add(30*time.Second)) {
+		t.Fatalf("second consume(approved key) = true, want false")
+	}
+
+	memo.add("1-2", now)
+	if memo.consume("1-2", now.Add(time.Minute)) {
+		t.Fatalf("consume(expired key) = true, want false")
+	}
+}
+
+func TestJoinRequestPrivateChat(t *testing.T) {
+	t.Parallel()
+
+	withChatID := joinRequestPrivateChat(&tele.ChatJoinRequest{Sender: &tele.User{ID: 42}, UserChatID: 4242})
+	if withChatID.ID != 4242 || withChatID.Type != tele.ChatPrivate {
+		t.Fatalf("joinRequestPrivateChat() = %+v, want private chat 4242", withChatID)
+	}
+
+	fallback := joinRequestPrivateChat(&tele.ChatJoinRequest{Sender: &tele.User{ID: 42}})
+	if fallback.ID != 42 || fallback.Type != tele.ChatPrivate {
+		t.Fatalf("joinRequestPrivateChat() = %+v, want private chat 42", fallback)
+	}
+}
+
+func TestCaptchaGroupChat(t *testing.T) {
+	t.Parallel()
+
+	group := &tele.Chat{ID: -100123, Type: tele.ChatSuperGroup, Username: "somegroup"}
+	if got := captchaGroupChat(captcha.JoinStatus{ChatID: group.ID, CaptchaMessage: tele.Message{Chat: group}}); got != group {
+		t.Fatalf("captchaGroupChat(group hosted) = %+v, want message chat", got)
+	}
+
+	private := captcha.JoinStatus{
+		ChatID:         -100123,
+		ChatUsername:   "somegroup",
+		CaptchaMessage: tele.Message{ID: 5, Chat: &tele.Chat{ID: 42, Type: tele.ChatPrivate}},
+	}
+	got := captchaGroupChat(private)
+	if got.ID != -100123 || got.Username != "somegroup" {
+		t.Fatalf("captchaGroupChat(private hosted) = %+v, want group -100123 @somegroup", got)
+	}
+}
+
+func TestFindPrivateChallenge(t *testing.T) {
+	origDB := db
+	t.Cleanup(func() {
+		db = origDB
+	})
+	db = challengestore.NewMemory(time.Minute, time.Hour)
+
+	dm := &tele.Chat{ID: 42, Type: tele.ChatPrivate}
+	bound := captcha.JoinStatus{UserID: 42, ChatID: -1001, JoinRequest: true, CaptchaMessage: tele.Message{ID: 7, Chat: dm}}
+	unbound := captcha.JoinStatus{UserID: 42, ChatID: -1002, JoinRequest: true, CaptchaMessage: tele.Message{Chat: dm}}
+	group := captcha.JoinStatus{UserID: 42, ChatID: -1003, CaptchaMessage: tele.Message{ID: 7, Chat: &tele.Chat{ID: -1003}}}
+	for _, status := range []captcha.JoinStatus{bound, unbound, group} {
+		if err := db.Set(challengestore.Key(status.UserID, status.ChatID), status, time.Minute); err != nil {
+			t.Fatalf("Set returned error: %v", err)
+		}
+	}
+
+	key, status, found := findPrivateChallenge(42, dm.ID, 7)
+	if !found || key != challengestore.Key(42, -1001) || status.ChatID != -1001 {
+		t.Fatalf("findPrivateChallenge(bound message) = %q, %+v, %t", key, status, found)
+	}
+
+	key, _, found = findPrivateChallenge(42, dm.ID, 9)
+	if !found || key != challengestore.Key(42, -1002) {
+		t.Fatalf("findPrivateChallenge(unbound message) = %q, %t, want the challenge with unknown message", key, found)
+	}
+
+	if _, _, found := findPrivateChallenge(43, dm.ID, 7); found {
+		t.Fatalf("findPrivateChallenge(other user) found a challenge")
+	}
+}
+
+func TestJoinRequestTexts(t *testing.T) {
+	t.Parallel()
+
+	status := captcha.JoinStatus{UserID: 42, ChatUsername: "some_group", JoinRequest: true}
+	if got := joinRequestDeclinedText(i18n.For("en"), status, false); !strings.Contains(got, `@some\_group has been declined`) {
+		t.Fatalf("failure text = %q", got)
+	}
+	if got := joinRequestDeclinedText(i18n.For("en"), status, true); !strings.Contains(got, "Captcha timeout") {
+		t.Fatalf("timeout text = %q", got)
+	}
+	if got := joinRequestDeclinedText(i18n.For("en"), captcha.JoinStatus{}, false); !strings.Contains(got, "the group") {
+		t.Fatalf("failure text without username = %q", got)
+	}
+	if got := captchaSuccessCallbackText(i18n.For("en"), status); !strings.Contains(got, "approved") {
+		t.Fatalf("success text = %q, want approval statement", got)
+	}
+}
+
+func TestGenCaptionForJoinRequest(t *testing.T) {
+	origCfg := cfg
+	cfg = mustValidatedRuntimeConfig(t, settings.DefaultRuntimeConfig())
+	t.Cleanup(func() {
+		cfg = origCfg
+	})
+
+	status := captcha.JoinStatus{JoinRequest: true, ChatUsername: "somegroup"}
+	caption := genCaptionForStatus(&tele.User{ID: 42, FirstName: "Alice"}, captcha.TypeEmojiSequence, status)
+	if !strings.Contains(caption, "request to join @somegroup") {
+		t.Fatalf("caption = %q, want join request closing", caption)
+	}
+	if strings.Contains(caption, "leave group") {
+		t.Fatalf("caption = %q, should not ask to leave the group", caption)
+	}
+
+	groupCaption := genCaptionForStatus(nil, captcha.TypeEmojiSequence, captcha.JoinStatus{})
+	if groupCaption != genCaption(nil, captcha.TypeEmojiSequence, cfg.PolicyForChatUsername("")) {
+		t.Fatalf("group caption = %q, want genCaption output", groupCaption)
+	}
+}
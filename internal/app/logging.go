@@ -0,0 +1,32 @@
+package app
+
+import (
+	"os"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/logging"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+// configureLogging installs the logger described by the logging section.
+// It runs at startup and again after every reload.
+func configureLogging(config settings.RuntimeConfig) {
+	level, err := logging.ParseLevel(config.Logging.Level)
+	if err != nil {
+		level = logging.LevelInfo
+	}
+	logging.SetDefault(logging.New(os.Stderr, config.Logging.Format, level))
+}
+
+// logHandlerError reports errors returned by update handlers, which telebot
+// would otherwise print with the standard logger.
+func logHandlerError(err error, c tele.Context) {
+	fields := []interface{}{"err", err}
+	if c != nil && c.Chat() != nil {
+		fields = append(fields, "chat_id", c.Chat().ID)
+	}
+	if c != nil && c.Sender() != nil {
+		fields = append(fields, "user_id", c.Sender().ID)
+	}
+	logging.Error("update_handler_failed", fields...)
+}
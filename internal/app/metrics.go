@@ -0,0 +1,153 @@
+package app
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/metrics"
+)
+
+// Challenge outcomes used as the result label.
+const (
+	resultSolved  = "solved"
+	resultFailed  = "failed"
+	resultTimeout = "timeout"
+	resultOK      = "ok"
+	resultError   = "error"
+)
+
+// solveDurationBuckets cover a quick click-through up to the longest
+// expiration that is practical to configure.
+var solveDurationBuckets = []float64{1, 2.5, 5, 10, 15, 30, 45, 60, 120, 300, 600}
+
+var (
+	metricsRegistry = metrics.NewRegistry()
+
+	challengesIssued = metricsRegistry.NewCounterVec(
+		"captcha_bot_challenges_issued_total",
+		"Captcha challenges issued to joining members.",
+		"chat",
+	)
+	challengesCompleted = metricsRegistry.NewCounterVec(
+		"captcha_bot_challenges_completed_total",
+		"Captcha challenges that ended, by result: solved, failed or timeout.",
+		"chat", "result",
+	)
+	captchaActions = metricsRegistry.NewCounterVec(
+		"captcha_bot_actions_total",
+		"Consequences such as bans applied after a failed or expired captcha.",
+		"chat", "action", "result",
+	)
+	restrictFailures = metricsRegistry.NewCounterVec(
+		"captcha_bot_restrict_failures_total",
+		"Bot API calls that failed to restrict or release a member.",
+		"chat",
+	)
+	sendTimeouts = metricsRegistry.NewCounterVec(
+		"captcha_bot_send_timeouts_total",
+		"Captcha challenges whose delivery timed out with an uncertain outcome.",
+		"chat",
+	)
+	regenerations = metricsRegistry.NewCounterVec(
+		"captcha_bot_regenerations_total",
+		"Captcha challenges replaced after a wrong answer.",
+		"chat",
+	)
+	solveDuration = metricsRegistry.NewHistogramVec(
+		"captcha_bot_solve_duration_seconds",
+		"Time from issuing a captcha until it was solved or failed.",
+		solveDurationBuckets,
+		"chat", "result",
+	)
+	telegramAPIDuration = metricsRegistry.NewHistogramVec(
+		"captcha_bot_telegram_api_duration_seconds",
+		"Latency of Telegram Bot API requests by method.",
+		metrics.DefBuckets,
+		"method", "result",
+	)
+)
+
+func init() {
+	metricsRegistry.NewGaugeFunc(
+		"captcha_bot_pending_challenges",
+		"Challenges waiting for an answer in the challenge store.",
+		func() float64 {
+			if db == nil {
+				return 0
+			}
+			return float64(len(db.List()))
+		},
+	)
+}
+
+func chatLabel(chatID int64) string {
+	return strconv.FormatInt(chatID, 10)
+}
+
+func recordChallengeIssued(status captcha.JoinStatus) {
+	challengesIssued.Inc(chatLabel(status.ChatID))
+}
+
+// recordChallengeCompleted counts the outcome of status and, unless it timed
+// out, how long the user took.
+func recordChallengeCompleted(status captcha.JoinStatus, result string, now time.Time) {
+	chat := chatLabel(status.ChatID)
+	challengesCompleted.Inc(chat, result)
+	if result != resultTimeout && !status.IssuedAt.IsZero() {
+		solveDuration.Observe(now.Sub(status.IssuedAt).Seconds(), chat, result)
+	}
+}
+
+func recordCaptchaAction(chatID int64, action string, err error) {
+	result := resultOK
+	if err != nil {
+		result = resultError
+	}
+	captchaActions.Inc(chatLabel(chatID), action, result)
+}
+
+// restrictMember applies member's rights in chat and counts failures.
+func restrictMember(chat *tele.Chat, member *tele.ChatMember) error {
+	return restrictMemberWith(bot, chat, member)
+}
+
+func restrictMemberWith(api memberModerator, chat *tele.Chat, member *tele.ChatMember) error {
+	err := api.Restrict(chat, member)
+	if err != nil && chat != nil {
+		restrictFailures.Inc(chatLabel(chat.ID))
+	}
+	return err
+}
+
+// apiTransport times every Bot API request and records successful
+// getUpdates calls for /readyz. The method label is the last path segment
+// of the request URL, e.g. sendPhoto.
+type apiTransport struct {
+	next http.RoundTripper
+}
+
+func newAPITransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &apiTransport{next: next}
+}
+
+func (t *apiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	method := path.Base(req.URL.Path)
+	result := resultOK
+	if err != nil || resp.StatusCode >= http.StatusMultipleChoices {
+		result = resultError
+	}
+	telegramAPIDuration.Observe(time.Since(start).Seconds(), method, result)
+	if method == "getUpdates" && result == resultOK {
+		health.markUpdatesReceived(time.Now())
+	}
+	return resp, err
+}
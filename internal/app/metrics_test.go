@@ -0,0 +1,90 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"toshiki-captcha-bot/internal/captcha"
+)
+
+func TestRecordChallengeCompleted(t *testing.T) {
+	t.Parallel()
+
+	issuedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		chatID       int64
+		issuedAt     time.Time
+		result       string
+		wantObserved uint64
+	}{
+		{name: "solved", chatID: -1009000000001, issuedAt: issuedAt, result: resultSolved, wantObserved: 1},
+		{name: "failed", chatID: -1009000000002, issuedAt: issuedAt, result: resultFailed, wantObserved: 1},
+		{name: "timeout is not a solve time", chatID: -1009000000003, issuedAt: issuedAt, result: resultTimeout},
+		{name: "status from before issued_at", chatID: -1009000000004, result: resultSolved},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			status := captcha.JoinStatus{ChatID: tt.chatID, IssuedAt: tt.issuedAt}
+			recordChallengeCompleted(status, tt.result, issuedAt.Add(12*time.Second))
+
+			chat := chatLabel(tt.chatID)
+			if got := challengesCompleted.Value(chat, tt.result); got != 1 {
+				t.Fatalf("completed counter = %v, want 1", got)
+			}
+			if got := solveDuration.Count(chat, tt.result); got != tt.wantObserved {
+				t.Fatalf("solve duration observations = %d, want %d", got, tt.wantObserved)
+			}
+		})
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestAPITransport(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		method     string
+		status     int
+		err        error
+		wantResult string
+	}{
+		{name: "success", method: "testLatencyOK", status: http.StatusOK, wantResult: resultOK},
+		{name: "api error", method: "testLatencyAPIError", status: http.StatusBadRequest, wantResult: resultError},
+		{name: "transport error", method: "testLatencyTransportError", err: errors.New("connection reset"), wantResult: resultError},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			transport := newAPITransport(roundTripFunc(func(*http.Request) (*http.Response, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &http.Response{StatusCode: tt.status, Body: http.NoBody}, nil
+			}))
+			req := httptest.NewRequest(http.MethodPost, "https://api.telegram.org/botTOKEN/"+tt.method, nil)
+			if _, err := transport.RoundTrip(req); !errors.Is(err, tt.err) {
+				t.Fatalf("RoundTrip error = %v, want %v", err, tt.err)
+			}
+			if got := telegramAPIDuration.Count(tt.method, tt.wantResult); got != 1 {
+				t.Fatalf("observations for %s/%s = %d, want 1", tt.method, tt.wantResult, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/challengestore"
+	"toshiki-captcha-bot/internal/logging"
+)
+
+// moderationCommand is an admin command that acts on one user of the group
+// it is run in.
+type moderationCommand struct {
+	// name is the command without the leading slash.
+	name string
+	// done is the past tense used in replies, e.g. Approved.
+	done string
+	// record is the moderation record posted on success.
+	record string
+	apply  func(chat *tele.Chat, userID int64) error
+}
+
+var (
+	approveCommand = moderationCommand{
+		name:   "approve",
+		done:   "Approved",
+		record: modlogApproved,
+		apply: func(chat *tele.Chat, userID int64) error {
+			return approveMember(chat, userID, "admin_approved")
+		},
+	}
+	unbanCommand = moderationCommand{
+		name:   "unban",
+		done:   "Unbanned",
+		record: modlogUnbanned,
+		apply:  unbanMember,
+	}
+)
+
+func onApprove(c tele.Context) error {
+	return handleModerationCommand(c, approveCommand)
+}
+
+func onUnban(c tele.Context) error {
+	return handleModerationCommand(c, unbanCommand)
+}
+
+// handleModerationCommand runs cmd against the user the command replies to,
+// or the user ID given as its argument.
+func handleModerationCommand(c tele.Context, cmd moderationCommand) error {
+	if !allowAdminGroupCommand(c, cmd.name) {
+		return nil
+	}
+
+	target, ok := moderationTarget(c, cmd.name)
+	if !ok {
+		return nil
+	}
+
+	if err := cmd.apply(c.Chat(), target.ID); err != nil {
+		logging.Warn("failed_to_"+cmd.name+"_user", "chat_id", c.Chat().ID, "actor_user_id", c.Sender().ID, "target_user_id", target.ID, "err", err)
+		if sendErr := c.Send(fmt.Sprintf("Failed to %s user %d: %v", cmd.name, target.ID, err)); sendErr != nil {
+			logging.Warn("failed_to_send_"+cmd.name+"_failure", "chat_id", c.Chat().ID, "actor_user_id", c.Sender().ID, "err", sendErr)
+		}
+		return nil
+	}
+
+	logging.Info("user_"+strings.ToLower(cmd.done)+"_by_admin", "chat_id", c.Chat().ID, "actor_user_id", c.Sender().ID, "target_user_id", target.ID)
+	postModerationRecord(moderationRecord{
+		event:     cmd.record,
+		chat:      c.Chat(),
+		userID:    target.ID,
+		userName:  userDisplayName(target),
+		actorID:   c.Sender().ID,
+		actorName: userDisplayName(c.Sender()),
+	})
+	if err := c.Send(fmt.Sprintf("%s %s.", cmd.done, markdownMention(target)), tele.ModeMarkdown); err != nil {
+		logging.Warn("failed_to_send_"+cmd.name+"_response", "chat_id", c.Chat().ID, "actor_user_id", c.Sender().ID, "err", err)
+	}
+	return nil
+}
+
+func onReject(c tele.Context) error {
+	if !allowAdminGroupCommand(c, "reject") {
+		return nil
+	}
+	target, ok := moderationTarget(c, "reject")
+	if !ok {
+		return nil
+	}
+
+	kvID := challengestore.Key(target.ID, c.Chat().ID)
+	status, found := db.Get(kvID)
+	if !found {
+		logging.Info("reject_skipped", "reason", "no_pending_captcha", "chat_id", c.Chat().ID, "actor_user_id", c.Sender().ID, "target_user_id", target.ID)
+		if err := c.Send(fmt.Sprintf("No pending captcha for %s.", markdownMention(target)), tele.ModeMarkdown); err != nil {
+			logging.Warn("failed_to_send_reject_response", "chat_id", c.Chat().ID, "actor_user_id", c.Sender().ID, "err", err)
+		}
+		return nil
+	}
+
+	// Same outcome as reaching captcha.max_failures; the failure notice
+	// tells the group.
+	failCaptchaChallenge(kvID, status, c.Chat(), "admin_rejected", c.Sender())
+	logging.Info("user_rejected_by_admin", "chat_id", c.Chat().ID, "actor_user_id", c.Sender().ID, "target_user_id", target.ID)
+	return nil
+}
+
+// moderationTarget resolves the user command name acts on, filling in the
+// name of a pending user given by ID. It replies with the usage and
+// reports false when there is none.
+func moderationTarget(c tele.Context, name string) (*tele.User, bool) {
+	target, err := resolveModerationTarget(c.Message())
+	if err != nil {
+		logging.Warn(name+"_target_resolution_failed", "chat_id", c.Chat().ID, "actor_user_id", c.Sender().ID, "err", err)
+		usage := fmt.Sprintf("Usage: reply to the user's message with `/%s`, or run `/%s <user ID>`.", name, name)
+		if sendErr := c.Send(usage, tele.ModeMarkdown); sendErr != nil {
+			logging.Warn("failed_to_send_"+name+"_usage", "chat_id", c.Chat().ID, "actor_user_id", c.Sender().ID, "err", sendErr)
+		}
+		return nil, false
+	}
+	if target.FirstName == "" {
+		if status, found := db.Get(challengestore.Key(target.ID, c.Chat().ID)); found {
+			target.FirstName = status.UserFullName
+		}
+	}
+	return target, true
+}
+
+// allowAdminGroupCommand reports whether the group admin command name may
+// run in c. It logs why not, leaving unauthorized groups and telling
+// non-admin senders they are denied.
+func allowAdminGroupCommand(c tele.Context, name string) bool {
+	if c == nil || c.Chat() == nil {
+		logging.Warn(name+"_skipped", "reason", "missing_chat_context")
+		return false
+	}
+	if c.Sender() == nil {
+		logging.Warn(name+"_skipped", "reason", "missing_sender", "chat_id", c.Chat().ID)
+		return false
+	}
+	if !allowAdminGroupChat(c, name) {
+		return false
+	}
+	if !isSenderAllowed(c) {
+		logAccessDenied(c, name+"_sender_not_allowed")
+		respondAdminOnlyCommandDenied(c, "/"+name)
+		return false
+	}
+	if c.Chat().Type == tele.ChatPrivate {
+		logging.Warn(name+"_skipped", "reason", "private_chat_requires_group", "chat_id", c.Chat().ID, "user_id", c.Sender().ID)
+		return false
+	}
+	return true
+}
+
+// allowAdminGroupChat reports whether admin actions named name may run in
+// the chat of c, leaving unsupported and unauthorized groups.
+func allowAdminGroupChat(c tele.Context, name string) bool {
+	if leaveIfUnsupportedPrivateGroup(c.Chat(), name) {
+		return false
+	}
+	if !isAllowedCommandChat(c.Chat()) {
+		logAccessDenied(c, name+"_chat_not_allowed")
+		if isGroupChat(c.Chat()) {
+			leaveChat(c.Chat(), "unauthorized_group")
+		}
+		return false
+	}
+	return true
+}
+
+// resolveModerationTarget returns the sender of the replied-to message, or
+// a user with the ID given as the first command argument. The reply wins
+// when both are present.
+func resolveModerationTarget(message *tele.Message) (*tele.User, error) {
+	if message == nil {
+		return nil, fmt.Errorf("missing command context")
+	}
+	if reply := message.ReplyTo; reply != nil && reply.Sender != nil {
+		return reply.Sender, nil
+	}
+	fields := strings.Fields(message.Payload)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("target resolution requires a reply or a user ID")
+	}
+	userID, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || userID <= 0 {
+		return nil, fmt.Errorf("invalid user ID %q", fields[0])
+	}
+	return &tele.User{ID: userID}, nil
+}
+
+// approveMember lets userID into chat as if the captcha had been solved: a
+// pending challenge is cleared and its message deleted, a pending join
+// request is approved, and otherwise every restriction is lifted.
+func approveMember(chat *tele.Chat, userID int64, reason string) error {
+	if chat == nil {
+		return fmt.Errorf("missing target chat")
+	}
+	if bot == nil {
+		return fmt.Errorf("bot not initialized")
+	}
+	return approveMemberWith(bot, chat, userID, reason)
+}
+
+// memberApprover is the part of the Bot API used by approveMember.
+type memberApprover interface {
+	memberModerator
+	Delete(msg tele.Editable) error
+}
+
+func approveMemberWith(api memberApprover, chat *tele.Chat, userID int64, reason string) error {
+	kvID := challengestore.Key(userID, chat.ID)
+	if status, found := db.Get(kvID); found {
+		if status.JoinRequest {
+			// Keep the challenge pending when Telegram refuses, so the
+			// admin can retry and the timeout action still fires.
+			if err := resolveJoinRequestWith(api, status, true, reason); err != nil {
+				return err
+			}
+		}
+		if err := db.Delete(kvID); err != nil {
+			logging.Warn("failed_to_delete_approved_captcha_state", "chat_id", chat.ID, "user_id", userID, "err", err)
+		}
+		if status.CaptchaMessage.ID > 0 {
+			if err := api.Delete(&status.CaptchaMessage); err != nil {
+				logging.Warn("failed_to_delete_approved_captcha_message", "chat_id", chat.ID, "user_id", userID, "message_id", status.CaptchaMessage.ID, "err", err)
+			}
+		}
+		// Join requests were handled above, and manual test challenges
+		// never restricted the user.
+		if status.JoinRequest || status.ManualChallenge {
+			return nil
+		}
+	}
+
+	member := &tele.ChatMember{User: &tele.User{ID: userID}, Rights: tele.NoRestrictions()}
+	if err := restrictMemberWith(api, chat, member); err != nil {
+		return fmt.Errorf("lift restrictions: %w", err)
+	}
+	return nil
+}
+
+// unbanMember lifts any ban on userID in chat, whether the bot or an admin
+// set it. Members who are not banned are left alone.
+func unbanMember(chat *tele.Chat, userID int64) error {
+	if chat == nil {
+		return fmt.Errorf("missing target chat")
+	}
+	if bot == nil {
+		return fmt.Errorf("bot not initialized")
+	}
+	if err := bot.Unban(chat, &tele.User{ID: userID}, true); err != nil {
+		return fmt.Errorf("unban user: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/challengestore"
+)
+
+func TestResolveModerationTarget(t *testing.T) {
+	t.Parallel()
+
+	replied := &tele.User{ID: 42, FirstName: "Jane"}
+	tests := []struct {
+		name    string
+		message *tele.Message
+		wantID  int64
+		wantErr bool
+	}{
+		{name: "reply", message: &tele.Message{ReplyTo: &tele.Message{Sender: replied}}, wantID: 42},
+		{name: "reply wins over argument", message: &tele.Message{Payload: "7", ReplyTo: &tele.Message{Sender: replied}}, wantID: 42},
+		{name: "user ID argument", message: &tele.Message{Payload: " 123456789 extra"}, wantID: 123456789},
+		{name: "missing message", wantErr: true},
+		{name: "no reply or argument", message: &tele.Message{}, wantErr: true},
+		{name: "username argument", message: &tele.Message{Payload: "@jane"}, wantErr: true},
+		{name: "negative ID", message: &tele.Message{Payload: "-100123"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := resolveModerationTarget(tt.message)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveModerationTarget() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err == nil && got.ID != tt.wantID {
+				t.Fatalf("resolveModerationTarget() ID = %d, want %d", got.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestApproveMemberReportsFailedJoinRequestApproval(t *testing.T) {
+	origDB := db
+	t.Cleanup(func() {
+		db = origDB
+	})
+	db = challengestore.NewMemory(time.Minute, time.Hour)
+
+	chat := &tele.Chat{ID: -100123}
+	key := challengestore.Key(1001, chat.ID)
+	if err := db.Set(key, captcha.JoinStatus{UserID: 1001, ChatID: chat.ID, JoinRequest: true}, time.Minute); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+
+	api := &mockMemberModerator{approveErr: errors.New("HIDE_REQUESTER_MISSING")}
+	if err := approveMemberWith(api, chat, 1001, "admin_approved"); err == nil {
+		t.Fatal("approveMemberWith returned no error for a failed join request approval")
+	}
+	if _, found := db.Get(key); !found {
+		t.Fatal("challenge was cleared although the join request was not approved")
+	}
+
+	api = &mockMemberModerator{}
+	if err := approveMemberWith(api, chat, 1001, "admin_approved"); err != nil {
+		t.Fatalf("approveMemberWith returned error: %v", err)
+	}
+	if _, found := db.Get(key); found {
+		t.Fatal("challenge still pending after approval")
+	}
+	if len(api.calls) != 1 || api.calls[0].method != "approve" {
+		t.Fatalf("calls = %+v, want one join request approval", api.calls)
+	}
+}
@@ -0,0 +1,244 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/logging"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+// Moderation record events posted to the configured log chat.
+const (
+	modlogJoin            = "join"
+	modlogJoinRequest     = "join_request"
+	modlogChallengeIssued = "challenge_issued"
+	modlogManualChallenge = "manual_challenge"
+	modlogSolved          = "solved"
+	modlogFailed          = "failed"
+	modlogTimeout         = "timeout"
+	modlogRestrictFailed  = "restrict_failed"
+	modlogApproved        = "approved"
+	modlogUnbanned        = "unbanned"
+	modlogRejected        = "rejected"
+)
+
+// Unique values of the inline buttons attached to moderation records.
+const (
+	modlogUnbanUnique   = "modlog_unban"
+	modlogApproveUnique = "modlog_approve"
+)
+
+var modlogTitles = map[string]string{
+	modlogJoin:            "👋 User joined",
+	modlogJoinRequest:     "📨 Join request received",
+	modlogChallengeIssued: "🧩 Captcha issued",
+	modlogManualChallenge: "🧪 Manual captcha issued",
+	modlogSolved:          "✅ Captcha solved",
+	modlogFailed:          "❌ Captcha failed",
+	modlogTimeout:         "⏰ Captcha timed out",
+	modlogRestrictFailed:  "⚠️ Restriction failed",
+	modlogApproved:        "🟢 Approved by admin",
+	modlogUnbanned:        "🔓 Unbanned by admin",
+	modlogRejected:        "⛔ Rejected by admin",
+}
+
+// moderationRecord is one entry for the log chat. chat is the group the
+// record is about; actor fields are set for admin-triggered events.
+type moderationRecord struct {
+	event     string
+	chat      *tele.Chat
+	userID    int64
+	userName  string
+	actorID   int64
+	actorName string
+	action    settings.CaptchaAction
+	actionErr error
+	solveTime time.Duration
+	failures  int
+	err       error
+}
+
+func userDisplayName(user *tele.User) string {
+	if user == nil {
+		return ""
+	}
+	return sanitizeName(user.FirstName + " " + user.LastName)
+}
+
+func modlogMention(userID int64, name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "user"
+	}
+	return fmt.Sprintf("[%s](tg://user?id=%d) (`%d`)", escapeTelegramMarkdown(name), userID, userID)
+}
+
+func modlogChatName(chat *tele.Chat) string {
+	if chat == nil {
+		return "unknown chat"
+	}
+	switch {
+	case chat.Username != "":
+		return fmt.Sprintf("@%s (`%d`)", escapeTelegramMarkdown(chat.Username), chat.ID)
+	case chat.Title != "":
+		return fmt.Sprintf("%s (`%d`)", escapeTelegramMarkdown(chat.Title), chat.ID)
+	default:
+		return fmt.Sprintf("`%d`", chat.ID)
+	}
+}
+
+// statusRecord returns a record about the user and group of status.
+func statusRecord(event string, status captcha.JoinStatus) moderationRecord {
+	return moderationRecord{
+		event:    event,
+		chat:     captchaGroupChat(status),
+		userID:   status.UserID,
+		userName: status.UserFullName,
+		failures: status.FailCaptcha,
+	}
+}
+
+// postChallengeIssuedRecord records an automatic challenge. Manual ones are
+// recorded when /testcaptcha is used, together with the admin.
+func postChallengeIssuedRecord(status captcha.JoinStatus) {
+	if status.ManualChallenge {
+		return
+	}
+	postModerationRecord(statusRecord(modlogChallengeIssued, status))
+}
+
+// moderationRecordText renders r as a Markdown message.
+func moderationRecordText(r moderationRecord) string {
+	title, ok := modlogTitles[r.event]
+	if !ok {
+		title = r.event
+	}
+	lines := []string{
+		"*" + title + "*",
+		"Chat: " + modlogChatName(r.chat),
+		"User: " + modlogMention(r.userID, r.userName),
+	}
+	if r.actorID != 0 {
+		lines = append(lines, "By: "+modlogMention(r.actorID, r.actorName))
+	}
+	if r.solveTime > 0 {
+		lines = append(lines, "Solve time: "+r.solveTime.Round(100*time.Millisecond).String())
+	}
+	if r.failures > 0 {
+		lines = append(lines, "Failures: "+strconv.Itoa(r.failures))
+	}
+	if r.action.Action != "" {
+		action := escapeTelegramMarkdown(r.action.Action)
+		if r.action.Action == settings.CaptchaActionBanFor {
+			action += " " + r.action.Duration.String()
+		}
+		if r.actionErr != nil {
+			action += " (failed: " + escapeTelegramMarkdown(r.actionErr.Error()) + ")"
+		}
+		lines = append(lines, "Action: "+action)
+	}
+	if r.err != nil {
+		lines = append(lines, "Error: "+escapeTelegramMarkdown(r.err.Error()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// moderationRecordMarkup returns the button that undoes the consequence of
+// a failed, rejected or timed out captcha, or nil when there is nothing to
+// undo.
+func moderationRecordMarkup(r moderationRecord) *tele.ReplyMarkup {
+	if r.chat == nil || r.actionErr != nil || (r.event != modlogFailed && r.event != modlogRejected && r.event != modlogTimeout) {
+		return nil
+	}
+	data := strconv.FormatInt(r.chat.ID, 10) + "|" + strconv.FormatInt(r.userID, 10)
+	var button tele.InlineButton
+	switch r.action.Action {
+	case settings.CaptchaActionBan, settings.CaptchaActionBanFor:
+		button = tele.InlineButton{Unique: modlogUnbanUnique, Text: "Unban", Data: data}
+	case settings.CaptchaActionMute:
+		button = tele.InlineButton{Unique: modlogApproveUnique, Text: "Approve", Data: data}
+	default:
+		return nil
+	}
+	return &tele.ReplyMarkup{InlineKeyboard: [][]tele.InlineButton{{button}}}
+}
+
+// postModerationRecord sends r to the log chat configured for r.chat in the
+// background. It does nothing when no log chat is configured.
+func postModerationRecord(r moderationRecord) {
+	if r.chat == nil || bot == nil {
+		return
+	}
+	logChat := policyForChat(r.chat).LogChat
+	if logChat == 0 {
+		return
+	}
+	text := moderationRecordText(r)
+	markup := moderationRecordMarkup(r)
+	inFlight.Go(func() {
+		opts := &tele.SendOptions{ParseMode: tele.ModeMarkdown, ReplyMarkup: markup, DisableWebPagePreview: true}
+		if _, err := bot.Send(&tele.Chat{ID: logChat}, text, opts); err != nil {
+			logging.Warn("failed_to_post_moderation_record", "log_chat_id", logChat, "chat_id", r.chat.ID, "user_id", r.userID, "record", r.event, "err", err)
+		}
+	})
+}
+
+// parseModlogButtonData splits "chatID|userID" button data.
+func parseModlogButtonData(args []string) (chatID, userID int64, err error) {
+	if len(args) != 2 {
+		return 0, 0, fmt.Errorf("want chat and user ID, got %d values", len(args))
+	}
+	if chatID, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("parse chat ID: %w", err)
+	}
+	if userID, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("parse user ID: %w", err)
+	}
+	return chatID, userID, nil
+}
+
+func onModlogUnban(c tele.Context) error {
+	return handleModlogButton(c, unbanCommand)
+}
+
+func onModlogApprove(c tele.Context) error {
+	return handleModlogButton(c, approveCommand)
+}
+
+// handleModlogButton checks that an admin pressed a moderation record
+// button in a log chat, runs cmd and replies to the record with the
+// outcome.
+func handleModlogButton(c tele.Context, cmd moderationCommand) error {
+	if c == nil || c.Chat() == nil || c.Callback() == nil || c.Sender() == nil {
+		return nil
+	}
+	if !currentConfig().IsLogChat(c.Chat().ID) || !isSenderAllowed(c) {
+		logAccessDenied(c, "modlog_"+cmd.name)
+		return c.Respond(&tele.CallbackResponse{Text: "Only configured bot admins can use this button.", ShowAlert: true})
+	}
+
+	chatID, userID, err := parseModlogButtonData(c.Args())
+	if err != nil {
+		logging.Warn("modlog_button_rejected", "button", cmd.name, "chat_id", c.Chat().ID, "user_id", c.Sender().ID, "err", err)
+		return c.Respond(&tele.CallbackResponse{Text: "This button is no longer valid."})
+	}
+
+	if err := cmd.apply(&tele.Chat{ID: chatID}, userID); err != nil {
+		logging.Warn("failed_to_apply_modlog_button", "button", cmd.name, "chat_id", chatID, "user_id", userID, "actor_user_id", c.Sender().ID, "err", err)
+		return c.Respond(&tele.CallbackResponse{Text: "Failed: " + err.Error(), ShowAlert: true})
+	}
+	logging.Info("modlog_button_applied", "button", cmd.name, "chat_id", chatID, "user_id", userID, "actor_user_id", c.Sender().ID)
+
+	if _, err := bot.EditReplyMarkup(c.Message(), nil); err != nil {
+		logging.Warn("failed_to_remove_modlog_button", "chat_id", c.Chat().ID, "message_id", c.Message().ID, "err", err)
+	}
+	if _, err := bot.Reply(c.Message(), cmd.done+" by "+markdownMention(c.Sender())+".", tele.ModeMarkdown); err != nil {
+		logging.Warn("failed_to_send_modlog_button_outcome", "chat_id", c.Chat().ID, "err", err)
+	}
+	return c.Respond()
+}
@@ -0,0 +1,193 @@
+package app
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+func TestModerationRecordText(t *testing.T) {
+	t.Parallel()
+
+	group := &tele.Chat{ID: -100123, Username: "my_group"}
+	tests := []struct {
+		name   string
+		record moderationRecord
+		want   string
+	}{
+		{
+			name:   "join",
+			record: moderationRecord{event: modlogJoin, chat: group, userID: 42, userName: "Jane Doe"},
+			want: "*👋 User joined*\n" +
+				"Chat: @my\\_group (`-100123`)\n" +
+				"User: [Jane Doe](tg://user?id=42) (`42`)",
+		},
+		{
+			name:   "solved with solve time",
+			record: moderationRecord{event: modlogSolved, chat: group, userID: 42, userName: "Jane", solveTime: 12340 * time.Millisecond},
+			want: "*✅ Captcha solved*\n" +
+				"Chat: @my\\_group (`-100123`)\n" +
+				"User: [Jane](tg://user?id=42) (`42`)\n" +
+				"Solve time: 12.3s",
+		},
+		{
+			name: "failed with action",
+			record: moderationRecord{
+				event:    modlogFailed,
+				chat:     &tele.Chat{ID: -100123, Title: "Private"},
+				userID:   42,
+				failures: 3,
+				action:   settings.CaptchaAction{Action: settings.CaptchaActionBanFor, Duration: time.Hour},
+			},
+			want: "*❌ Captcha failed*\n" +
+				"Chat: Private (`-100123`)\n" +
+				"User: [user](tg://user?id=42) (`42`)\n" +
+				"Failures: 3\n" +
+				"Action: ban\\_for 1h0m0s",
+		},
+		{
+			name: "manual challenge with admin",
+			record: moderationRecord{
+				event:     modlogManualChallenge,
+				chat:      &tele.Chat{ID: -100123},
+				userID:    42,
+				userName:  "Jane",
+				actorID:   1001,
+				actorName: "Admin",
+			},
+			want: "*🧪 Manual captcha issued*\n" +
+				"Chat: `-100123`\n" +
+				"User: [Jane](tg://user?id=42) (`42`)\n" +
+				"By: [Admin](tg://user?id=1001) (`1001`)",
+		},
+		{
+			name: "action and restriction errors",
+			record: moderationRecord{
+				event:     modlogTimeout,
+				chat:      group,
+				userID:    42,
+				userName:  "Jane",
+				action:    settings.CaptchaAction{Action: settings.CaptchaActionBan},
+				actionErr: errors.New("not enough rights"),
+			},
+			want: "*⏰ Captcha timed out*\n" +
+				"Chat: @my\\_group (`-100123`)\n" +
+				"User: [Jane](tg://user?id=42) (`42`)\n" +
+				"Action: ban (failed: not enough rights)",
+		},
+		{
+			name:   "restriction failed",
+			record: moderationRecord{event: modlogRestrictFailed, chat: group, userID: 42, userName: "Jane", err: errors.New("user_is_admin")},
+			want: "*⚠️ Restriction failed*\n" +
+				"Chat: @my\\_group (`-100123`)\n" +
+				"User: [Jane](tg://user?id=42) (`42`)\n" +
+				"Error: user\\_is\\_admin",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := moderationRecordText(tt.record); got != tt.want {
+				t.Fatalf("moderationRecordText() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModerationRecordMarkup(t *testing.T) {
+	t.Parallel()
+
+	group := &tele.Chat{ID: -100123}
+	tests := []struct {
+		name       string
+		record     moderationRecord
+		wantUnique string
+		wantText   string
+	}{
+		{
+			name:       "ban on failure",
+			record:     moderationRecord{event: modlogFailed, chat: group, userID: 42, action: settings.CaptchaAction{Action: settings.CaptchaActionBan}},
+			wantUnique: modlogUnbanUnique,
+			wantText:   "Unban",
+		},
+		{
+			name:       "timed ban on timeout",
+			record:     moderationRecord{event: modlogTimeout, chat: group, userID: 42, action: settings.CaptchaAction{Action: settings.CaptchaActionBanFor, Duration: time.Hour}},
+			wantUnique: modlogUnbanUnique,
+			wantText:   "Unban",
+		},
+		{
+			name:       "mute",
+			record:     moderationRecord{event: modlogFailed, chat: group, userID: 42, action: settings.CaptchaAction{Action: settings.CaptchaActionMute}},
+			wantUnique: modlogApproveUnique,
+			wantText:   "Approve",
+		},
+		{
+			name:   "kick leaves nothing to undo",
+			record: moderationRecord{event: modlogFailed, chat: group, userID: 42, action: settings.CaptchaAction{Action: settings.CaptchaActionKick}},
+		},
+		{
+			name:   "failed action",
+			record: moderationRecord{event: modlogFailed, chat: group, userID: 42, action: settings.CaptchaAction{Action: settings.CaptchaActionBan}, actionErr: errors.New("forbidden")},
+		},
+		{
+			name:   "join request without action",
+			record: moderationRecord{event: modlogTimeout, chat: group, userID: 42},
+		},
+		{
+			name:   "not a ban record",
+			record: moderationRecord{event: modlogSolved, chat: group, userID: 42, action: settings.CaptchaAction{Action: settings.CaptchaActionBan}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			markup := moderationRecordMarkup(tt.record)
+			if tt.wantUnique == "" {
+				if markup != nil {
+					t.Fatalf("moderationRecordMarkup() = %+v, want nil", markup)
+				}
+				return
+			}
+			if markup == nil || len(markup.InlineKeyboard) != 1 || len(markup.InlineKeyboard[0]) != 1 {
+				t.Fatalf("moderationRecordMarkup() = %+v, want one button", markup)
+			}
+			button := markup.InlineKeyboard[0][0]
+			if button.Unique != tt.wantUnique || button.Text != tt.wantText || button.Data != "-100123|42" {
+				t.Fatalf("button = %+v, want unique %q, text %q, data -100123|42", button, tt.wantUnique, tt.wantText)
+			}
+
+			chatID, userID, err := parseModlogButtonData(splitButtonData(button.Data))
+			if err != nil || chatID != -100123 || userID != 42 {
+				t.Fatalf("parseModlogButtonData(%q) = %d, %d, %v", button.Data, chatID, userID, err)
+			}
+		})
+	}
+}
+
+func TestParseModlogButtonDataRejectsMalformed(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range []string{"", "-100123", "-100123|abc", "x|42", "-100123|42|7"} {
+		if _, _, err := parseModlogButtonData(splitButtonData(data)); err == nil {
+			t.Fatalf("parseModlogButtonData(%q) returned no error", data)
+		}
+	}
+}
+
+func splitButtonData(data string) []string {
+	if data == "" {
+		return nil
+	}
+	return strings.Split(data, "|")
+}
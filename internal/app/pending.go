@@ -0,0 +1,229 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/challengestore"
+	"toshiki-captcha-bot/internal/logging"
+)
+
+// Unique values of the buttons attached to /pending replies.
+const (
+	pendingApproveUnique = "pending_approve"
+	pendingRejectUnique  = "pending_reject"
+	pendingReissueUnique = "pending_reissue"
+)
+
+// pendingListLimit caps the challenges listed in one /pending reply so the
+// text and keyboard stay within Telegram limits.
+const pendingListLimit = 20
+
+// pendingChallengesForChat returns the records of chatID in store order,
+// which is soonest to expire first.
+func pendingChallengesForChat(records []challengestore.Record, chatID int64) []challengestore.Record {
+	pending := make([]challengestore.Record, 0)
+	for _, record := range records {
+		if record.Status.ChatID == chatID {
+			pending = append(pending, record)
+		}
+	}
+	return pending
+}
+
+// pendingListText renders records as a numbered Markdown list. Only the
+// first pendingListLimit records are listed.
+func pendingListText(records []challengestore.Record, now time.Time) string {
+	if len(records) == 0 {
+		return "No pending captchas in this chat."
+	}
+	lines := []string{fmt.Sprintf("*Pending captchas: %d*", len(records))}
+	for i, record := range records {
+		if i == pendingListLimit {
+			lines = append(lines, fmt.Sprintf("…and %d more.", len(records)-pendingListLimit))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, pendingEntryText(record, now)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func pendingEntryText(record challengestore.Record, now time.Time) string {
+	status := record.Status
+	parts := []string{modlogMention(status.UserID, status.UserFullName)}
+	switch {
+	case status.JoinRequest:
+		parts = append(parts, "join request")
+	case status.ManualChallenge:
+		parts = append(parts, "test")
+	}
+
+	if remaining := record.ExpiresAt.Sub(now); remaining > 0 {
+		parts = append(parts, remaining.Round(time.Second).String()+" left")
+	} else {
+		parts = append(parts, "expiring")
+	}
+
+	if len(status.CaptchaAnswer) == 0 {
+		parts = append(parts, "prompt not opened")
+	} else {
+		parts = append(parts, fmt.Sprintf("solved %d/%d", status.SolvedCaptcha, len(status.CaptchaAnswer)))
+	}
+	parts = append(parts, fmt.Sprintf("failed %d", status.FailCaptcha))
+	return strings.Join(parts, " · ")
+}
+
+// pendingListMarkup adds an approve, reject and re-issue button per listed
+// record, labelled with its number in pendingListText.
+func pendingListMarkup(records []challengestore.Record) *tele.ReplyMarkup {
+	if len(records) == 0 {
+		return nil
+	}
+	markup := &tele.ReplyMarkup{}
+	for i, record := range records {
+		if i == pendingListLimit {
+			break
+		}
+		data := strconv.FormatInt(record.Status.ChatID, 10) + "|" + strconv.FormatInt(record.Status.UserID, 10)
+		n := strconv.Itoa(i + 1)
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []tele.InlineButton{
+			{Unique: pendingApproveUnique, Text: "✅ Approve " + n, Data: data},
+			{Unique: pendingRejectUnique, Text: "⛔ Reject " + n, Data: data},
+			{Unique: pendingReissueUnique, Text: "🔄 Re-issue " + n, Data: data},
+		})
+	}
+	return markup
+}
+
+func onPending(c tele.Context) error {
+	if !allowAdminGroupCommand(c, "pending") {
+		return nil
+	}
+
+	records := pendingChallengesForChat(db.List(), c.Chat().ID)
+	logging.Info("pending_listed", "chat_id", c.Chat().ID, "user_id", c.Sender().ID, "pending", len(records))
+	if _, err := sendWithConfiguredTopic(c.Chat(), pendingListText(records, time.Now()), tele.ModeMarkdown, pendingListMarkup(records)); err != nil {
+		logging.Warn("failed_to_send_pending_response", "chat_id", c.Chat().ID, "user_id", c.Sender().ID, "err", err)
+	}
+	return nil
+}
+
+func onPendingApprove(c tele.Context) error {
+	return handlePendingButton(c, "approve", func(kvID string, status captcha.JoinStatus, found bool) (string, error) {
+		if err := approveCommand.apply(c.Chat(), status.UserID); err != nil {
+			return "", err
+		}
+		postModerationRecord(moderationRecord{
+			event:     modlogApproved,
+			chat:      c.Chat(),
+			userID:    status.UserID,
+			userName:  status.UserFullName,
+			actorID:   c.Sender().ID,
+			actorName: userDisplayName(c.Sender()),
+		})
+		return "Approved.", nil
+	})
+}
+
+func onPendingReject(c tele.Context) error {
+	return handlePendingButton(c, "reject", func(kvID string, status captcha.JoinStatus, found bool) (string, error) {
+		if !found {
+			return "This captcha is no longer pending.", nil
+		}
+		failCaptchaChallenge(kvID, status, c.Chat(), "admin_rejected", c.Sender())
+		return "Rejected.", nil
+	})
+}
+
+func onPendingReissue(c tele.Context) error {
+	return handlePendingButton(c, "reissue", func(kvID string, status captcha.JoinStatus, found bool) (string, error) {
+		if !found {
+			return "This captcha is no longer pending.", nil
+		}
+		if err := reissuePendingChallenge(kvID, status, c.Sender()); err != nil {
+			return "", err
+		}
+		return "New captcha issued.", nil
+	})
+}
+
+// handlePendingButton checks that an admin pressed a /pending button in the
+// group it lists, which must still be allowed to run /pending, runs apply
+// for the pending challenge it names and refreshes the list. apply returns
+// the text shown to the admin.
+func handlePendingButton(c tele.Context, name string, apply func(kvID string, status captcha.JoinStatus, found bool) (string, error)) error {
+	if c == nil || c.Chat() == nil || c.Callback() == nil || c.Sender() == nil {
+		return nil
+	}
+	if !allowAdminGroupChat(c, "pending_"+name) {
+		return c.Respond(&tele.CallbackResponse{Text: "This chat is not allowed to use this button.", ShowAlert: true})
+	}
+	if !isSenderAllowed(c) {
+		logAccessDenied(c, "pending_"+name)
+		return c.Respond(&tele.CallbackResponse{Text: "Only configured bot admins can use this button.", ShowAlert: true})
+	}
+
+	chatID, userID, err := parseModlogButtonData(c.Args())
+	if err != nil || chatID != c.Chat().ID {
+		logging.Warn("pending_button_rejected", "button", name, "chat_id", c.Chat().ID, "user_id", c.Sender().ID, "err", err)
+		return c.Respond(&tele.CallbackResponse{Text: "This button is no longer valid."})
+	}
+
+	kvID := challengestore.Key(userID, chatID)
+	status, found := db.Get(kvID)
+	if !found {
+		status = captcha.JoinStatus{UserID: userID, ChatID: chatID}
+	}
+	text, err := apply(kvID, status, found)
+	if err != nil {
+		logging.Warn("failed_to_apply_pending_button", "button", name, "chat_id", chatID, "user_id", userID, "actor_user_id", c.Sender().ID, "err", err)
+		return c.Respond(&tele.CallbackResponse{Text: "Failed: " + err.Error(), ShowAlert: true})
+	}
+	logging.Info("pending_button_applied", "button", name, "chat_id", chatID, "user_id", userID, "actor_user_id", c.Sender().ID, "was_pending", found)
+
+	records := pendingChallengesForChat(db.List(), chatID)
+	if _, err := bot.Edit(c.Message(), pendingListText(records, time.Now()), tele.ModeMarkdown, pendingListMarkup(records)); err != nil {
+		logging.Warn("failed_to_refresh_pending_list", "chat_id", chatID, "message_id", c.Message().ID, "err", err)
+	}
+	return c.Respond(&tele.CallbackResponse{Text: text})
+}
+
+// reissuePendingChallenge posts a new puzzle for the challenge under kvID,
+// keeping its failure count and first issue time, and restarts its
+// expiration and the captcha restriction. The old captcha message is only
+// deleted once the new one is sent.
+func reissuePendingChallenge(kvID string, status captcha.JoinStatus, actor *tele.User) error {
+	previous := status.CaptchaMessage
+	reissued, err := reissueCaptchaChallenge(captchaTargetChat(status), status)
+	if err != nil {
+		// Keep the old message and deadline so the user can still answer
+		// and the timeout action still fires.
+		return err
+	}
+	group := captchaGroupChat(status)
+	policy := policyForChat(group)
+	if err := db.Set(kvID, reissued, policy.Expiration); err != nil {
+		logging.Warn("failed_to_persist_reissued_captcha_state", "chat_id", status.ChatID, "user_id", status.UserID, "err", err)
+	}
+	armGroupDeliveryFallback(kvID, reissued, policy.Expiration)
+
+	if previous.ID > 0 && previous.ID != reissued.CaptchaMessage.ID {
+		if err := bot.Delete(&previous); err != nil {
+			logging.Warn("failed_to_delete_reissued_captcha_message", "chat_id", status.ChatID, "user_id", status.UserID, "message_id", previous.ID, "err", err)
+		}
+	}
+
+	if !status.JoinRequest && !status.ManualChallenge {
+		member := &tele.ChatMember{User: &tele.User{ID: status.UserID}}
+		applyCaptchaRestriction(member, policy.Expiration)
+		if err := restrictMember(group, member); err != nil {
+			logging.Warn("failed_to_refresh_user_restriction_window", "chat_id", status.ChatID, "user_id", status.UserID, "err", err)
+		}
+	}
+	logging.Info("captcha_reissued_by_admin", "chat_id", status.ChatID, "user_id", status.UserID, "actor_user_id", actor.ID, "challenge_message_id", reissued.CaptchaMessage.ID)
+	return nil
+}
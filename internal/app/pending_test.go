@@ -0,0 +1,149 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/challengestore"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+func TestPendingChallengesForChat(t *testing.T) {
+	t.Parallel()
+
+	records := []challengestore.Record{
+		{Key: "1--100", Status: captcha.JoinStatus{UserID: 1, ChatID: -100}},
+		{Key: "2--200", Status: captcha.JoinStatus{UserID: 2, ChatID: -200}},
+		{Key: "3--100", Status: captcha.JoinStatus{UserID: 3, ChatID: -100}},
+	}
+	got := pendingChallengesForChat(records, -100)
+	if len(got) != 2 || got[0].Key != "1--100" || got[1].Key != "3--100" {
+		t.Fatalf("pendingChallengesForChat() = %+v, want records 1--100 and 3--100", got)
+	}
+	if got := pendingChallengesForChat(records, -300); len(got) != 0 {
+		t.Fatalf("pendingChallengesForChat() for unknown chat = %+v, want none", got)
+	}
+}
+
+func TestPendingListText(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	records := []challengestore.Record{
+		{
+			Status: captcha.JoinStatus{
+				UserID:        42,
+				ChatID:        -100,
+				UserFullName:  "Jane Doe",
+				CaptchaAnswer: []string{"a", "b", "c", "d"},
+				SolvedCaptcha: 1,
+				FailCaptcha:   1,
+			},
+			ExpiresAt: now.Add(45*time.Second + 400*time.Millisecond),
+		},
+		{
+			Status:    captcha.JoinStatus{UserID: 43, ChatID: -100, JoinRequest: true},
+			ExpiresAt: now.Add(-time.Second),
+		},
+	}
+
+	want := "*Pending captchas: 2*\n" +
+		"1. [Jane Doe](tg://user?id=42) (`42`) · 45s left · solved 1/4 · failed 1\n" +
+		"2. [user](tg://user?id=43) (`43`) · join request · expiring · prompt not opened · failed 0"
+	if got := pendingListText(records, now); got != want {
+		t.Fatalf("pendingListText() =\n%s\nwant\n%s", got, want)
+	}
+	if got := pendingListText(nil, now); got != "No pending captchas in this chat." {
+		t.Fatalf("pendingListText(nil) = %q", got)
+	}
+}
+
+func TestPendingListLimit(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	records := make([]challengestore.Record, pendingListLimit+3)
+	for i := range records {
+		records[i] = challengestore.Record{
+			Status:    captcha.JoinStatus{UserID: int64(i + 1), ChatID: -100},
+			ExpiresAt: now.Add(time.Minute),
+		}
+	}
+
+	text := pendingListText(records, now)
+	if !strings.HasSuffix(text, "\n…and 3 more.") {
+		t.Fatalf("pendingListText() does not end with the overflow line:\n%s", text)
+	}
+	markup := pendingListMarkup(records)
+	if len(markup.InlineKeyboard) != pendingListLimit {
+		t.Fatalf("pendingListMarkup() rows = %d, want %d", len(markup.InlineKeyboard), pendingListLimit)
+	}
+
+	row := markup.InlineKeyboard[0]
+	uniques := []string{pendingApproveUnique, pendingRejectUnique, pendingReissueUnique}
+	for i, button := range row {
+		if button.Unique != uniques[i] || button.Data != "-100|1" || !strings.HasSuffix(button.Text, " 1") {
+			t.Fatalf("button %d = %+v, want unique %q, data -100|1 and label number 1", i, button, uniques[i])
+		}
+	}
+	if pendingListMarkup(nil) != nil {
+		t.Fatal("pendingListMarkup(nil) returned a keyboard")
+	}
+}
+
+func TestHandlePendingButtonRejectsUnauthorizedChat(t *testing.T) {
+	origCfg := cfg
+	origBot := bot
+	t.Cleanup(func() {
+		cfg = origCfg
+		bot = origBot
+	})
+	bot = nil
+
+	config := settings.DefaultRuntimeConfig()
+	config.Bot.AdminUserIDs = []int64{1001}
+	config.Groups = []settings.GroupTopicConfig{{ID: "@somegroup"}}
+	cfg = mustValidatedRuntimeConfig(t, config)
+
+	var methods []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, path.Base(r.URL.Path))
+		fmt.Fprint(w, `{"ok":true,"result":true}`)
+	}))
+	t.Cleanup(api.Close)
+	b, err := tele.NewBot(tele.Settings{URL: api.URL, Token: "test-token", Offline: true})
+	if err != nil {
+		t.Fatalf("NewBot returned error: %v", err)
+	}
+
+	// A /pending list left behind in a group removed from groups.
+	removed := &tele.Chat{ID: -1009, Type: tele.ChatSuperGroup, Username: "removedgroup"}
+	c := b.NewContext(tele.Update{Callback: &tele.Callback{
+		ID:      "1",
+		Sender:  &tele.User{ID: 1001},
+		Message: &tele.Message{ID: 5, Chat: removed},
+		Data:    "-1009|42",
+	}})
+
+	applied := false
+	err = handlePendingButton(c, "approve", func(string, captcha.JoinStatus, bool) (string, error) {
+		applied = true
+		return "Approved.", nil
+	})
+	if err != nil {
+		t.Fatalf("handlePendingButton returned error: %v", err)
+	}
+	if applied {
+		t.Fatal("button was applied in a chat that is no longer allowed")
+	}
+	if len(methods) != 1 || methods[0] != "answerCallbackQuery" {
+		t.Fatalf("Bot API calls = %v, want one answerCallbackQuery", methods)
+	}
+}
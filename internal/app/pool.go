@@ -0,0 +1,166 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"toshiki-captcha-bot/internal/logging"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+// challengePoolRetryDelay throttles the pool worker after a failed render so
+// a broken asset pack does not turn into a busy loop.
+const challengePoolRetryDelay = 5 * time.Second
+
+var (
+	// challenges holds pre-rendered challenges when captcha.pool_size is
+	// set. It is nil when pooling is disabled.
+	challenges   *challengePool
+	challengesMu sync.RWMutex
+)
+
+// challengePool keeps up to size rendered challenges per challenge type so
+// joins do not pay for image rendering while a worker refills it in the
+// background.
+type challengePool struct {
+	ready map[string]chan captchaChallenge
+	build func(kind string) (captchaChallenge, error)
+	wake  chan struct{}
+
+	quit     chan struct{}
+	quitOnce sync.Once
+}
+
+func newChallengePool(kinds []string, size int, build func(kind string) (captchaChallenge, error)) *challengePool {
+	pool := &challengePool{
+		ready: make(map[string]chan captchaChallenge, len(kinds)),
+		build: build,
+		wake:  make(chan struct{}, 1),
+		quit:  make(chan struct{}),
+	}
+	for _, kind := range kinds {
+		pool.ready[kind] = make(chan captchaChallenge, size)
+	}
+	return pool
+}
+
+// take returns a pre-rendered challenge of kind without blocking. ok is false
+// when the pool has none ready.
+func (p *challengePool) take(kind string) (captchaChallenge, bool) {
+	if p == nil {
+		return captchaChallenge{}, false
+	}
+	ready, exists := p.ready[kind]
+	if !exists {
+		return captchaChallenge{}, false
+	}
+
+	select {
+	case challenge := <-ready:
+		p.signal()
+		return challenge, true
+	default:
+		p.signal()
+		return captchaChallenge{}, false
+	}
+}
+
+func (p *challengePool) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// fill renders challenges until every type is full or stop closes. It
+// returns false when a render failed.
+func (p *challengePool) fill(stop <-chan struct{}) bool {
+	for kind, ready := range p.ready {
+		for len(ready) < cap(ready) {
+			select {
+			case <-stop:
+				return true
+			default:
+			}
+
+			challenge, err := p.build(kind)
+			if err != nil {
+				logging.Warn("failed_to_pre_render_captcha_challenge", "type", kind, "err", err)
+				return false
+			}
+			select {
+			case ready <- challenge:
+			default:
+			}
+		}
+	}
+	return true
+}
+
+// run keeps the pool full until stop closes.
+func (p *challengePool) run(stop <-chan struct{}) {
+	for {
+		if !p.fill(stop) {
+			select {
+			case <-stop:
+				return
+			case <-time.After(challengePoolRetryDelay):
+			}
+			continue
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-p.wake:
+		}
+	}
+}
+
+// stop ends the worker of p. Challenges already rendered stay takeable.
+func (p *challengePool) stop() {
+	if p == nil {
+		return
+	}
+	p.quitOnce.Do(func() {
+		close(p.quit)
+	})
+}
+
+// currentChallengePool returns the active pool, or nil when pooling is
+// disabled.
+func currentChallengePool() *challengePool {
+	challengesMu.RLock()
+	defer challengesMu.RUnlock()
+	return challenges
+}
+
+// startChallengePool replaces the active pool with one built for config and
+// starts its pre-render worker when captcha.pool_size is set. The worker
+// stops once shutdown begins or the pool is replaced.
+func startChallengePool(config settings.RuntimeConfig) {
+	var pool *challengePool
+	if config.Captcha.PoolSize > 0 {
+		kinds := config.ChallengeTypes()
+		captchaConfig := config.Captcha
+		pool = newChallengePool(kinds, captchaConfig.PoolSize, func(kind string) (captchaChallenge, error) {
+			return buildCaptchaChallenge(kind, captchaConfig)
+		})
+		stop := make(chan struct{})
+		go func() {
+			select {
+			case <-shutdownRequested:
+			case <-pool.quit:
+			}
+			close(stop)
+		}()
+		go pool.run(stop)
+		logging.Info("challenge_pool_started", "size", captchaConfig.PoolSize, "types", kinds)
+	}
+
+	challengesMu.Lock()
+	previous := challenges
+	challenges = pool
+	challengesMu.Unlock()
+	previous.stop()
+}
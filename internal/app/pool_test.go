@@ -0,0 +1,122 @@
+package app
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"toshiki-captcha-bot/internal/captcha"
+)
+
+func countingChallengeBuilder(builds *int32) func(kind string) (captchaChallenge, error) {
+	return func(kind string) (captchaChallenge, error) {
+		atomic.AddInt32(builds, 1)
+		return captchaChallenge{Type: kind}, nil
+	}
+}
+
+func TestChallengePoolTake(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil pool is empty", func(t *testing.T) {
+		t.Parallel()
+
+		var pool *challengePool
+		if _, ok := pool.take(captcha.TypeEmojiSequence); ok {
+			t.Fatalf("take on nil pool returned a challenge")
+		}
+	})
+
+	t.Run("unknown type is empty", func(t *testing.T) {
+		t.Parallel()
+
+		var builds int32
+		pool := newChallengePool([]string{captcha.TypeEmojiSequence}, 2, countingChallengeBuilder(&builds))
+		pool.fill(nil)
+		if _, ok := pool.take(captcha.TypeArithmetic); ok {
+			t.Fatalf("take returned a challenge for an unpooled type")
+		}
+	})
+
+	t.Run("fill then drain", func(t *testing.T) {
+		t.Parallel()
+
+		var builds int32
+		kinds := []string{captcha.TypeEmojiSequence, captcha.TypeOddOneOut}
+		pool := newChallengePool(kinds, 3, countingChallengeBuilder(&builds))
+		if !pool.fill(nil) {
+			t.Fatalf("fill reported failure")
+		}
+		if got := atomic.LoadInt32(&builds); got != 6 {
+			t.Fatalf("builds = %d, want 6", got)
+		}
+
+		for i := 0; i < 3; i++ {
+			challenge, ok := pool.take(captcha.TypeOddOneOut)
+			if !ok {
+				t.Fatalf("take %d returned no challenge", i)
+			}
+			if challenge.Type != captcha.TypeOddOneOut {
+				t.Fatalf("challenge type = %q, want %q", challenge.Type, captcha.TypeOddOneOut)
+			}
+		}
+		if _, ok := pool.take(captcha.TypeOddOneOut); ok {
+			t.Fatalf("take on drained type returned a challenge")
+		}
+		if len(pool.ready[captcha.TypeEmojiSequence]) != 3 {
+			t.Fatalf("other type lost challenges, ready=%d", len(pool.ready[captcha.TypeEmojiSequence]))
+		}
+	})
+}
+
+func TestChallengePoolFillReportsBuildFailure(t *testing.T) {
+	t.Parallel()
+
+	pool := newChallengePool([]string{captcha.TypeEmojiSequence}, 2, func(string) (captchaChallenge, error) {
+		return captchaChallenge{}, errors.New("render failed")
+	})
+	if pool.fill(nil) {
+		t.Fatalf("fill reported success after build failure")
+	}
+}
+
+func TestChallengePoolRunRefillsUntilStopped(t *testing.T) {
+	t.Parallel()
+
+	var builds int32
+	pool := newChallengePool([]string{captcha.TypeEmojiSequence}, 2, countingChallengeBuilder(&builds))
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		pool.run(stop)
+		close(done)
+	}()
+
+	waitForPool := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for len(pool.ready[captcha.TypeEmojiSequence]) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("pool ready = %d, want %d", len(pool.ready[captcha.TypeEmojiSequence]), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	waitForPool(2)
+	if _, ok := pool.take(captcha.TypeEmojiSequence); !ok {
+		t.Fatalf("take returned no challenge from full pool")
+	}
+	waitForPool(2)
+	if got := atomic.LoadInt32(&builds); got != 3 {
+		t.Fatalf("builds = %d, want 3", got)
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("run did not return after stop")
+	}
+}
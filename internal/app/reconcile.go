@@ -0,0 +1,177 @@
+package app
+
+import (
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/challengestore"
+	"toshiki-captcha-bot/internal/logging"
+)
+
+type reconcileAction int
+
+const (
+	reconcileReissue reconcileAction = iota
+	reconcileTimeout
+	reconcileRelease
+)
+
+func (a reconcileAction) String() string {
+	switch a {
+	case reconcileReissue:
+		return "reissue"
+	case reconcileTimeout:
+		return "timeout"
+	case reconcileRelease:
+		return "release"
+	default:
+		return "unknown"
+	}
+}
+
+type reconcileSummary struct {
+	Pending       int
+	Reissued      int
+	TimedOut      int
+	Released      int
+	StaleDeleted  int
+	ReissueFailed int
+}
+
+func classifyPendingChallenge(record challengestore.Record, now time.Time) reconcileAction {
+	if record.Status.IsSolved() {
+		return reconcileRelease
+	}
+	if !record.ExpiresAt.After(now) {
+		return reconcileTimeout
+	}
+	return reconcileReissue
+}
+
+// reconcilePendingChallenges resolves challenges left behind by a previous
+// run. Every unsolved challenge is restored into the store with one flush
+// before any Telegram call, so a crash part way through loses nothing.
+// Stale challenge photos are deleted because their inline keyboard belongs
+// to a puzzle the user can no longer see the answer for. Users whose window
+// is still open get a fresh challenge bound to the original deadline, users
+// whose window elapsed during downtime get the regular timeout action from
+// the store janitor, and challenges solved right before shutdown are
+// released.
+func reconcilePendingChallenges(records []challengestore.Record) {
+	if len(records) == 0 || db == nil {
+		return
+	}
+
+	now := time.Now()
+	summary := reconcileSummary{Pending: len(records)}
+	unsolved := make([]challengestore.Record, 0, len(records))
+	for _, record := range records {
+		if classifyPendingChallenge(record, now) != reconcileRelease {
+			unsolved = append(unsolved, record)
+		}
+	}
+	if err := db.RestoreAll(unsolved); err != nil {
+		logging.Warn("failed_to_restore_pending_captcha_state", "pending", len(unsolved), "err", err)
+	}
+
+	for _, record := range records {
+		status := record.Status
+		action := classifyPendingChallenge(record, now)
+
+		switch action {
+		case reconcileRelease:
+			if deleteStaleCaptchaMessage(&status, action) {
+				summary.StaleDeleted++
+			}
+			if status.JoinRequest {
+				resolveJoinRequest(status, true, "solved_before_restart")
+			} else if !status.ManualChallenge {
+				releaseCaptchaRestriction(captchaGroupChat(status), &tele.User{ID: status.UserID})
+			}
+			summary.Released++
+		case reconcileTimeout:
+			// The janitor evicts the restored record, deleting its message
+			// and applying the timeout action.
+			summary.TimedOut++
+		case reconcileReissue:
+			if deleteStaleCaptchaMessage(&status, action) {
+				summary.StaleDeleted++
+			}
+			reissued, err := reissueCaptchaChallenge(captchaTargetChat(status), status)
+			if err != nil {
+				logging.Warn("failed_to_reissue_captcha_on_startup", "chat_id", status.ChatID, "user_id", status.UserID, "err", err)
+				// Keep the deadline armed so the timeout action still fires.
+				reissued = status
+				summary.ReissueFailed++
+			} else {
+				summary.Reissued++
+			}
+			if err := db.Update(record.Key, reissued); err != nil {
+				logging.Warn("failed_to_persist_reconciled_captcha_state", "chat_id", status.ChatID, "user_id", status.UserID, "err", err)
+			}
+			armGroupDeliveryFallback(record.Key, reissued, record.ExpiresAt.Sub(now))
+		}
+	}
+
+	if err := db.Flush(); err != nil {
+		logging.Warn("failed_to_persist_reconciled_captcha_state", "err", err)
+	}
+	logging.Info(
+		"startup_reconciliation_completed",
+		"pending", summary.Pending,
+		"reissued", summary.Reissued,
+		"timed_out", summary.TimedOut,
+		"released", summary.Released,
+		"stale_messages_deleted", summary.StaleDeleted,
+		"reissue_failed", summary.ReissueFailed,
+	)
+}
+
+func captchaTargetChat(status captcha.JoinStatus) *tele.Chat {
+	if status.CaptchaMessage.Chat != nil {
+		return status.CaptchaMessage.Chat
+	}
+	return &tele.Chat{ID: status.ChatID}
+}
+
+func deleteStaleCaptchaMessage(status *captcha.JoinStatus, action reconcileAction) bool {
+	if status == nil || status.CaptchaMessage.ID <= 0 || bot == nil {
+		return false
+	}
+	messageID := status.CaptchaMessage.ID
+	if err := bot.Delete(&status.CaptchaMessage); err != nil {
+		logging.Warn("failed_to_delete_stale_captcha_message", "chat_id", status.ChatID, "user_id", status.UserID, "message_id", messageID, "action", action, "err", err)
+		return false
+	}
+	status.CaptchaMessage.ID = 0
+	return true
+}
+
+// reissueCaptchaChallenge sends a brand new puzzle for an existing pending
+// status while keeping its failure count.
+func reissueCaptchaChallenge(chat *tele.Chat, status captcha.JoinStatus) (captcha.JoinStatus, error) {
+	if status.StartToken != "" {
+		// The challenge was never opened; post the deep link prompt again.
+		msg, err := sendCaptchaPrompt(chat, &tele.User{ID: status.UserID, FirstName: status.UserFullName}, status.StartToken, policyForChat(chat))
+		if err != nil {
+			return status, err
+		}
+		status.CaptchaMessage = *msg
+		return status, nil
+	}
+
+	challenge, err := buildCaptchaChallengeForChat(captchaGroupChat(status))
+	if err != nil {
+		return status, err
+	}
+
+	user := &tele.User{ID: status.UserID, FirstName: status.UserFullName}
+	msg, err := sendCaptchaChallenge(chat, challenge.ImageBytes, genCaptionForStatus(user, challenge.Type, status), challenge.Markup)
+	if err != nil {
+		return status, err
+	}
+
+	applyCaptchaChallenge(&status, challenge, *msg)
+	return status, nil
+}
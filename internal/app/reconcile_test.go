@@ -0,0 +1,80 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/challengestore"
+)
+
+func TestClassifyPendingChallenge(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	tests := []struct {
+		name   string
+		record challengestore.Record
+		want   reconcileAction
+	}{
+		{
+			name: "open window is reissued",
+			record: challengestore.Record{
+				Status:    captcha.JoinStatus{CaptchaAnswer: []string{"u1", "u2"}, SolvedCaptcha: 1},
+				ExpiresAt: now.Add(time.Minute),
+			},
+			want: reconcileReissue,
+		},
+		{
+			name: "elapsed window times out",
+			record: challengestore.Record{
+				Status:    captcha.JoinStatus{CaptchaAnswer: []string{"u1", "u2"}},
+				ExpiresAt: now.Add(-time.Second),
+			},
+			want: reconcileTimeout,
+		},
+		{
+			name: "deadline equal to now times out",
+			record: challengestore.Record{
+				Status:    captcha.JoinStatus{CaptchaAnswer: []string{"u1"}},
+				ExpiresAt: now,
+			},
+			want: reconcileTimeout,
+		},
+		{
+			name: "solved challenge is released even after deadline",
+			record: challengestore.Record{
+				Status:    captcha.JoinStatus{CaptchaAnswer: []string{"u1", "u2"}, SolvedCaptcha: 2},
+				ExpiresAt: now.Add(-time.Minute),
+			},
+			want: reconcileRelease,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := classifyPendingChallenge(tt.record, now); got != tt.want {
+				t.Fatalf("classifyPendingChallenge() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptchaTargetChat(t *testing.T) {
+	t.Parallel()
+
+	bound := &tele.Chat{ID: -100123, Username: "somegroup"}
+	got := captchaTargetChat(captcha.JoinStatus{ChatID: -100123, CaptchaMessage: tele.Message{Chat: bound}})
+	if got != bound {
+		t.Fatalf("captchaTargetChat() = %+v, want bound message chat", got)
+	}
+
+	got = captchaTargetChat(captcha.JoinStatus{ChatID: -100456})
+	if got == nil || got.ID != -100456 {
+		t.Fatalf("captchaTargetChat() = %+v, want chat id -100456", got)
+	}
+}
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/assets"
+	"toshiki-captcha-bot/internal/logging"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+var (
+	// cfgMu guards cfg, which a reload swaps while handlers are reading it.
+	cfgMu sync.RWMutex
+	// reloadMu keeps a SIGHUP and a /reload from applying at the same time.
+	reloadMu sync.Mutex
+
+	configPath = settings.DefaultConfigPath
+)
+
+// restartOnlySettings are read once at startup. A reload records their new
+// values but they only take effect after a restart.
+var restartOnlySettings = []string{
+	"bot.token",
+	"bot.token_file",
+	"bot.poll_timeout",
+	"bot.request_timeout",
+	"bot.mode",
+	"bot.webhook",
+	"captcha.store",
+	"captcha.cleanup_interval",
+	"admin_server.listen",
+	"metrics",
+}
+
+// currentConfig returns the runtime config in effect. Handlers take one
+// snapshot per update so a concurrent reload cannot mix two configs.
+func currentConfig() settings.RuntimeConfig {
+	cfgMu.RLock()
+	defer cfgMu.RUnlock()
+	return cfg
+}
+
+// setConfig installs next as the runtime config and returns the previous one.
+func setConfig(next settings.RuntimeConfig) settings.RuntimeConfig {
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
+	previous := cfg
+	cfg = next
+	return previous
+}
+
+// reloadConfig loads and validates the config file again and swaps it in.
+// An invalid file or an unusable asset pack is rejected and the running
+// config stays in effect.
+func reloadConfig(trigger string) ([]settings.Change, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	next, err := settings.Load(configPath)
+	if err != nil {
+		logging.Warn("config_reload_rejected", "path", configPath, "trigger", trigger, "err", err)
+		return nil, err
+	}
+	pack, err := loadConfiguredAssetPack(next)
+	if err != nil {
+		logging.Warn("config_reload_rejected", "path", configPath, "trigger", trigger, "err", err)
+		return nil, err
+	}
+
+	previous := setConfig(next)
+	changes := settings.Diff(previous, next)
+	for _, change := range changes {
+		logging.Info("config_setting_changed", "change", change.String(), "restart_required", requiresRestart(change.Path))
+	}
+	applyConfigChanges(next, pack, changes)
+	logging.Info("config_reloaded", "path", configPath, "trigger", trigger, "changes", len(changes))
+	return changes, nil
+}
+
+// applyConfigChanges rebuilds the state derived from the settings in changes.
+// pack is the asset pack already loaded for config.
+func applyConfigChanges(config settings.RuntimeConfig, pack *assets.Pack, changes []settings.Change) {
+	if changedUnder(changes, "logging") {
+		configureLogging(config)
+	}
+	if changedUnder(changes, "assets", "captcha.answer_count", "captcha.decoy_count") {
+		useAssetPack(pack)
+	}
+	if changedUnder(changes, "assets", "captcha", "groups") {
+		startChallengePool(config)
+	}
+	if commandScopesChanged(changes) {
+		syncBotCommands(bot)
+	}
+}
+
+// commandScopesChanged reports whether admin command scopes depend on any of
+// changes: the admin list or the set of groups.
+func commandScopesChanged(changes []settings.Change) bool {
+	for _, change := range changes {
+		if change.Path == "bot.admin_user_ids" {
+			return true
+		}
+		if strings.HasPrefix(change.Path, "groups[") && !strings.Contains(change.Path, "].") {
+			return true
+		}
+	}
+	return false
+}
+
+func changedUnder(changes []settings.Change, prefixes ...string) bool {
+	for _, change := range changes {
+		for _, prefix := range prefixes {
+			if settingUnder(change.Path, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func settingUnder(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+".") || strings.HasPrefix(path, prefix+"[")
+}
+
+func requiresRestart(path string) bool {
+	for _, prefix := range restartOnlySettings {
+		if settingUnder(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func reloadResultText(changes []settings.Change, err error) string {
+	if err != nil {
+		return fmt.Sprintf("Config reload rejected, the current config stays in effect:\n%v", err)
+	}
+	if len(changes) == 0 {
+		return "Config reloaded, nothing changed."
+	}
+
+	lines := []string{fmt.Sprintf("Config reloaded, %d change(s):", len(changes))}
+	for _, change := range changes {
+		line := "- " + change.String()
+		if requiresRestart(change.Path) {
+			line += " (takes effect after restart)"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func onReload(c tele.Context) error {
+	chatID, userID := commandContextIDs(c)
+	logging.Info("reload_requested", "chat_id", chatID, "user_id", userID)
+	if c == nil || c.Chat() == nil {
+		logging.Warn("reload_skipped", "reason", "missing_chat_context", "user_id", userID)
+		return nil
+	}
+	if leaveIfUnsupportedPrivateGroup(c.Chat(), "reload") {
+		return nil
+	}
+	if !isAllowedCommandChat(c.Chat()) {
+		logAccessDenied(c, "reload_chat_not_allowed")
+		if isGroupChat(c.Chat()) {
+			leaveChat(c.Chat(), "unauthorized_group")
+		}
+		return nil
+	}
+	if !isSenderAllowed(c) {
+		logAccessDenied(c, "reload_sender_not_allowed")
+		respondAdminOnlyCommandDenied(c, "/reload")
+		return nil
+	}
+
+	changes, err := reloadConfig("command")
+	if _, err := sendWithConfiguredTopic(c.Chat(), reloadResultText(changes, err), tele.ModeDefault, nil); err != nil {
+		logging.Warn("failed_to_send_reload_response", "chat_id", chatID, "user_id", userID, "err", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"toshiki-captcha-bot/internal/settings"
+)
+
+func TestReloadConfig(t *testing.T) {
+	origCfg, origPath, origBot := cfg, configPath, bot
+	t.Cleanup(func() {
+		cfg, configPath, bot = origCfg, origPath, origBot
+		startChallengePool(settings.DefaultRuntimeConfig())
+	})
+	bot = nil
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	configPath = path
+	writeConfig := func(raw string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(raw), 0o600); err != nil {
+			t.Fatalf("WriteFile returned error: %v", err)
+		}
+	}
+
+	writeConfig("bot:\n  token: \"test-token\"\ncaptcha:\n  expiration: 1m\n")
+	initial, err := settings.Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	setConfig(initial)
+
+	writeConfig("bot:\n  token: \"test-token\"\ncaptcha:\n  expiration: 2m\n")
+	changes, err := reloadConfig("test")
+	if err != nil {
+		t.Fatalf("reloadConfig returned error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].String() != "captcha.expiration: 1m0s -> 2m0s" {
+		t.Fatalf("reloadConfig changes = %v, want captcha.expiration only", changes)
+	}
+	if got := currentConfig().Captcha.Expiration; got != 2*time.Minute {
+		t.Fatalf("expiration after reload = %s, want 2m", got)
+	}
+
+	writeConfig("bot:\n  token: \"test-token\"\ncaptcha:\n  expiration: 5m\n  max_failures: -1\n")
+	if _, err := reloadConfig("test"); err == nil {
+		t.Fatalf("reloadConfig expected error for invalid config")
+	}
+	if got := currentConfig().Captcha.Expiration; got != 2*time.Minute {
+		t.Fatalf("expiration after rejected reload = %s, want 2m", got)
+	}
+
+	writeConfig("bot:\n  token: \"test-token\"\ncaptcha:\n  expiration: 5m\nassets:\n  dir: missing\n")
+	if _, err := reloadConfig("test"); err == nil || !strings.Contains(err.Error(), "assets.dir") {
+		t.Fatalf("reloadConfig error = %v, want assets.dir error", err)
+	}
+	if got := currentConfig(); got.Captcha.Expiration != 2*time.Minute || got.Assets.Dir != "" {
+		t.Fatalf("config after rejected asset reload = %s %q, want 2m and no assets.dir", got.Captcha.Expiration, got.Assets.Dir)
+	}
+}
+
+func TestCommandScopesChanged(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "bot.admin_user_ids", want: true},
+		{path: "groups[@newgroup]", want: true},
+		{path: "groups[@somegroup].topic", want: false},
+		{path: "captcha.expiration", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := commandScopesChanged([]settings.Change{{Path: tt.path}}); got != tt.want {
+			t.Fatalf("commandScopesChanged(%q) = %t, want %t", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestReloadResultText(t *testing.T) {
+	t.Parallel()
+
+	if got := reloadResultText(nil, nil); got != "Config reloaded, nothing changed." {
+		t.Fatalf("reloadResultText(no changes) = %q", got)
+	}
+
+	got := reloadResultText([]settings.Change{
+		{Path: "captcha.expiration", Old: "1m0s", New: "2m0s"},
+		{Path: "bot.mode", Old: "polling", New: "webhook"},
+	}, nil)
+	for _, want := range []string{
+		"2 change(s)",
+		"- captcha.expiration: 1m0s -> 2m0s\n",
+		"- bot.mode: polling -> webhook (takes effect after restart)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("reloadResultText = %q, missing %q", got, want)
+		}
+	}
+
+	got = reloadResultText(nil, errors.New("captcha.max_failures must be greater than zero"))
+	if !strings.Contains(got, "rejected") || !strings.Contains(got, "captcha.max_failures") {
+		t.Fatalf("reloadResultText(error) = %q", got)
+	}
+}
@@ -0,0 +1,230 @@
+package app
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/logging"
+)
+
+var (
+	// inFlight tracks update handlers, eviction callbacks and delayed
+	// cleanup goroutines so shutdown can wait for them to finish.
+	inFlight = newWorkTracker()
+
+	shutdownRequested = make(chan struct{})
+	shutdownOnce      sync.Once
+)
+
+type workTracker struct {
+	mu     sync.Mutex
+	active int
+	idle   chan struct{}
+}
+
+func newWorkTracker() *workTracker {
+	idle := make(chan struct{})
+	close(idle)
+	return &workTracker{idle: idle}
+}
+
+// begin registers one unit of work and returns the func that completes it.
+func (t *workTracker) begin() func() {
+	t.mu.Lock()
+	if t.active == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.active++
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			t.active--
+			if t.active == 0 {
+				close(t.idle)
+			}
+			t.mu.Unlock()
+		})
+	}
+}
+
+// Go runs fn in a tracked goroutine.
+func (t *workTracker) Go(fn func()) {
+	done := t.begin()
+	go func() {
+		defer done()
+		fn()
+	}()
+}
+
+func (t *workTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.active
+}
+
+// wait blocks until no work is active or the timeout elapses, and reports
+// whether all work finished in time.
+func (t *workTracker) wait(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		t.mu.Lock()
+		if t.active == 0 {
+			t.mu.Unlock()
+			return true
+		}
+		idle := t.idle
+		t.mu.Unlock()
+
+		select {
+		case <-idle:
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+// trackedPoller registers every update as in-flight work before handing it
+// to the bot in its own goroutine. The bot runs synchronously, so the
+// handler returns before the work is marked done, and shutdown cannot miss
+// an update that was dispatched but has not started yet.
+type trackedPoller struct {
+	tele.Poller
+}
+
+func (p trackedPoller) Poll(b *tele.Bot, dest chan tele.Update, stop chan struct{}) {
+	updates := make(chan tele.Update, cap(dest))
+	polled := make(chan struct{})
+	go func() {
+		p.Poller.Poll(b, updates, stop)
+		close(polled)
+	}()
+
+	dispatch := func(update tele.Update) {
+		inFlight.Go(func() {
+			b.ProcessUpdate(update)
+		})
+	}
+	for {
+		select {
+		case update := <-updates:
+			dispatch(update)
+		case <-polled:
+			// Hand over whatever the poller queued before it stopped.
+			for {
+				select {
+				case update := <-updates:
+					dispatch(update)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// trackedEviction registers the eviction before running it in its own
+// goroutine. The store calls it on its janitor goroutine, which shutdown
+// stops before draining in-flight work.
+func trackedEviction(key string, status captcha.JoinStatus) {
+	inFlight.Go(func() {
+		onEvicted(key, status)
+	})
+}
+
+func beginShutdown() {
+	shutdownOnce.Do(func() {
+		close(shutdownRequested)
+	})
+}
+
+// sleepUntilShutdown waits for d, returning early once shutdown begins so
+// delayed cleanups run before the process exits.
+func sleepUntilShutdown(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-shutdownRequested:
+	}
+}
+
+// waitForShutdownSignal returns the first shutdown signal, reloading the
+// config for every SIGHUP received before it.
+func waitForShutdownSignal(signals, reloads <-chan os.Signal) os.Signal {
+	for {
+		select {
+		case sig := <-signals:
+			return sig
+		case sig := <-reloads:
+			logging.Info("config_reload_requested", "signal", sig)
+			inFlight.Go(func() {
+				reloadConfig("sighup")
+			})
+		}
+	}
+}
+
+// runUntilShutdown starts update processing and blocks until SIGINT or
+// SIGTERM, then stops the poller and the challenge store janitor, drains
+// in-flight work and flushes the challenge store. A second signal aborts the
+// drain immediately. SIGHUP reloads the config without stopping. The admin
+// server, when set, keeps serving until the drain is over.
+func runUntilShutdown(b *tele.Bot, admin *adminServer) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	defer signal.Stop(reloads)
+
+	stopped := make(chan struct{})
+	go func() {
+		b.Start()
+		close(stopped)
+	}()
+
+	sig := waitForShutdownSignal(signals, reloads)
+	drainTimeout := currentConfig().Bot.ShutdownTimeout
+	logging.Info("shutdown_requested", "signal", sig, "drain_timeout", drainTimeout)
+	go func() {
+		sig := <-signals
+		logging.Warn("shutdown_aborted", "signal", sig, "active_work", inFlight.count())
+		os.Exit(1)
+	}()
+
+	beginShutdown()
+	b.Stop()
+	<-stopped
+	logging.Info("update_processing_stopped")
+	if db != nil {
+		// No eviction may start once the drain below has begun.
+		if err := db.Close(); err != nil {
+			logging.Warn("failed_to_close_challenge_store", "err", err)
+		}
+	}
+
+	if inFlight.wait(drainTimeout) {
+		logging.Info("in_flight_work_drained")
+	} else {
+		logging.Warn("in_flight_work_drain_timed_out", "active_work", inFlight.count(), "drain_timeout", drainTimeout)
+	}
+	admin.stop()
+
+	if db != nil {
+		if err := db.Flush(); err != nil {
+			logging.Warn("failed_to_flush_challenge_store", "err", err)
+		} else {
+			logging.Info("challenge_store_flushed", "pending", len(db.List()))
+		}
+	}
+	logging.Info("shutdown_completed")
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestWorkTrackerWait(t *testing.T) {
+	t.Parallel()
+
+	t.Run("idle tracker returns immediately", func(t *testing.T) {
+		t.Parallel()
+
+		tracker := newWorkTracker()
+		if !tracker.wait(time.Millisecond) {
+			t.Fatalf("wait on idle tracker = false, want true")
+		}
+	})
+
+	t.Run("waits for tracked goroutines", func(t *testing.T) {
+		t.Parallel()
+
+		tracker := newWorkTracker()
+		release := make(chan struct{})
+		finished := make(chan struct{})
+		tracker.Go(func() {
+			<-release
+			close(finished)
+		})
+		if got := tracker.count(); got != 1 {
+			t.Fatalf("active count = %d, want 1", got)
+		}
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+		}()
+		if !tracker.wait(2 * time.Second) {
+			t.Fatalf("wait = false, want true after work completes")
+		}
+		select {
+		case <-finished:
+		default:
+			t.Fatalf("wait returned before tracked work finished")
+		}
+		if got := tracker.count(); got != 0 {
+			t.Fatalf("active count = %d, want 0", got)
+		}
+	})
+
+	t.Run("times out while work is active", func(t *testing.T) {
+		t.Parallel()
+
+		tracker := newWorkTracker()
+		done := tracker.begin()
+		defer done()
+
+		if tracker.wait(20 * time.Millisecond) {
+			t.Fatalf("wait = true, want false while work is active")
+		}
+	})
+
+	t.Run("done is idempotent", func(t *testing.T) {
+		t.Parallel()
+
+		tracker := newWorkTracker()
+		first := tracker.begin()
+		second := tracker.begin()
+		first()
+		first()
+		if got := tracker.count(); got != 1 {
+			t.Fatalf("active count = %d, want 1", got)
+		}
+		second()
+		if !tracker.wait(time.Millisecond) {
+			t.Fatalf("wait = false, want true after all work completed")
+		}
+	})
+}
+
+// queuedPoller delivers its updates and stops without waiting for stop.
+type queuedPoller struct {
+	updates []tele.Update
+}
+
+func (p queuedPoller) Poll(_ *tele.Bot, dest chan tele.Update, _ chan struct{}) {
+	for _, update := range p.updates {
+		dest <- update
+	}
+}
+
+func TestTrackedPollerRegistersUpdatesBeforeDispatch(t *testing.T) {
+	b, err := tele.NewBot(tele.Settings{Offline: true, Synchronous: true})
+	if err != nil {
+		t.Fatalf("NewBot returned error: %v", err)
+	}
+	release := make(chan struct{})
+	b.Handle(tele.OnText, func(c tele.Context) error {
+		<-release
+		return nil
+	})
+
+	before := inFlight.count()
+	poller := trackedPoller{queuedPoller{updates: []tele.Update{
+		{ID: 1, Message: &tele.Message{Text: "hi", Chat: &tele.Chat{ID: 1}, Sender: &tele.User{ID: 2}}},
+	}}}
+	poller.Poll(b, make(chan tele.Update, 1), make(chan struct{}))
+
+	// Poll returned, as it does once the bot stops; the handler may not
+	// have started yet, but its work must already be tracked.
+	if got := inFlight.count(); got != before+1 {
+		t.Fatalf("active count after Poll = %d, want %d", got, before+1)
+	}
+	close(release)
+	if !inFlight.wait(time.Second) {
+		t.Fatalf("wait = false, want true once the handler returned")
+	}
+}
@@ -0,0 +1,26 @@
+package app
+
+import (
+	"toshiki-captcha-bot/internal/challengestore"
+	"toshiki-captcha-bot/internal/logging"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+// openChallengeStore installs the configured challenge store into db and
+// returns the records persisted by a previous run, if any.
+func openChallengeStore() ([]challengestore.Record, error) {
+	config := currentConfig()
+	if config.Captcha.Store != settings.ChallengeStoreFile {
+		db = challengestore.NewMemory(config.Captcha.Expiration, config.Captcha.CleanupInterval)
+		logging.Info("challenge_store_opened", "backend", config.Captcha.Store)
+		return nil, nil
+	}
+
+	records, err := challengestore.Load(challengeStoreStatePath)
+	if err != nil {
+		return nil, err
+	}
+	db = challengestore.NewFile(challengeStoreStatePath, config.Captcha.Expiration, config.Captcha.CleanupInterval)
+	logging.Info("challenge_store_opened", "backend", config.Captcha.Store, "path", challengeStoreStatePath, "persisted", len(records))
+	return records, nil
+}
@@ -0,0 +1,149 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/cli"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+// runSubcommand runs a CLI subcommand that does not start the bot and
+// returns the process exit code.
+func runSubcommand(opts cli.Options, stdout, stderr io.Writer) int {
+	switch opts.Command {
+	case cli.CommandValidate:
+		return runValidate(opts.ConfigPath, stdout, stderr)
+	case cli.CommandPrintConfig:
+		return runPrintConfig(opts.ConfigPath, stdout, stderr)
+	case cli.CommandRenderSample:
+		return runRenderSample(opts, stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "Error: unknown command %q\n", opts.Command)
+		return 2
+	}
+}
+
+// runValidate loads the config and the configured asset pack the same way
+// startup does and reports the first error, which names the offending field
+// path.
+func runValidate(path string, stdout, stderr io.Writer) int {
+	config, err := settings.Load(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	if _, err := loadConfiguredAssetPack(config); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	mode := "public"
+	if !config.IsPublicMode() {
+		mode = "private"
+	}
+	fmt.Fprintf(
+		stdout,
+		"Config %q is valid: %s mode, %d admin user IDs, %d groups, %s updates\n",
+		path,
+		mode,
+		config.AdminUserCount(),
+		config.GroupCount(),
+		config.Bot.Mode,
+	)
+	return 0
+}
+
+// runPrintConfig prints the effective config as YAML: defaults filled in,
+// environment overrides applied and values normalized, with secrets masked.
+func runPrintConfig(path string, stdout, stderr io.Writer) int {
+	config, err := settings.Load(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	raw, err := yaml.Marshal(config.Redacted())
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: encode config: %v\n", err)
+		return 1
+	}
+	if _, err := stdout.Write(raw); err != nil {
+		fmt.Fprintf(stderr, "Error: write config: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runRenderSample renders opts.SampleCount challenges with the same builder
+// and asset pack the bot uses, writes their images to opts.SampleDir and
+// prints each answer sequence and button layout.
+func runRenderSample(opts cli.Options, stdout, stderr io.Writer) int {
+	config, err := settings.Load(opts.ConfigPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	kind := opts.SampleType
+	if kind == "" {
+		kind = config.Captcha.Challenge
+	}
+	if _, err := captcha.Lookup(kind); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := os.MkdirAll(opts.SampleDir, 0o755); err != nil {
+		fmt.Fprintf(stderr, "Error: create sample directory: %v\n", err)
+		return 1
+	}
+	if err := installAssetPack(config); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	for i := 1; i <= opts.SampleCount; i++ {
+		challenge, err := buildCaptchaChallenge(kind, config.Captcha)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: render sample %d: %v\n", i, err)
+			return 1
+		}
+		path := filepath.Join(opts.SampleDir, fmt.Sprintf("sample-%02d-%s.jpg", i, challenge.Type))
+		if err := os.WriteFile(path, challenge.ImageBytes, 0o644); err != nil {
+			fmt.Fprintf(stderr, "Error: write sample %d: %v\n", i, err)
+			return 1
+		}
+		fmt.Fprint(stdout, describeSample(path, challenge))
+	}
+	return 0
+}
+
+// describeSample lists the answer and the keyboard rows of challenge as a
+// user would see them.
+func describeSample(path string, challenge captchaChallenge) string {
+	texts := make(map[string]string, len(challenge.Buttons))
+	for _, button := range challenge.Buttons {
+		texts[button.Unique] = button.Text
+	}
+	answer := make([]string, 0, len(challenge.AnswerKeys))
+	for _, key := range challenge.AnswerKeys {
+		answer = append(answer, texts[key])
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", path)
+	fmt.Fprintf(&b, "  type: %s\n", challenge.Type)
+	fmt.Fprintf(&b, "  answer: %s\n", strings.Join(answer, " "))
+	b.WriteString("  buttons:\n")
+	for _, row := range challenge.Markup.InlineKeyboard {
+		b.WriteString("   ")
+		for _, button := range row {
+			fmt.Fprintf(&b, " [%s]", button.Text)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
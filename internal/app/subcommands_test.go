@@ -0,0 +1,184 @@
+package app
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/cli"
+)
+
+func writeTestConfig(t *testing.T, raw string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(raw), 0o600); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+	return path
+}
+
+func TestRunValidate(t *testing.T) {
+	t.Parallel()
+
+	smallPack := writeTestAssetPack(t, 3)
+
+	tests := []struct {
+		name       string
+		raw        string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "valid config",
+			raw:        "bot:\n  token: test-token\n  admin_user_ids: [1001]\ngroups:\n  - id: \"@somegroup\"\n",
+			wantCode:   0,
+			wantStdout: "is valid: private mode, 1 admin user IDs, 1 groups",
+		},
+		{
+			name:       "invalid field",
+			raw:        "bot:\n  token: test-token\ncaptcha:\n  max_failures: -1\n",
+			wantCode:   1,
+			wantStderr: "captcha.max_failures must be greater than zero",
+		},
+		{
+			name:       "invalid group entry",
+			raw:        "bot:\n  token: test-token\n  admin_user_ids: [1001]\ngroups:\n  - id: \"@somegroup\"\n    challenge: nope\n",
+			wantCode:   1,
+			wantStderr: "groups[0].challenge",
+		},
+		{
+			name:       "unusable asset pack",
+			raw:        "bot:\n  token: test-token\nassets:\n  dir: missing\n",
+			wantCode:   1,
+			wantStderr: "Error: assets.dir",
+		},
+		{
+			name:       "asset pack smaller than difficulty",
+			raw:        "bot:\n  token: test-token\nassets:\n  dir: " + strconv.Quote(smallPack) + "\n",
+			wantCode:   1,
+			wantStderr: "has 3 emoji, captcha.answer_count + captcha.decoy_count requires 10",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var stdout, stderr bytes.Buffer
+			code := runValidate(writeTestConfig(t, tt.raw), &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Fatalf("runValidate code = %d, want %d (stderr %q)", code, tt.wantCode, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.wantStdout) {
+				t.Fatalf("stdout = %q, want substring %q", stdout.String(), tt.wantStdout)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Fatalf("stderr = %q, want substring %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestRunPrintConfig(t *testing.T) {
+	t.Parallel()
+
+	path := writeTestConfig(t, strings.Join([]string{
+		"bot:",
+		"  token: super-secret-token",
+		"  admin_user_ids: [1001]",
+		"groups:",
+		"  - id: \"@SomeGroup\"",
+		"    topic: 1",
+		"  - id: \"-1001234567890\"",
+		"    topic: 42",
+	}, "\n"))
+
+	var stdout, stderr bytes.Buffer
+	if code := runPrintConfig(path, &stdout, &stderr); code != 0 {
+		t.Fatalf("runPrintConfig code = %d, stderr %q", code, stderr.String())
+	}
+	got := stdout.String()
+	if strings.Contains(got, "super-secret-token") {
+		t.Fatalf("printed config leaks the token:\n%s", got)
+	}
+	for _, want := range []string{
+		"token: <redacted>",
+		"- id: '@somegroup'\n- id: \"-1001234567890\"\n  topic: 42\n",
+		"expiration: 1m0s",
+		"on_failure: ban",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("printed config missing %q:\n%s", want, got)
+		}
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := runPrintConfig(writeTestConfig(t, "bot: {}\n"), &stdout, &stderr); code != 1 {
+		t.Fatalf("runPrintConfig on invalid config code = %d, want 1", code)
+	}
+	if stdout.Len() != 0 || !strings.Contains(stderr.String(), "bot.token is required") {
+		t.Fatalf("runPrintConfig on invalid config stdout %q stderr %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestRunRenderSample(t *testing.T) {
+	// Not parallel: rendering installs the asset pack globally.
+	path := writeTestConfig(t, "bot:\n  token: test-token\ncaptcha:\n  buttons_per_row: 4\n")
+	dir := filepath.Join(t.TempDir(), "samples")
+
+	var stdout, stderr bytes.Buffer
+	opts := cli.Options{ConfigPath: path, Command: cli.CommandRenderSample, SampleCount: 2, SampleDir: dir, SampleType: "arithmetic"}
+	if code := runRenderSample(opts, &stdout, &stderr); code != 0 {
+		t.Fatalf("runRenderSample code = %d, stderr %q", code, stderr.String())
+	}
+
+	for _, name := range []string{"sample-01-arithmetic.jpg", "sample-02-arithmetic.jpg"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil || info.Size() == 0 {
+			t.Fatalf("sample %s missing or empty: %v", name, err)
+		}
+	}
+	if got := strings.Count(stdout.String(), "  answer: "); got != 2 {
+		t.Fatalf("printed %d answers, want 2:\n%s", got, stdout.String())
+	}
+
+	opts.SampleType = "nope"
+	stderr.Reset()
+	if code := runRenderSample(opts, &stdout, &stderr); code != 1 || stderr.Len() == 0 {
+		t.Fatalf("runRenderSample with unknown type code = %d stderr %q, want 1 with error", code, stderr.String())
+	}
+}
+
+func TestDescribeSample(t *testing.T) {
+	t.Parallel()
+
+	buttons := []tele.InlineButton{
+		{Text: "A", Unique: "a"},
+		{Text: "B", Unique: "b"},
+		{Text: "C", Unique: "c"},
+	}
+	challenge := captchaChallenge{
+		Type:       captcha.TypeEmojiSequence,
+		AnswerKeys: []string{"c", "a"},
+		Buttons:    buttons,
+		Markup:     captchaMarkupFromButtons(buttons, 2),
+	}
+
+	want := "out/sample-01.jpg\n" +
+		"  type: emoji_sequence\n" +
+		"  answer: C A\n" +
+		"  buttons:\n" +
+		"    [A] [B]\n" +
+		"    [C]\n"
+	if got := describeSample("out/sample-01.jpg", challenge); got != want {
+		t.Fatalf("describeSample =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/logging"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+const (
+	webhookSecretHeader   = "X-Telegram-Bot-Api-Secret-Token"
+	webhookMaxBodyBytes   = 1 << 20
+	webhookShutdownWindow = 5 * time.Second
+)
+
+// webhookPoller receives updates through a Telegram webhook served by its own
+// HTTP(S) listener. The listener is bound when the poller is created and the
+// webhook is registered before the bot starts, so either failure stops
+// startup. The webhook is removed again when polling stops.
+type webhookPoller struct {
+	listen      string
+	listener    net.Listener
+	publicURL   string
+	secretToken string
+	tlsCert     string
+	tlsKey      string
+
+	dest chan<- tele.Update
+	stop <-chan struct{}
+}
+
+func newWebhookPoller(config settings.WebhookConfig) (*webhookPoller, error) {
+	secret := config.SecretToken
+	if secret == "" {
+		generated, err := generateWebhookSecretToken()
+		if err != nil {
+			return nil, fmt.Errorf("generate webhook secret token: %w", err)
+		}
+		secret = generated
+	}
+	listener, err := net.Listen("tcp", config.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("bind webhook listener: %w", err)
+	}
+	return &webhookPoller{
+		listen:      config.Listen,
+		listener:    listener,
+		publicURL:   config.PublicURL,
+		secretToken: secret,
+		tlsCert:     config.TLSCert,
+		tlsKey:      config.TLSKey,
+	}, nil
+}
+
+func generateWebhookSecretToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func newPoller(config settings.RuntimeConfig) (tele.Poller, error) {
+	if !config.IsWebhookMode() {
+		return &tele.LongPoller{Timeout: config.Bot.PollTimeout}, nil
+	}
+	return newWebhookPoller(config.Bot.Webhook)
+}
+
+// webhookRegistrar is the part of the Bot API used to register a webhook.
+type webhookRegistrar interface {
+	SetWebhook(w *tele.Webhook) error
+}
+
+// register points the Telegram webhook at publicURL. It runs before the
+// bot starts so a rejected webhook fails startup; Telegram retries updates
+// that arrive before Poll serves the bound listener.
+func (p *webhookPoller) register(b webhookRegistrar) error {
+	hook := &tele.Webhook{
+		SecretToken: p.secretToken,
+		Endpoint:    &tele.WebhookEndpoint{PublicURL: p.publicURL},
+	}
+	if err := b.SetWebhook(hook); err != nil {
+		return fmt.Errorf("set webhook: %w", err)
+	}
+	// No update may arrive for a while; a registered webhook counts as
+	// reachable until then.
+	health.markUpdatesReceived(time.Now())
+	logging.Info("webhook_registered", "public_url", p.publicURL, "listen", p.listen, "tls", p.tlsCert != "")
+	return nil
+}
+
+func (p *webhookPoller) Poll(b *tele.Bot, dest chan tele.Update, stop chan struct{}) {
+	p.dest = dest
+	p.stop = stop
+
+	server := &http.Server{
+		Handler:           p,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	served := make(chan error, 1)
+	go func() {
+		if p.tlsCert != "" {
+			served <- server.ServeTLS(p.listener, p.tlsCert, p.tlsKey)
+			return
+		}
+		served <- server.Serve(p.listener)
+	}()
+
+	select {
+	case <-stop:
+	case err := <-served:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Error("webhook_listener_stopped", "listen", p.listen, "err", err)
+		}
+		<-stop
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookShutdownWindow)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logging.Warn("failed_to_shut_down_webhook_listener", "listen", p.listen, "err", err)
+	}
+	if err := b.RemoveWebhook(); err != nil {
+		logging.Warn("failed_to_remove_webhook", "err", err)
+		return
+	}
+	logging.Info("webhook_removed", "public_url", p.publicURL)
+}
+
+func (p *webhookPoller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isValidWebhookSecret(r.Header.Get(webhookSecretHeader), p.secretToken) {
+		logging.Warn("webhook_request_rejected", "reason", "invalid_secret_token", "remote_addr", r.RemoteAddr)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var update tele.Update
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, webhookMaxBodyBytes)).Decode(&update); err != nil {
+		logging.Warn("webhook_request_rejected", "reason", "invalid_update", "remote_addr", r.RemoteAddr, "err", err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	// Check stop first: a buffered dest still accepts sends after the bot
+	// stopped, and nothing would read them.
+	select {
+	case <-p.stop:
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	select {
+	case p.dest <- update:
+		health.markUpdatesReceived(time.Now())
+		w.WriteHeader(http.StatusOK)
+	case <-p.stop:
+		// Telegram retries undelivered updates once the webhook is back.
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+	}
+}
+
+func isValidWebhookSecret(got, want string) bool {
+	if want == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
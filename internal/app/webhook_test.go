@@ -0,0 +1,236 @@
+package app
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/settings"
+)
+
+func TestWebhookPollerServeHTTP(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		method     string
+		secret     string
+		body       string
+		wantStatus int
+		wantUpdate bool
+	}{
+		{
+			name:       "delivers update with valid secret",
+			method:     http.MethodPost,
+			secret:     "s3cret",
+			body:       `{"update_id": 42}`,
+			wantStatus: http.StatusOK,
+			wantUpdate: true,
+		},
+		{
+			name:       "rejects missing secret",
+			method:     http.MethodPost,
+			body:       `{"update_id": 42}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "rejects wrong secret",
+			method:     http.MethodPost,
+			secret:     "wrong",
+			body:       `{"update_id": 42}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "rejects non post",
+			method:     http.MethodGet,
+			secret:     "s3cret",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "rejects malformed update",
+			method:     http.MethodPost,
+			secret:     "s3cret",
+			body:       `{"update_id":`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dest := make(chan tele.Update, 1)
+			poller := &webhookPoller{
+				secretToken: "s3cret",
+				dest:        dest,
+				stop:        make(chan struct{}),
+			}
+
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			if tt.secret != "" {
+				req.Header.Set(webhookSecretHeader, tt.secret)
+			}
+			rec := httptest.NewRecorder()
+			poller.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			select {
+			case update := <-dest:
+				if !tt.wantUpdate {
+					t.Fatalf("unexpected update delivered: %+v", update)
+				}
+				if update.ID != 42 {
+					t.Fatalf("update id = %d, want 42", update.ID)
+				}
+			case <-time.After(50 * time.Millisecond):
+				if tt.wantUpdate {
+					t.Fatalf("expected update to be delivered")
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookPollerServeHTTPRejectsAfterStop(t *testing.T) {
+	t.Parallel()
+
+	stop := make(chan struct{})
+	close(stop)
+	poller := &webhookPoller{
+		secretToken: "s3cret",
+		dest:        make(chan tele.Update),
+		stop:        stop,
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"update_id": 1}`))
+	req.Header.Set(webhookSecretHeader, "s3cret")
+	rec := httptest.NewRecorder()
+	poller.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestWebhookPollerServeHTTPDoesNotBufferAfterStop(t *testing.T) {
+	t.Parallel()
+
+	stop := make(chan struct{})
+	close(stop)
+	dest := make(chan tele.Update, 1)
+	poller := &webhookPoller{
+		secretToken: "s3cret",
+		dest:        dest,
+		stop:        stop,
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"update_id": 1}`))
+	req.Header.Set(webhookSecretHeader, "s3cret")
+	rec := httptest.NewRecorder()
+	poller.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if len(dest) != 0 {
+		t.Fatalf("update was buffered after stop")
+	}
+}
+
+func TestNewPoller(t *testing.T) {
+	t.Parallel()
+
+	polling := mustValidatedRuntimeConfig(t, settings.DefaultRuntimeConfig())
+	poller, err := newPoller(polling)
+	if err != nil {
+		t.Fatalf("newPoller returned error: %v", err)
+	}
+	longPoller, ok := poller.(*tele.LongPoller)
+	if !ok {
+		t.Fatalf("poller type = %T, want *tele.LongPoller", poller)
+	}
+	if longPoller.Timeout != polling.Bot.PollTimeout {
+		t.Fatalf("poll timeout = %v, want %v", longPoller.Timeout, polling.Bot.PollTimeout)
+	}
+
+	webhookCfg := settings.DefaultRuntimeConfig()
+	webhookCfg.Bot.Mode = settings.BotModeWebhook
+	webhookCfg.Bot.Webhook = settings.WebhookConfig{
+		Listen:    "127.0.0.1:0",
+		PublicURL: "https://bot.example.com/telegram",
+	}
+	webhookCfg = mustValidatedRuntimeConfig(t, webhookCfg)
+
+	poller, err = newPoller(webhookCfg)
+	if err != nil {
+		t.Fatalf("newPoller returned error: %v", err)
+	}
+	hook, ok := poller.(*webhookPoller)
+	if !ok {
+		t.Fatalf("poller type = %T, want *webhookPoller", poller)
+	}
+	t.Cleanup(func() { hook.listener.Close() })
+	if hook.secretToken == "" {
+		t.Fatalf("expected generated secret token when none configured")
+	}
+	if hook.publicURL != "https://bot.example.com/telegram" {
+		t.Fatalf("public url = %q, want configured url", hook.publicURL)
+	}
+}
+
+func TestNewWebhookPollerFailsWhenListenAddressInUse(t *testing.T) {
+	t.Parallel()
+
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { taken.Close() })
+
+	_, err = newWebhookPoller(settings.WebhookConfig{
+		Listen:    taken.Addr().String(),
+		PublicURL: "https://bot.example.com/telegram",
+	})
+	if err == nil {
+		t.Fatal("newWebhookPoller returned no error for an address already in use")
+	}
+	if !strings.Contains(err.Error(), "bind webhook listener") {
+		t.Fatalf("error = %v, want bind failure", err)
+	}
+}
+
+type fakeWebhookRegistrar struct {
+	hook *tele.Webhook
+	err  error
+}
+
+func (f *fakeWebhookRegistrar) SetWebhook(w *tele.Webhook) error {
+	f.hook = w
+	return f.err
+}
+
+func TestWebhookPollerRegister(t *testing.T) {
+	poller := &webhookPoller{publicURL: "https://bot.example.com/telegram", secretToken: "s3cret"}
+
+	api := &fakeWebhookRegistrar{}
+	if err := poller.register(api); err != nil {
+		t.Fatalf("register returned error: %v", err)
+	}
+	if api.hook == nil || api.hook.SecretToken != "s3cret" || api.hook.Endpoint == nil || api.hook.Endpoint.PublicURL != poller.publicURL {
+		t.Fatalf("registered webhook = %+v, want public url and secret token", api.hook)
+	}
+
+	api = &fakeWebhookRegistrar{err: errors.New("bad webhook: HTTPS url must be provided")}
+	if err := poller.register(api); err == nil || !strings.Contains(err.Error(), "set webhook") {
+		t.Fatalf("register error = %v, want set webhook failure", err)
+	}
+}
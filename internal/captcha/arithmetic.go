@@ -0,0 +1,95 @@
+package captcha
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+const (
+	arithmeticMaxOperand = 20
+	arithmeticMaxFactor  = 9
+)
+
+// arithmetic asks the user to solve a small expression drawn on the image and
+// select the result among numeric buttons.
+type arithmetic struct{}
+
+func (arithmetic) Type() string {
+	return TypeArithmetic
+}
+
+func (arithmetic) Generate(opts Options) (Puzzle, error) {
+	if opts.DecoyCount <= 0 {
+		return Puzzle{}, fmt.Errorf("invalid arithmetic challenge size decoy_count=%d", opts.DecoyCount)
+	}
+
+	expression, result := randomArithmeticExpression()
+	values := arithmeticChoices(result, opts.DecoyCount)
+
+	buttons := make([]tele.InlineButton, 0, len(values))
+	for _, value := range values {
+		buttons = append(buttons, tele.InlineButton{
+			Text:   strconv.Itoa(value),
+			Unique: arithmeticKey(value),
+		})
+	}
+	shuffleButtons(buttons)
+
+	return Puzzle{
+		Type:       TypeArithmetic,
+		AnswerKeys: []string{arithmeticKey(result)},
+		Buttons:    buttons,
+		Expression: expression,
+	}, nil
+}
+
+func (arithmetic) Render(puzzle Puzzle, opts ImageOptions) ([]byte, error) {
+	if puzzle.Expression == "" {
+		return nil, fmt.Errorf("arithmetic puzzle has no expression")
+	}
+	return renderText(puzzle.Expression, opts)
+}
+
+func arithmeticKey(value int) string {
+	return "n" + strconv.Itoa(value)
+}
+
+func randomArithmeticExpression() (string, int) {
+	switch rand.Intn(3) {
+	case 0:
+		a := rand.Intn(arithmeticMaxOperand) + 1
+		b := rand.Intn(arithmeticMaxOperand) + 1
+		return fmt.Sprintf("%d + %d = ?", a, b), a + b
+	case 1:
+		a := rand.Intn(arithmeticMaxOperand) + 1
+		b := rand.Intn(a) + 1
+		return fmt.Sprintf("%d - %d = ?", a, b), a - b
+	default:
+		a := rand.Intn(arithmeticMaxFactor) + 1
+		b := rand.Intn(arithmeticMaxFactor) + 1
+		return fmt.Sprintf("%d x %d = ?", a, b), a * b
+	}
+}
+
+// arithmeticChoices returns result plus decoyCount distinct non-negative
+// wrong values close to it, so the answer cannot be guessed by magnitude.
+func arithmeticChoices(result, decoyCount int) []int {
+	values := []int{result}
+	seen := map[int]struct{}{result: {}}
+	spread := decoyCount + 2
+	for len(values) < decoyCount+1 {
+		candidate := result + rand.Intn(2*spread+1) - spread
+		if candidate < 0 {
+			continue
+		}
+		if _, ok := seen[candidate]; ok {
+			continue
+		}
+		seen[candidate] = struct{}{}
+		values = append(values, candidate)
+	}
+	return values
+}
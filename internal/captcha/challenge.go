@@ -0,0 +1,113 @@
+package captcha
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+	assetstore "toshiki-captcha-bot/assets"
+)
+
+const (
+	TypeEmojiSequence = "emoji_sequence"
+	TypeArithmetic    = "arithmetic"
+	TypeOddOneOut     = "odd_one_out"
+
+	DefaultType = TypeEmojiSequence
+)
+
+// Options tunes the size of a generated puzzle. Each challenge type decides
+// how the counts map onto its own layout.
+type Options struct {
+	AnswerCount int
+	DecoyCount  int
+}
+
+// Puzzle is a generated challenge ready to be rendered and sent.
+type Puzzle struct {
+	Type string
+	// AnswerKeys lists the button keys the user must select, in order.
+	AnswerKeys []string
+	Buttons    []tele.InlineButton
+	// SceneKeys lists the emoji asset keys drawn on the image, in layout
+	// order.
+	SceneKeys []string
+	// Expression is the text drawn on the image for text-based puzzles.
+	Expression string
+}
+
+// Challenge is one kind of captcha puzzle.
+type Challenge interface {
+	Type() string
+	Generate(opts Options) (Puzzle, error)
+	Render(puzzle Puzzle, opts ImageOptions) ([]byte, error)
+}
+
+var registry = map[string]Challenge{
+	TypeEmojiSequence: emojiSequence{},
+	TypeArithmetic:    arithmetic{},
+	TypeOddOneOut:     oddOneOut{},
+}
+
+// Lookup returns the challenge registered for kind. An empty kind resolves to
+// DefaultType.
+func Lookup(kind string) (Challenge, error) {
+	clean := strings.ToLower(strings.TrimSpace(kind))
+	if clean == "" {
+		clean = DefaultType
+	}
+	challenge, ok := registry[clean]
+	if !ok {
+		return nil, fmt.Errorf("unknown captcha challenge type %q (supported: %s)", kind, strings.Join(Types(), ", "))
+	}
+	return challenge, nil
+}
+
+func Types() []string {
+	types := make([]string, 0, len(registry))
+	for kind := range registry {
+		types = append(types, kind)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ValidateAnswer reports whether answer is the next unsolved entry of
+// status.CaptchaAnswer, along with the expected key. Every challenge type
+// stores its answer as the ordered button keys to select.
+func ValidateAnswer(status JoinStatus, answer string) (bool, string) {
+	if status.SolvedCaptcha < 0 || status.SolvedCaptcha >= len(status.CaptchaAnswer) {
+		return false, ""
+	}
+	expected := strings.TrimSpace(status.CaptchaAnswer[status.SolvedCaptcha])
+	return answer == expected, expected
+}
+
+func shuffledEmojiKeys() []string {
+	keys := assetstore.Current().EmojiKeys()
+	rand.Shuffle(len(keys), func(i, j int) {
+		keys[i], keys[j] = keys[j], keys[i]
+	})
+	return keys
+}
+
+func emojiButtons(keys []string) []tele.InlineButton {
+	pack := assetstore.Current()
+	buttons := make([]tele.InlineButton, 0, len(keys))
+	for _, key := range keys {
+		text := key
+		if emoji, ok := pack.Emoji(key); ok {
+			text = emoji.Char
+		}
+		buttons = append(buttons, tele.InlineButton{Text: text, Unique: key})
+	}
+	return buttons
+}
+
+func shuffleButtons(buttons []tele.InlineButton) {
+	rand.Shuffle(len(buttons), func(i, j int) {
+		buttons[i], buttons[j] = buttons[j], buttons[i]
+	})
+}
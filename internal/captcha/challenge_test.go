@@ -0,0 +1,276 @@
+package captcha
+
+import (
+	"strings"
+	"testing"
+
+	assetstore "toshiki-captcha-bot/assets"
+)
+
+func TestValidateAnswer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		status       JoinStatus
+		answer       string
+		wantOK       bool
+		wantExpected string
+	}{
+		{
+			name: "first step correct",
+			status: JoinStatus{
+				CaptchaAnswer: []string{"u1", "u2", "u3", "u4"},
+				SolvedCaptcha: 0,
+			},
+			answer:       "u1",
+			wantOK:       true,
+			wantExpected: "u1",
+		},
+		{
+			name: "first step wrong",
+			status: JoinStatus{
+				CaptchaAnswer: []string{"u1", "u2", "u3", "u4"},
+				SolvedCaptcha: 0,
+			},
+			answer:       "u2",
+			wantOK:       false,
+			wantExpected: "u1",
+		},
+		{
+			name: "duplicate previous tap is wrong",
+			status: JoinStatus{
+				CaptchaAnswer: []string{"u1", "u2", "u3", "u4"},
+				SolvedCaptcha: 1,
+			},
+			answer:       "u1",
+			wantOK:       false,
+			wantExpected: "u2",
+		},
+		{
+			name: "next step correct",
+			status: JoinStatus{
+				CaptchaAnswer: []string{"u1", "u2", "u3", "u4"},
+				SolvedCaptcha: 2,
+			},
+			answer:       "u3",
+			wantOK:       true,
+			wantExpected: "u3",
+		},
+		{
+			name: "out of range solved index",
+			status: JoinStatus{
+				CaptchaAnswer: []string{"u1", "u2", "u3", "u4"},
+				SolvedCaptcha: 4,
+			},
+			answer:       "u4",
+			wantOK:       false,
+			wantExpected: "",
+		},
+		{
+			name: "empty answers",
+			status: JoinStatus{
+				CaptchaAnswer: []string{},
+				SolvedCaptcha: 0,
+			},
+			answer:       "u1",
+			wantOK:       false,
+			wantExpected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			gotOK, gotExpected := ValidateAnswer(tt.status, tt.answer)
+			if gotOK != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", gotOK, tt.wantOK)
+			}
+			if gotExpected != tt.wantExpected {
+				t.Fatalf("expected = %q, want %q", gotExpected, tt.wantExpected)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		kind     string
+		wantType string
+		wantErr  bool
+	}{
+		{name: "empty resolves default", kind: "", wantType: DefaultType},
+		{name: "emoji sequence", kind: "emoji_sequence", wantType: TypeEmojiSequence},
+		{name: "normalizes case and spaces", kind: "  Arithmetic ", wantType: TypeArithmetic},
+		{name: "odd one out", kind: "odd_one_out", wantType: TypeOddOneOut},
+		{name: "unknown type", kind: "crossword", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			challenge, err := Lookup(tt.kind)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Lookup(%q) expected error", tt.kind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Lookup(%q) returned error: %v", tt.kind, err)
+			}
+			if challenge.Type() != tt.wantType {
+				t.Fatalf("Lookup(%q).Type() = %q, want %q", tt.kind, challenge.Type(), tt.wantType)
+			}
+		})
+	}
+}
+
+func TestGenerateChallenges(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		kind        string
+		wantAnswers int
+		wantButtons int
+		wantScene   int
+	}{
+		{kind: TypeEmojiSequence, wantAnswers: 4, wantButtons: 10, wantScene: 4},
+		{kind: TypeArithmetic, wantAnswers: 1, wantButtons: 7, wantScene: 0},
+		{kind: TypeOddOneOut, wantAnswers: 1, wantButtons: 7, wantScene: oddOneOutGridCells},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.kind, func(t *testing.T) {
+			t.Parallel()
+
+			challenge, err := Lookup(tt.kind)
+			if err != nil {
+				t.Fatalf("Lookup returned error: %v", err)
+			}
+			puzzle, err := challenge.Generate(Options{AnswerCount: 4, DecoyCount: 6})
+			if err != nil {
+				t.Fatalf("Generate returned error: %v", err)
+			}
+			if puzzle.Type != tt.kind {
+				t.Fatalf("puzzle type = %q, want %q", puzzle.Type, tt.kind)
+			}
+			if len(puzzle.AnswerKeys) != tt.wantAnswers {
+				t.Fatalf("answer key count = %d, want %d", len(puzzle.AnswerKeys), tt.wantAnswers)
+			}
+			if len(puzzle.Buttons) != tt.wantButtons {
+				t.Fatalf("button count = %d, want %d", len(puzzle.Buttons), tt.wantButtons)
+			}
+			if len(puzzle.SceneKeys) != tt.wantScene {
+				t.Fatalf("scene key count = %d, want %d", len(puzzle.SceneKeys), tt.wantScene)
+			}
+
+			buttonsByKey := make(map[string]struct{}, len(puzzle.Buttons))
+			for _, button := range puzzle.Buttons {
+				if _, dup := buttonsByKey[button.Unique]; dup {
+					t.Fatalf("duplicate button key %q", button.Unique)
+				}
+				buttonsByKey[button.Unique] = struct{}{}
+			}
+			for _, answerKey := range puzzle.AnswerKeys {
+				if _, ok := buttonsByKey[answerKey]; !ok {
+					t.Fatalf("answer key %q is not present in buttons", answerKey)
+				}
+			}
+
+			img, err := challenge.Render(puzzle, ImageOptions{})
+			if err != nil {
+				t.Fatalf("Render returned error: %v", err)
+			}
+			if len(img) == 0 {
+				t.Fatalf("rendered image is empty")
+			}
+		})
+	}
+}
+
+func TestOddOneOutSceneHasSingleOddEmoji(t *testing.T) {
+	t.Parallel()
+
+	puzzle, err := oddOneOut{}.Generate(Options{AnswerCount: 4, DecoyCount: 6})
+	if err != nil {
+		t.Fatalf("Generate returned error: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for _, key := range puzzle.SceneKeys {
+		counts[key]++
+	}
+	if len(counts) != 2 {
+		t.Fatalf("distinct scene emoji = %d, want 2", len(counts))
+	}
+	if counts[puzzle.AnswerKeys[0]] != 1 {
+		t.Fatalf("odd emoji count = %d, want 1", counts[puzzle.AnswerKeys[0]])
+	}
+}
+
+func TestOddOneOutPicksOddEmojiFromAnotherCategory(t *testing.T) {
+	t.Parallel()
+
+	pack := assetstore.Current()
+	for i := 0; i < 50; i++ {
+		puzzle, err := oddOneOut{}.Generate(Options{AnswerCount: 4, DecoyCount: 6})
+		if err != nil {
+			t.Fatalf("Generate returned error: %v", err)
+		}
+		oddKey := puzzle.AnswerKeys[0]
+		commonKey := puzzle.SceneKeys[0]
+		if commonKey == oddKey {
+			commonKey = puzzle.SceneKeys[1]
+		}
+		odd, _ := pack.Emoji(oddKey)
+		common, _ := pack.Emoji(commonKey)
+		if odd.Category == common.Category {
+			t.Fatalf("odd emoji %s and repeated emoji %s share category %q", oddKey, commonKey, odd.Category)
+		}
+	}
+}
+
+func TestArithmeticChoicesAreDistinct(t *testing.T) {
+	t.Parallel()
+
+	for i := 0; i < 100; i++ {
+		values := arithmeticChoices(0, 6)
+		if len(values) != 7 {
+			t.Fatalf("choice count = %d, want 7", len(values))
+		}
+		if values[0] != 0 {
+			t.Fatalf("first choice = %d, want result 0", values[0])
+		}
+		seen := make(map[int]struct{}, len(values))
+		for _, value := range values {
+			if value < 0 {
+				t.Fatalf("choice %d is negative", value)
+			}
+			if _, dup := seen[value]; dup {
+				t.Fatalf("duplicate choice %d", value)
+			}
+			seen[value] = struct{}{}
+		}
+	}
+}
+
+func TestRenderEmojiRowWithMissingAsset(t *testing.T) {
+	t.Parallel()
+
+	_, err := renderEmojiRow([]string{"does_not_exist"}, ImageOptions{})
+	if err == nil {
+		t.Fatalf("renderEmojiRow expected error for missing asset key")
+	}
+	if !strings.Contains(err.Error(), "load emoji asset key=does_not_exist") {
+		t.Fatalf("renderEmojiRow error = %q, want emoji-asset load error", err.Error())
+	}
+}
@@ -0,0 +1,207 @@
+package captcha
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// emojiMinScale is the smallest random scale applied to an emoji when
+	// ImageOptions.Scale is enabled.
+	emojiMinScale = 0.7
+	// hueShiftMaxDegrees bounds the random hue rotation so emoji stay
+	// recognisable to people.
+	hueShiftMaxDegrees = 45
+	// backgroundMinCrop is the smallest fraction of the background kept by a
+	// random crop.
+	backgroundMinCrop = 0.7
+	noiseLineCount    = 8
+	noiseDotCount     = 400
+)
+
+// ImageOptions toggles the distortion passes applied while rendering a
+// challenge. The zero value renders clean images.
+type ImageOptions struct {
+	// Scale draws each emoji at a random size.
+	Scale bool
+	// Jitter moves emoji off their fixed grid positions. Rows keep their
+	// left-to-right order.
+	Jitter bool
+	// HueShift rotates the colours of each emoji by a random angle.
+	HueShift bool
+	// NoiseLines draws random lines over the finished image.
+	NoiseLines bool
+	// NoiseDots sprinkles random dots over the finished image.
+	NoiseDots bool
+	// BackgroundCrop uses a random crop of the background scaled back to
+	// full size.
+	BackgroundCrop bool
+}
+
+// randomScale returns the factor to apply to an emoji edge.
+func randomScale(opts ImageOptions) float64 {
+	if !opts.Scale {
+		return 1
+	}
+	return emojiMinScale + rand.Float64()*(1-emojiMinScale)
+}
+
+// randomHue returns the hue rotation in degrees to apply to an emoji.
+func randomHue(opts ImageOptions) float64 {
+	if !opts.HueShift {
+		return 0
+	}
+	return float64(rand.Intn(2*hueShiftMaxDegrees+1) - hueShiftMaxDegrees)
+}
+
+// prepareEmoji resizes img to size, rotates its hue by hue degrees and
+// rotates it by angle degrees.
+func prepareEmoji(img image.Image, size int, hue, angle float64) image.Image {
+	if img.Bounds().Dx() != size || img.Bounds().Dy() != size {
+		img = imaging.Resize(img, size, size, imaging.Lanczos)
+	}
+	if hue != 0 {
+		img = shiftHue(img, hue)
+	}
+	if angle != 0 {
+		img = imaging.Rotate(img, angle, color.Transparent)
+	}
+	return img
+}
+
+// shiftHue rotates the hue of img by degrees around the grey axis, leaving
+// alpha untouched.
+func shiftHue(img image.Image, degrees float64) image.Image {
+	if degrees == 0 {
+		return img
+	}
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	const third = 1.0 / 3.0
+	sqrtThird := math.Sqrt(third)
+	m00 := cos + (1-cos)*third
+	m01 := third*(1-cos) - sqrtThird*sin
+	m02 := third*(1-cos) + sqrtThird*sin
+	m10 := third*(1-cos) + sqrtThird*sin
+	m11 := cos + third*(1-cos)
+	m12 := third*(1-cos) - sqrtThird*sin
+	m20 := third*(1-cos) - sqrtThird*sin
+	m21 := third*(1-cos) + sqrtThird*sin
+	m22 := cos + third*(1-cos)
+
+	return imaging.AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+		r, g, b := float64(c.R), float64(c.G), float64(c.B)
+		return color.NRGBA{
+			R: clampChannel(r*m00 + g*m01 + b*m02),
+			G: clampChannel(r*m10 + g*m11 + b*m12),
+			B: clampChannel(r*m20 + g*m21 + b*m22),
+			A: c.A,
+		}
+	})
+}
+
+func clampChannel(v float64) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// cropBackground returns a random crop of bg resized back to bg's bounds.
+func cropBackground(bg image.Image) image.Image {
+	bounds := bg.Bounds()
+	fraction := backgroundMinCrop + rand.Float64()*(1-backgroundMinCrop)
+	w := int(float64(bounds.Dx()) * fraction)
+	h := int(float64(bounds.Dy()) * fraction)
+	if w <= 0 || h <= 0 {
+		return bg
+	}
+	x := bounds.Min.X + rand.Intn(bounds.Dx()-w+1)
+	y := bounds.Min.Y + rand.Intn(bounds.Dy()-h+1)
+	cropped := imaging.Crop(bg, image.Rect(x, y, x+w, y+h))
+	return imaging.Resize(cropped, bounds.Dx(), bounds.Dy(), imaging.Lanczos)
+}
+
+// addNoise draws the enabled noise passes directly onto img.
+func addNoise(img *image.RGBA, opts ImageOptions) {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return
+	}
+	if opts.NoiseLines {
+		for i := 0; i < noiseLineCount; i++ {
+			from := randomPoint(bounds)
+			to := randomPoint(bounds)
+			drawLine(img, from, to, randomNoiseColor())
+		}
+	}
+	if opts.NoiseDots {
+		for i := 0; i < noiseDotCount; i++ {
+			p := randomPoint(bounds)
+			c := randomNoiseColor()
+			img.Set(p.X, p.Y, c)
+			if p.X+1 < bounds.Max.X {
+				img.Set(p.X+1, p.Y, c)
+			}
+			if p.Y+1 < bounds.Max.Y {
+				img.Set(p.X, p.Y+1, c)
+			}
+		}
+	}
+}
+
+func randomPoint(bounds image.Rectangle) image.Point {
+	return image.Pt(bounds.Min.X+rand.Intn(bounds.Dx()), bounds.Min.Y+rand.Intn(bounds.Dy()))
+}
+
+func randomNoiseColor() color.RGBA {
+	return color.RGBA{
+		R: uint8(rand.Intn(256)),
+		G: uint8(rand.Intn(256)),
+		B: uint8(rand.Intn(256)),
+		A: 255,
+	}
+}
+
+// drawLine draws a one pixel line from a to b with Bresenham's algorithm.
+func drawLine(img *image.RGBA, a, b image.Point, c color.RGBA) {
+	dx := abs(b.X - a.X)
+	dy := -abs(b.Y - a.Y)
+	sx, sy := 1, 1
+	if a.X > b.X {
+		sx = -1
+	}
+	if a.Y > b.Y {
+		sy = -1
+	}
+	errTerm := dx + dy
+	x, y := a.X, a.Y
+	for {
+		img.SetRGBA(x, y, c)
+		if x == b.X && y == b.Y {
+			return
+		}
+		e2 := 2 * errTerm
+		if e2 >= dy {
+			errTerm += dy
+			x += sx
+		}
+		if e2 <= dx {
+			errTerm += dx
+			y += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
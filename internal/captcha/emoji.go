@@ -1,41 +0,0 @@
-package captcha
-
-var Emojis = map[string]string{
-	"u1f35c": "🍜",
-	"u1f958": "🥘",
-	"u1f9c6": "🧆",
-	"u1f364": "🍤",
-	"u1f9aa": "🦪",
-	"u1f36d": "🍭",
-	"u1f366": "🍦",
-	"u1f36f": "🍯",
-	"u1f95c": "🥜",
-	"u1f369": "🍩",
-	"u1f37f": "🍿",
-	"u1f377": "🍷",
-	"u1f9c9": "🧉",
-	"u1f37d": "🍽",
-	"u1f944": "🥄",
-	"u1f36b": "🍫",
-	"u1f36c": "🍬",
-	"u1f9c5": "🧅",
-	"u1f356": "🍖",
-	"u1f357": "🍗",
-	"u1f355": "🍕",
-	"u1f32e": "🌮",
-	"u1f525": "🔥",
-	"u1f308": "🌈",
-	"u1f436": "🐶",
-	"u1f412": "🐒",
-	"u1f989": "🦉",
-	"u1f97e": "🥾",
-	"u1f48d": "💍",
-	"u1f302": "🌂",
-	"u1f69a": "🚚",
-	"u1f69c": "🚜",
-	"u1f6f5": "🛵",
-	"u1f9e8": "🧨",
-	"u1f9f2": "🧲",
-	"u1f52e": "🔮",
-	"u1f389": "🎉",
-}
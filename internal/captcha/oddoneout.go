@@ -0,0 +1,79 @@
+package captcha
+
+import (
+	"fmt"
+	"math/rand"
+
+	assetstore "toshiki-captcha-bot/assets"
+)
+
+const oddOneOutGridCells = 9
+
+// oddOneOut draws a grid of one repeated emoji with a single different emoji
+// hidden among them and asks the user to select the different one.
+type oddOneOut struct{}
+
+func (oddOneOut) Type() string {
+	return TypeOddOneOut
+}
+
+func (oddOneOut) Generate(opts Options) (Puzzle, error) {
+	if opts.DecoyCount <= 0 {
+		return Puzzle{}, fmt.Errorf("invalid odd-one-out challenge size decoy_count=%d", opts.DecoyCount)
+	}
+
+	// The odd emoji, the repeated emoji, and the remaining decoys all need
+	// distinct keys.
+	required := opts.DecoyCount + 1
+	emojiKeys := shuffledEmojiKeys()
+	if len(emojiKeys) < required {
+		return Puzzle{}, fmt.Errorf(
+			"insufficient emoji pool available=%d required=%d",
+			len(emojiKeys),
+			required,
+		)
+	}
+
+	commonKey := emojiKeys[0]
+	odd := contrastingKeyIndex(emojiKeys)
+	emojiKeys[1], emojiKeys[odd] = emojiKeys[odd], emojiKeys[1]
+	oddKey := emojiKeys[1]
+
+	scene := make([]string, oddOneOutGridCells)
+	for i := range scene {
+		scene[i] = commonKey
+	}
+	scene[rand.Intn(len(scene))] = oddKey
+
+	buttons := emojiButtons(emojiKeys[:required])
+	shuffleButtons(buttons)
+
+	return Puzzle{
+		Type:       TypeOddOneOut,
+		AnswerKeys: []string{oddKey},
+		Buttons:    buttons,
+		SceneKeys:  scene,
+	}, nil
+}
+
+// contrastingKeyIndex returns the index of the first key whose category
+// differs from that of keys[0], so the odd emoji does not blend in with the
+// repeated one. It returns 1 when keys[0] has no category or every key
+// shares it.
+func contrastingKeyIndex(keys []string) int {
+	pack := assetstore.Current()
+	common, _ := pack.Emoji(keys[0])
+	if common.Category == "" {
+		return 1
+	}
+	for i := 1; i < len(keys); i++ {
+		if emoji, _ := pack.Emoji(keys[i]); emoji.Category != common.Category {
+			return i
+		}
+	}
+	return 1
+}
+
+func (oddOneOut) Render(puzzle Puzzle, opts ImageOptions) ([]byte, error) {
+	return renderEmojiGrid(puzzle.SceneKeys, 3, opts)
+}
@@ -0,0 +1,258 @@
+package captcha
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"math/rand"
+
+	gim "github.com/codenoid/goimagemerge"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	assetstore "toshiki-captcha-bot/assets"
+)
+
+const (
+	// emojiMaxSize caps the drawn emoji edge so short rows keep the native
+	// asset size.
+	emojiMaxSize = 72
+	textScale    = 5
+	textPadding  = 4
+)
+
+// rowSlot is where one emoji of a left-to-right row is drawn.
+type rowSlot struct {
+	Center image.Point
+	Size   int
+}
+
+// reach is the widest extent of the slot's emoji at any rotation.
+func (s rowSlot) reach() int {
+	return int(math.Ceil(float64(s.Size)*math.Sqrt2)) + 1
+}
+
+// box is the area the rotated emoji of the slot may cover.
+func (s rowSlot) box() image.Rectangle {
+	r := s.reach()
+	return image.Rect(s.Center.X-r/2, s.Center.Y-r/2, s.Center.X+(r+1)/2, s.Center.Y+(r+1)/2)
+}
+
+// emojiRowLayout places count emojis left to right inside bounds. Emojis
+// shrink as the row grows so that every slot, rotated to any angle, still
+// fits without overlapping its neighbours. With opts.Jitter the free space
+// is handed out as random gaps and random vertical offsets, so positions
+// vary while the boxes stay strictly ordered from left to right.
+func emojiRowLayout(count int, bounds image.Rectangle, maxSize int, opts ImageOptions) []rowSlot {
+	if count <= 0 {
+		return nil
+	}
+	cellW := bounds.Dx() / count
+	base := int(float64(cellW-1) / math.Sqrt2)
+	if base > maxSize {
+		base = maxSize
+	}
+
+	slots := make([]rowSlot, count)
+	used := 0
+	for i := range slots {
+		size := int(float64(base) * randomScale(opts))
+		if size < 1 {
+			size = 1
+		}
+		slots[i].Size = size
+		used += slots[i].reach()
+	}
+
+	centerY := bounds.Min.Y + bounds.Dy()/2
+	if !opts.Jitter {
+		for i := range slots {
+			slots[i].Center = image.Pt(bounds.Min.X+i*cellW+cellW/2, centerY)
+		}
+		return slots
+	}
+
+	slack := bounds.Dx() - used
+	if slack < 0 {
+		slack = 0
+	}
+	weights := make([]float64, count+1)
+	total := 0.0
+	for i := range weights {
+		weights[i] = rand.Float64()
+		total += weights[i]
+	}
+
+	x := bounds.Min.X
+	for i := range slots {
+		x += int(float64(slack) * weights[i] / total)
+		r := slots[i].reach()
+		minY := bounds.Min.Y + r/2
+		maxY := bounds.Max.Y - (r+1)/2
+		y := centerY
+		if maxY > minY {
+			y = minY + rand.Intn(maxY-minY+1)
+		}
+		slots[i].Center = image.Pt(x+r/2, y)
+		x += r
+	}
+	return slots
+}
+
+func renderEmojiRow(answerKeys []string, opts ImageOptions) ([]byte, error) {
+	bgImg, err := loadBackground(opts)
+	if err != nil {
+		return nil, err
+	}
+	bgBounds := bgImg.Bounds()
+
+	slots := emojiRowLayout(len(answerKeys), bgBounds, emojiMaxSize, opts)
+	captchaGrids := make([]*gim.Grid, 0, len(answerKeys))
+	for i, key := range answerKeys {
+		emojiImg, err := assetstore.LoadEmojiByKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("load emoji asset key=%s: %w", key, err)
+		}
+
+		slot := slots[i]
+		img := prepareEmoji(emojiImg, slot.Size, randomHue(opts), float64(rand.Intn(200)))
+		size := img.Bounds().Size()
+		captchaGrids = append(captchaGrids, &gim.Grid{
+			Image:   img,
+			OffsetX: slot.Center.X - size.X/2,
+			OffsetY: slot.Center.Y - size.Y/2,
+		})
+	}
+
+	return composeOnBackground(bgImg, captchaGrids, opts)
+}
+
+func renderEmojiGrid(sceneKeys []string, columns int, opts ImageOptions) ([]byte, error) {
+	if columns <= 0 {
+		return nil, fmt.Errorf("invalid emoji grid columns=%d", columns)
+	}
+	bgImg, err := loadBackground(opts)
+	if err != nil {
+		return nil, err
+	}
+	bgBounds := bgImg.Bounds()
+
+	rows := (len(sceneKeys) + columns - 1) / columns
+	if rows == 0 {
+		rows = 1
+	}
+	cellW := bgBounds.Dx() / columns
+	cellH := bgBounds.Dy() / rows
+
+	// One hue for the whole grid, otherwise copies of the repeated emoji
+	// would no longer look identical.
+	hue := randomHue(opts)
+	captchaGrids := make([]*gim.Grid, 0, len(sceneKeys))
+	for i, key := range sceneKeys {
+		emojiImg, err := assetstore.LoadEmojiByKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("load emoji asset key=%s: %w", key, err)
+		}
+		size := int(float64(emojiImg.Bounds().Dx()) * randomScale(opts))
+		img := prepareEmoji(emojiImg, size, hue, float64(rand.Intn(40)-20))
+		drawn := img.Bounds().Size()
+
+		offsetX := (cellW - drawn.X) / 2
+		offsetY := (cellH - drawn.Y) / 2
+		if opts.Jitter {
+			offsetX = jitterOffset(cellW - drawn.X)
+			offsetY = jitterOffset(cellH - drawn.Y)
+		}
+		col := i % columns
+		row := i / columns
+		captchaGrids = append(captchaGrids, &gim.Grid{
+			Image:   img,
+			OffsetX: col*cellW + offsetX,
+			OffsetY: row*cellH + offsetY,
+		})
+	}
+
+	return composeOnBackground(bgImg, captchaGrids, opts)
+}
+
+// jitterOffset returns a random offset in [0, slack], or the centred offset
+// when there is no free space.
+func jitterOffset(slack int) int {
+	if slack <= 0 {
+		return slack / 2
+	}
+	return rand.Intn(slack + 1)
+}
+
+func renderText(text string, opts ImageOptions) ([]byte, error) {
+	bgImg, err := loadBackground(opts)
+	if err != nil {
+		return nil, err
+	}
+	bgBounds := bgImg.Bounds()
+
+	face := basicfont.Face7x13
+	width := font.MeasureString(face, text).Ceil() + 2*textPadding
+	height := face.Metrics().Height.Ceil() + 2*textPadding
+	small := image.NewRGBA(image.Rect(0, 0, width, height))
+	drawer := &font.Drawer{
+		Dst:  small,
+		Src:  image.NewUniform(color.White),
+		Face: face,
+		Dot:  fixed.P(textPadding, textPadding+face.Metrics().Ascent.Ceil()),
+	}
+	drawer.DrawString(text)
+
+	scale := textScale
+	for scale > 1 && (width*scale > bgBounds.Dx() || height*scale > bgBounds.Dy()) {
+		scale--
+	}
+	large := image.NewRGBA(image.Rect(0, 0, width*scale, height*scale))
+	xdraw.NearestNeighbor.Scale(large, large.Bounds(), small, small.Bounds(), xdraw.Over, nil)
+
+	return composeOnBackground(bgImg, []*gim.Grid{{
+		Image:   large,
+		OffsetX: (bgBounds.Dx() - large.Bounds().Dx()) / 2,
+		OffsetY: (bgBounds.Dy() - large.Bounds().Dy()) / 2,
+		Rotate:  float64(rand.Intn(10) - 5),
+	}}, opts)
+}
+
+// loadBackground picks a background from the current asset pack and applies
+// the background passes of opts.
+func loadBackground(opts ImageOptions) (image.Image, error) {
+	bgImg, err := assetstore.LoadBackground()
+	if err != nil {
+		return nil, fmt.Errorf("load background asset: %w", err)
+	}
+	if opts.BackgroundCrop {
+		bgImg = cropBackground(bgImg)
+	}
+	return bgImg, nil
+}
+
+func composeOnBackground(bgImg image.Image, layers []*gim.Grid, opts ImageOptions) ([]byte, error) {
+	grids := []*gim.Grid{
+		{
+			Image: bgImg,
+			Grids: layers,
+		},
+	}
+
+	rgba, err := gim.New(grids, 1, 1).Merge()
+	if err != nil {
+		return nil, fmt.Errorf("merge captcha layers: %w", err)
+	}
+	addNoise(rgba, opts)
+
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, rgba, &jpeg.Options{Quality: 100}); err != nil {
+		return nil, fmt.Errorf("encode captcha image: %w", err)
+	}
+
+	return img.Bytes(), nil
+}
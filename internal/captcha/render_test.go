@@ -0,0 +1,140 @@
+package captcha
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+var allImageOptions = ImageOptions{
+	Scale:          true,
+	Jitter:         true,
+	HueShift:       true,
+	NoiseLines:     true,
+	NoiseDots:      true,
+	BackgroundCrop: true,
+}
+
+func TestEmojiRowLayout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		opts ImageOptions
+	}{
+		{name: "fixed", opts: ImageOptions{}},
+		{name: "scale", opts: ImageOptions{Scale: true}},
+		{name: "jitter", opts: ImageOptions{Jitter: true}},
+		{name: "scale and jitter", opts: ImageOptions{Scale: true, Jitter: true}},
+	}
+
+	bounds := image.Rect(0, 0, 400, 300)
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			for round := 0; round < 200; round++ {
+				for count := 1; count <= 12; count++ {
+					slots := emojiRowLayout(count, bounds, emojiMaxSize, tt.opts)
+					assertRowOrdered(t, slots, count, bounds)
+				}
+			}
+		})
+	}
+}
+
+func assertRowOrdered(t *testing.T, slots []rowSlot, count int, bounds image.Rectangle) {
+	t.Helper()
+
+	if len(slots) != count {
+		t.Fatalf("count=%d slots = %d, want %d", count, len(slots), count)
+	}
+	for i, slot := range slots {
+		if slot.Size <= 0 || slot.Size > emojiMaxSize {
+			t.Fatalf("count=%d slot %d size = %d, want 1..%d", count, i, slot.Size, emojiMaxSize)
+		}
+		box := slot.box()
+		if !box.In(bounds) {
+			t.Fatalf("count=%d slot %d box %v leaves bounds %v", count, i, box, bounds)
+		}
+		if i == 0 {
+			continue
+		}
+		// The whole previous box must sit left of this one so the reading
+		// order never depends on rotation or vertical position.
+		if prev := slots[i-1].box(); prev.Max.X > box.Min.X {
+			t.Fatalf("count=%d slots %d and %d out of order prev=%v next=%v", count, i-1, i, prev, box)
+		}
+	}
+}
+
+func TestEmojiRowLayoutKeepsNativeSizeForShortRows(t *testing.T) {
+	t.Parallel()
+
+	slots := emojiRowLayout(3, image.Rect(0, 0, 400, 300), emojiMaxSize, ImageOptions{})
+	for i, slot := range slots {
+		if slot.Size != emojiMaxSize {
+			t.Fatalf("slot %d size = %d, want %d", i, slot.Size, emojiMaxSize)
+		}
+	}
+}
+
+func TestEmojiRowLayoutJitterMovesSlots(t *testing.T) {
+	t.Parallel()
+
+	bounds := image.Rect(0, 0, 400, 300)
+	fixed := emojiRowLayout(4, bounds, emojiMaxSize, ImageOptions{})
+	for round := 0; round < 50; round++ {
+		jittered := emojiRowLayout(4, bounds, emojiMaxSize, ImageOptions{Scale: true, Jitter: true})
+		for i := range jittered {
+			if jittered[i].Center != fixed[i].Center {
+				return
+			}
+		}
+	}
+	t.Fatalf("jittered layout never moved away from fixed layout")
+}
+
+func TestShiftHueKeepsAlphaAndGrey(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 128, G: 128, B: 128, A: 200})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 255, A: 10})
+
+	shifted := shiftHue(img, 120)
+	grey := color.NRGBAModel.Convert(shifted.At(0, 0)).(color.NRGBA)
+	if grey.R != 128 || grey.G != 128 || grey.B != 128 || grey.A != 200 {
+		t.Fatalf("grey pixel = %+v, want unchanged", grey)
+	}
+	red := color.NRGBAModel.Convert(shifted.At(1, 0)).(color.NRGBA)
+	if red.A != 10 {
+		t.Fatalf("alpha = %d, want 10", red.A)
+	}
+	if red.G <= red.R {
+		t.Fatalf("120 degree shift of red = %+v, want green dominant", red)
+	}
+}
+
+func TestRenderWithAllDistortions(t *testing.T) {
+	t.Parallel()
+
+	for _, kind := range Types() {
+		challenge, err := Lookup(kind)
+		if err != nil {
+			t.Fatalf("Lookup(%q) returned error: %v", kind, err)
+		}
+		puzzle, err := challenge.Generate(Options{AnswerCount: 6, DecoyCount: 6})
+		if err != nil {
+			t.Fatalf("Generate(%q) returned error: %v", kind, err)
+		}
+		img, err := challenge.Render(puzzle, allImageOptions)
+		if err != nil {
+			t.Fatalf("Render(%q) returned error: %v", kind, err)
+		}
+		if len(img) == 0 {
+			t.Fatalf("Render(%q) returned empty image", kind)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package captcha
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// emojiSequence asks the user to select the pictured emojis in exact
+// left-to-right order.
+type emojiSequence struct{}
+
+func (emojiSequence) Type() string {
+	return TypeEmojiSequence
+}
+
+func (emojiSequence) Generate(opts Options) (Puzzle, error) {
+	challengeCount := opts.AnswerCount + opts.DecoyCount
+	if challengeCount <= 0 || opts.AnswerCount <= 0 || opts.DecoyCount < 0 {
+		return Puzzle{}, fmt.Errorf("invalid captcha challenge size answer_count=%d decoy_count=%d", opts.AnswerCount, opts.DecoyCount)
+	}
+
+	emojiKeys := shuffledEmojiKeys()
+	if len(emojiKeys) < challengeCount {
+		return Puzzle{}, fmt.Errorf(
+			"insufficient emoji pool available=%d required=%d",
+			len(emojiKeys),
+			challengeCount,
+		)
+	}
+
+	answerKeys := append([]string(nil), emojiKeys[:opts.AnswerCount]...)
+	challengeKeys := append([]string(nil), emojiKeys[:challengeCount]...)
+	rand.Shuffle(len(challengeKeys), func(i, j int) {
+		challengeKeys[i], challengeKeys[j] = challengeKeys[j], challengeKeys[i]
+	})
+
+	return Puzzle{
+		Type:       TypeEmojiSequence,
+		AnswerKeys: answerKeys,
+		Buttons:    emojiButtons(challengeKeys),
+		SceneKeys:  append([]string(nil), answerKeys...),
+	}, nil
+}
+
+func (emojiSequence) Render(puzzle Puzzle, opts ImageOptions) ([]byte, error) {
+	return renderEmojiRow(puzzle.SceneKeys, opts)
+}
@@ -1,15 +1,45 @@
 package captcha
 
-import tele "gopkg.in/telebot.v3"
+import (
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
 
 type JoinStatus struct {
-	UserID          int64
-	UserFullName    string
-	ManualChallenge bool
-	CaptchaAnswer   []string
-	SolvedCaptcha   int
-	FailCaptcha     int
-	ChatID          int64
-	CaptchaMessage  tele.Message
-	Buttons         []tele.InlineButton
+	UserID          int64               `json:"user_id"`
+	UserFullName    string              `json:"user_full_name"`
+	ManualChallenge bool                `json:"manual_challenge"`
+	CaptchaAnswer   []string            `json:"captcha_answer"`
+	SolvedCaptcha   int                 `json:"solved_captcha"`
+	FailCaptcha     int                 `json:"fail_captcha"`
+	ChatID          int64               `json:"chat_id"`
+	CaptchaMessage  tele.Message        `json:"captcha_message"`
+	Buttons         []tele.InlineButton `json:"buttons"`
+	ChallengeType   string              `json:"challenge_type,omitempty"`
+	// ChatUsername is the username of the group at ChatID. It is kept for
+	// challenges hosted in a private chat, where CaptchaMessage.Chat is the
+	// user's chat instead of the group.
+	ChatUsername string `json:"chat_username,omitempty"`
+	// JoinRequest marks a challenge gating a chat join request; the outcome
+	// approves or declines the request instead of restricting a member.
+	JoinRequest bool `json:"join_request,omitempty"`
+	// StartToken is the deep link payload of a challenge delivered in a
+	// private chat. It is set while only the group prompt exists and cleared
+	// once the challenge is opened.
+	StartToken string `json:"start_token,omitempty"`
+	// IssuedAt is when the challenge was first issued. Regenerated and
+	// reissued challenges keep it.
+	IssuedAt time.Time `json:"issued_at,omitempty"`
+}
+
+// IsPrivate reports whether the challenge message lives in a private chat
+// rather than in the group it belongs to.
+func (s JoinStatus) IsPrivate() bool {
+	return s.CaptchaMessage.Chat != nil && s.CaptchaMessage.Chat.Type == tele.ChatPrivate
+}
+
+// IsSolved reports whether every expected answer has been selected.
+func (s JoinStatus) IsSolved() bool {
+	return len(s.CaptchaAnswer) > 0 && s.SolvedCaptcha >= len(s.CaptchaAnswer)
 }
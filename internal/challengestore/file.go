@@ -0,0 +1,210 @@
+package challengestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"toshiki-captcha-bot/internal/captcha"
+)
+
+type challengeState struct {
+	Records []Record `json:"records"`
+}
+
+// File is a memory store that writes a JSON snapshot of every pending
+// challenge after each mutation so the bot can resume after a restart.
+type File struct {
+	mem  *Memory
+	path string
+	mu   sync.Mutex
+}
+
+func NewFile(path string, expiration, cleanupInterval time.Duration) *File {
+	return &File{
+		mem:  NewMemory(expiration, cleanupInterval),
+		path: path,
+	}
+}
+
+func (f *File) Path() string {
+	return f.path
+}
+
+func (f *File) Get(key string) (captcha.JoinStatus, bool) {
+	return f.mem.Get(key)
+}
+
+func (f *File) Set(key string, status captcha.JoinStatus, ttl time.Duration) error {
+	if err := f.mem.Set(key, status, ttl); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *File) Update(key string, status captcha.JoinStatus) error {
+	if err := f.mem.Update(key, status); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *File) Delete(key string) error {
+	if err := f.mem.Delete(key); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *File) RestoreAll(records []Record) error {
+	if err := f.mem.RestoreAll(records); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *File) List() []Record {
+	return f.mem.List()
+}
+
+func (f *File) OnEvicted(fn func(key string, status captcha.JoinStatus)) {
+	if fn == nil {
+		f.mem.OnEvicted(nil)
+		return
+	}
+	f.mem.OnEvicted(func(key string, status captcha.JoinStatus) {
+		// Persist the removal before acting on it so a crash during the
+		// eviction handler cannot replay the same timeout twice.
+		_ = f.flush()
+		fn(key, status)
+	})
+}
+
+func (f *File) Flush() error {
+	return f.flush()
+}
+
+// Check stats the state directory and the snapshot file, if one exists,
+// so readiness probes do not rewrite the snapshot.
+func (f *File) Check() error {
+	dir := filepath.Dir(f.path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("stat challenge state directory %q: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("challenge state directory %q is not a directory", dir)
+	}
+
+	info, err = os.Stat(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat challenge state file %q: %w", f.path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("challenge state file %q is not a regular file", f.path)
+	}
+	return nil
+}
+
+func (f *File) Close() error {
+	if err := f.mem.Close(); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *File) flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return Save(f.path, f.mem.List())
+}
+
+func Load(path string) ([]Record, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read challenge state file %q: %w", path, err)
+	}
+
+	state := challengeState{}
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, fmt.Errorf("decode challenge state file %q: %w", path, err)
+	}
+
+	records := make([]Record, 0, len(state.Records))
+	for _, record := range state.Records {
+		if record.Key == "" {
+			continue
+		}
+		records = append(records, record)
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+func Save(path string, records []Record) error {
+	state := challengeState{
+		Records: append([]Record{}, records...),
+	}
+	sortRecords(state.Records)
+	raw, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode challenge state file %q: %w", path, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create challenge state directory for %q: %w", path, err)
+	}
+
+	// Write to a sibling file first so a crash mid-write never leaves a
+	// truncated snapshot behind, and sync it and the directory so the
+	// rename survives a power loss.
+	tmp := path + ".tmp"
+	if err := writeFileSync(tmp, raw); err != nil {
+		return fmt.Errorf("write challenge state file %q: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("replace challenge state file %q: %w", path, err)
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("sync challenge state directory for %q: %w", path, err)
+	}
+
+	return nil
+}
+
+func writeFileSync(path string, raw []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(raw); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
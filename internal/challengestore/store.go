@@ -0,0 +1,221 @@
+package challengestore
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codenoid/minikv"
+	"toshiki-captcha-bot/internal/captcha"
+)
+
+const challengeStateFileSuffix = ".challenges.json"
+const defaultConfigPath = "config.yaml"
+
+// Record is a pending challenge together with its absolute deadline.
+type Record struct {
+	Key       string             `json:"key"`
+	Status    captcha.JoinStatus `json:"status"`
+	ExpiresAt time.Time          `json:"expires_at"`
+}
+
+// Store keeps pending captcha challenges keyed by "<user_id>-<chat_id>" and
+// invokes the eviction callback once a challenge deadline elapses.
+type Store interface {
+	Get(key string) (captcha.JoinStatus, bool)
+	Set(key string, status captcha.JoinStatus, ttl time.Duration) error
+	Update(key string, status captcha.JoinStatus) error
+	Delete(key string) error
+	// RestoreAll re-arms previously persisted records with their remaining
+	// lifetime and flushes once. Records whose deadline already passed are
+	// evicted on the next cleanup tick.
+	RestoreAll(records []Record) error
+	// List returns every record that has not been evicted yet, including
+	// expired records still waiting for the cleanup janitor.
+	List() []Record
+	// OnEvicted sets the callback for records whose deadline elapsed. It
+	// runs on the cleanup janitor goroutine after the record is removed,
+	// so long work belongs in a goroutine of its own.
+	OnEvicted(fn func(key string, status captcha.JoinStatus))
+	// Flush writes pending state to durable storage, if any.
+	Flush() error
+	// Check reports whether durable storage, if any, is reachable without
+	// writing to it.
+	Check() error
+	// Close stops the cleanup janitor, waiting for a running sweep and its
+	// callbacks, and flushes pending state. The store stays usable.
+	Close() error
+}
+
+func Key(userID, chatID int64) string {
+	return fmt.Sprintf("%v-%v", userID, chatID)
+}
+
+func PathForConfig(configPath string) string {
+	path := strings.TrimSpace(configPath)
+	if path == "" {
+		path = defaultConfigPath
+	}
+
+	clean := filepath.Clean(path)
+	base := filepath.Base(clean)
+	dir := filepath.Dir(clean)
+
+	stateFile := fmt.Sprintf(".%s%s", base, challengeStateFileSuffix)
+	return filepath.Join(dir, stateFile)
+}
+
+// Memory is a process-local store backed by minikv. It runs its own
+// cleanup janitor so eviction callbacks are called before any goroutine is
+// spawned for them.
+type Memory struct {
+	kv *minikv.KV
+
+	// mu guards onEvicted and closed, and is held for a whole sweep.
+	mu        sync.Mutex
+	onEvicted func(key string, status captcha.JoinStatus)
+	closed    bool
+	stop      chan struct{}
+}
+
+func NewMemory(expiration, cleanupInterval time.Duration) *Memory {
+	m := &Memory{
+		kv:   minikv.New(expiration, minikv.NoExpiration),
+		stop: make(chan struct{}),
+	}
+	if cleanupInterval > 0 {
+		go m.runJanitor(cleanupInterval)
+	}
+	return m
+}
+
+func (m *Memory) runJanitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.deleteExpired()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// deleteExpired removes every record whose deadline elapsed and calls the
+// eviction callback for it.
+func (m *Memory) deleteExpired() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	for key, item := range m.kv.ListAll() {
+		if now <= item.Expiration {
+			continue
+		}
+		_ = m.kv.Delete(key)
+		if status, ok := item.Object.(captcha.JoinStatus); ok && m.onEvicted != nil {
+			m.onEvicted(key, status)
+		}
+	}
+}
+
+func (m *Memory) Get(key string) (captcha.JoinStatus, bool) {
+	value, found := m.kv.Get(key)
+	if !found {
+		return captcha.JoinStatus{}, false
+	}
+	status, ok := value.(captcha.JoinStatus)
+	return status, ok
+}
+
+func (m *Memory) Set(key string, status captcha.JoinStatus, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("challenge ttl must be greater than zero key=%s", key)
+	}
+	m.kv.Set(key, status, ttl)
+	return nil
+}
+
+func (m *Memory) Update(key string, status captcha.JoinStatus) error {
+	return m.kv.Update(key, status)
+}
+
+func (m *Memory) Delete(key string) error {
+	return m.kv.Delete(key)
+}
+
+func (m *Memory) RestoreAll(records []Record) error {
+	for _, record := range records {
+		if strings.TrimSpace(record.Key) == "" {
+			return fmt.Errorf("challenge record key must not be empty")
+		}
+	}
+	for _, record := range records {
+		remaining := time.Until(record.ExpiresAt)
+		if remaining <= 0 {
+			// Keep the record around just long enough for the janitor to
+			// evict it and fire the eviction callback.
+			remaining = time.Nanosecond
+		}
+		m.kv.Set(record.Key, record.Status, remaining)
+	}
+	return nil
+}
+
+func (m *Memory) List() []Record {
+	items := m.kv.ListAll()
+	records := make([]Record, 0, len(items))
+	for key, item := range items {
+		status, ok := item.Object.(captcha.JoinStatus)
+		if !ok {
+			continue
+		}
+		records = append(records, Record{
+			Key:       key,
+			Status:    status,
+			ExpiresAt: time.Unix(0, item.Expiration),
+		})
+	}
+	sortRecords(records)
+	return records
+}
+
+func (m *Memory) OnEvicted(fn func(key string, status captcha.JoinStatus)) {
+	m.mu.Lock()
+	m.onEvicted = fn
+	m.mu.Unlock()
+}
+
+func (m *Memory) Flush() error {
+	return nil
+}
+
+func (m *Memory) Check() error {
+	return nil
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.stop)
+	}
+	return nil
+}
+
+func sortRecords(records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].ExpiresAt.Equal(records[j].ExpiresAt) {
+			return records[i].ExpiresAt.Before(records[j].ExpiresAt)
+		}
+		return records[i].Key < records[j].Key
+	})
+}
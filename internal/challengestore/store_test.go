@@ -0,0 +1,341 @@
+package challengestore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+	"toshiki-captcha-bot/internal/captcha"
+)
+
+func TestChallengeStatePathForConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{
+			name:   "default when empty input",
+			input:  "",
+			expect: filepath.Join(".", ".config.yaml.challenges.json"),
+		},
+		{
+			name:   "relative config path",
+			input:  "configs/dev.yaml",
+			expect: filepath.Join("configs", ".dev.yaml.challenges.json"),
+		},
+		{
+			name:   "absolute config path",
+			input:  "/tmp/captcha/config.yaml",
+			expect: "/tmp/captcha/.config.yaml.challenges.json",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := PathForConfig(tt.input)
+			if got != tt.expect {
+				t.Fatalf("PathForConfig() = %q, want %q", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestMemoryLifecycle(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemory(time.Minute, time.Hour)
+	key := Key(1001, -100123)
+	if key != "1001--100123" {
+		t.Fatalf("Key() = %q, want %q", key, "1001--100123")
+	}
+
+	if err := store.Set(key, captcha.JoinStatus{UserID: 1001, ChatID: -100123}, time.Minute); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	status, found := store.Get(key)
+	if !found || status.UserID != 1001 {
+		t.Fatalf("Get() = (%+v, %t), want stored status", status, found)
+	}
+
+	status.FailCaptcha = 1
+	if err := store.Update(key, status); err != nil {
+		t.Fatalf("Update returned error: %v", err)
+	}
+	records := store.List()
+	if len(records) != 1 || records[0].Status.FailCaptcha != 1 {
+		t.Fatalf("List() = %+v, want one updated record", records)
+	}
+	if !records[0].ExpiresAt.After(time.Now()) {
+		t.Fatalf("record deadline = %v, want future deadline", records[0].ExpiresAt)
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if _, found := store.Get(key); found {
+		t.Fatalf("expected status to be deleted")
+	}
+	if err := store.Update(key, status); err == nil {
+		t.Fatalf("Update on missing key should return error")
+	}
+	if err := store.Set(key, status, 0); err == nil {
+		t.Fatalf("Set with zero ttl should return error")
+	}
+}
+
+func TestMemoryRestoreAllExpiredRecordIsEvicted(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemory(time.Minute, 10*time.Millisecond)
+	evicted := make(chan string, 1)
+	store.OnEvicted(func(key string, status captcha.JoinStatus) {
+		evicted <- key
+	})
+
+	record := Record{
+		Key:       Key(1001, -100123),
+		Status:    captcha.JoinStatus{UserID: 1001, ChatID: -100123},
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	if err := store.RestoreAll([]Record{record}); err != nil {
+		t.Fatalf("RestoreAll returned error: %v", err)
+	}
+	if _, found := store.Get(record.Key); found {
+		t.Fatalf("expired record should not be returned by Get")
+	}
+
+	select {
+	case key := <-evicted:
+		if key != record.Key {
+			t.Fatalf("evicted key = %q, want %q", key, record.Key)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected expired record to be evicted")
+	}
+}
+
+func TestMemoryRestoreAllKeepsRemainingLifetime(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemory(time.Minute, time.Hour)
+	deadline := time.Now().Add(30 * time.Second)
+	record := Record{
+		Key:       Key(1001, -100123),
+		Status:    captcha.JoinStatus{UserID: 1001, ChatID: -100123},
+		ExpiresAt: deadline,
+	}
+	if err := store.RestoreAll([]Record{record}); err != nil {
+		t.Fatalf("RestoreAll returned error: %v", err)
+	}
+	if _, found := store.Get(record.Key); !found {
+		t.Fatalf("restored record should be pending")
+	}
+
+	records := store.List()
+	if len(records) != 1 {
+		t.Fatalf("record count = %d, want 1", len(records))
+	}
+	if diff := records[0].ExpiresAt.Sub(deadline); diff < -time.Second || diff > time.Second {
+		t.Fatalf("restored deadline = %v, want about %v", records[0].ExpiresAt, deadline)
+	}
+
+	if err := store.RestoreAll([]Record{{}}); err == nil {
+		t.Fatalf("RestoreAll without key should return error")
+	}
+}
+
+func TestMemoryCloseStopsEviction(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemory(time.Minute, 10*time.Millisecond)
+	evicted := make(chan string, 1)
+	store.OnEvicted(func(key string, status captcha.JoinStatus) {
+		evicted <- key
+	})
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	record := Record{
+		Key:       Key(1001, -100123),
+		Status:    captcha.JoinStatus{UserID: 1001, ChatID: -100123},
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	if err := store.RestoreAll([]Record{record}); err != nil {
+		t.Fatalf("RestoreAll returned error: %v", err)
+	}
+	select {
+	case key := <-evicted:
+		t.Fatalf("record %q evicted after Close", key)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if len(store.List()) != 1 {
+		t.Fatalf("record count after Close = %d, want 1", len(store.List()))
+	}
+}
+
+func TestFilePersistsSnapshot(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), ".config.yaml.challenges.json")
+	store := NewFile(path, time.Minute, time.Hour)
+
+	chat := &tele.Chat{ID: -100123, Type: tele.ChatSuperGroup, Username: "somegroup"}
+	status := captcha.JoinStatus{
+		UserID:        1001,
+		UserFullName:  "Alice",
+		ChatID:        chat.ID,
+		CaptchaAnswer: []string{"u1", "u2"},
+		CaptchaMessage: tele.Message{
+			ID:   77,
+			Chat: chat,
+		},
+		Buttons: []tele.InlineButton{{Text: "A", Unique: "u1"}, {Text: "B", Unique: "u2"}},
+	}
+	key := Key(status.UserID, status.ChatID)
+	if err := store.Set(key, status, time.Minute); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+
+	records, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("record count = %d, want 1", len(records))
+	}
+	got := records[0]
+	if got.Key != key {
+		t.Fatalf("record key = %q, want %q", got.Key, key)
+	}
+	if got.Status.CaptchaMessage.ID != 77 || got.Status.CaptchaMessage.Chat == nil || got.Status.CaptchaMessage.Chat.ID != chat.ID {
+		t.Fatalf("captcha message = %+v, want id 77 in chat %d", got.Status.CaptchaMessage, chat.ID)
+	}
+	if len(got.Status.Buttons) != 2 || got.Status.Buttons[1].Unique != "u2" {
+		t.Fatalf("buttons = %+v, want persisted button uniques", got.Status.Buttons)
+	}
+	if len(got.Status.CaptchaAnswer) != 2 {
+		t.Fatalf("captcha answer count = %d, want 2", len(got.Status.CaptchaAnswer))
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	records, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("record count after delete = %d, want 0", len(records))
+	}
+}
+
+func TestFileCheckDoesNotWriteSnapshot(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".config.yaml.challenges.json")
+	store := NewFile(path, time.Minute, time.Hour)
+	if err := store.Check(); err != nil {
+		t.Fatalf("Check returned error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Check created the snapshot file, stat err = %v", err)
+	}
+
+	missing := NewFile(filepath.Join(dir, "missing", ".config.yaml.challenges.json"), time.Minute, time.Hour)
+	if err := missing.Check(); err == nil {
+		t.Fatal("Check with a missing state directory returned no error")
+	}
+
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatalf("Mkdir returned error: %v", err)
+	}
+	if err := store.Check(); err == nil {
+		t.Fatal("Check with a directory in place of the snapshot returned no error")
+	}
+}
+
+func TestFileRestoreAllPersistsEveryRecord(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), ".config.yaml.challenges.json")
+	store := NewFile(path, time.Minute, time.Hour)
+	deadline := time.Now().Add(time.Minute)
+	records := []Record{
+		{Key: Key(1001, -100123), Status: captcha.JoinStatus{UserID: 1001, ChatID: -100123}, ExpiresAt: deadline},
+		{Key: Key(1002, -100123), Status: captcha.JoinStatus{UserID: 1002, ChatID: -100123}, ExpiresAt: deadline},
+	}
+	if err := store.RestoreAll(records); err != nil {
+		t.Fatalf("RestoreAll returned error: %v", err)
+	}
+
+	persisted, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(persisted) != 2 {
+		t.Fatalf("record count = %d, want 2", len(persisted))
+	}
+
+	if err := store.RestoreAll([]Record{records[0], {}}); err == nil {
+		t.Fatal("RestoreAll with an empty key returned no error")
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary snapshot left behind, stat err = %v", err)
+	}
+}
+
+func TestFileEvictionRemovesRecordFromSnapshot(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), ".config.yaml.challenges.json")
+	store := NewFile(path, time.Minute, 10*time.Millisecond)
+	evicted := make(chan struct{}, 1)
+	store.OnEvicted(func(key string, status captcha.JoinStatus) {
+		evicted <- struct{}{}
+	})
+
+	record := Record{
+		Key:       Key(1001, -100123),
+		Status:    captcha.JoinStatus{UserID: 1001, ChatID: -100123},
+		ExpiresAt: time.Now().Add(-time.Second),
+	}
+	if err := store.RestoreAll([]Record{record}); err != nil {
+		t.Fatalf("RestoreAll returned error: %v", err)
+	}
+
+	select {
+	case <-evicted:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected expired record to be evicted")
+	}
+
+	records, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("record count after eviction = %d, want 0", len(records))
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	t.Parallel()
+
+	records, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("record count = %d, want 0", len(records))
+	}
+}
@@ -13,15 +13,48 @@ type cliOptions struct {
 	showHelp    bool
 }
 
+// Subcommands accepted as the first positional argument. Without one the
+// bot runs.
+const (
+	CommandRun          = ""
+	CommandValidate     = "validate"
+	CommandPrintConfig  = "print-config"
+	CommandRenderSample = "render-sample"
+)
+
+// Defaults of the render-sample flags.
+const (
+	DefaultSampleCount = 5
+	DefaultSampleDir   = "captcha-samples"
+)
+
+// sampleFlags may only be used with render-sample.
+var sampleFlags = map[string]struct{}{
+	"n":     {},
+	"count": {},
+	"o":     {},
+	"out":   {},
+	"type":  {},
+}
+
 type Options struct {
 	ConfigPath  string
 	ShowVersion bool
 	ShowHelp    bool
+	Command     string
+
+	// SampleCount, SampleDir and SampleType configure render-sample. An
+	// empty SampleType means the configured captcha.challenge.
+	SampleCount int
+	SampleDir   string
+	SampleType  string
 }
 
 func ParseArgs(args []string, defaultConfigPath string) (Options, error) {
 	opts := Options{
-		ConfigPath: defaultConfigPath,
+		ConfigPath:  defaultConfigPath,
+		SampleCount: DefaultSampleCount,
+		SampleDir:   DefaultSampleDir,
 	}
 
 	fs := flag.NewFlagSet("toshiki-captcha-bot", flag.ContinueOnError)
@@ -33,14 +66,47 @@ func ParseArgs(args []string, defaultConfigPath string) (Options, error) {
 	fs.BoolVar(&opts.ShowVersion, "version", false, "Print version and exit")
 	fs.BoolVar(&opts.ShowHelp, "h", false, "Show help and exit")
 	fs.BoolVar(&opts.ShowHelp, "help", false, "Show help and exit")
+	fs.IntVar(&opts.SampleCount, "n", DefaultSampleCount, "Number of samples to render")
+	fs.IntVar(&opts.SampleCount, "count", DefaultSampleCount, "Number of samples to render")
+	fs.StringVar(&opts.SampleDir, "o", DefaultSampleDir, "Directory to write samples to")
+	fs.StringVar(&opts.SampleDir, "out", DefaultSampleDir, "Directory to write samples to")
+	fs.StringVar(&opts.SampleType, "type", "", "Challenge type to render")
 
 	if err := fs.Parse(args); err != nil {
 		return Options{}, err
 	}
+	if rest := fs.Args(); len(rest) > 0 {
+		switch rest[0] {
+		case CommandValidate, CommandPrintConfig, CommandRenderSample:
+			opts.Command = rest[0]
+		default:
+			return Options{}, fmt.Errorf("unknown command %q", rest[0])
+		}
+		// Flags may also follow the command, as in `validate -c prod.yaml`.
+		if err := fs.Parse(rest[1:]); err != nil {
+			return Options{}, err
+		}
+	}
 	if len(fs.Args()) > 0 {
 		return Options{}, fmt.Errorf("unexpected positional arguments: %s", strings.Join(fs.Args(), " "))
 	}
 
+	var misplaced string
+	fs.Visit(func(f *flag.Flag) {
+		if _, ok := sampleFlags[f.Name]; ok && opts.Command != CommandRenderSample {
+			misplaced = f.Name
+		}
+	})
+	if misplaced != "" {
+		return Options{}, fmt.Errorf("flag -%s is only valid with %s", misplaced, CommandRenderSample)
+	}
+	if opts.SampleCount <= 0 {
+		return Options{}, fmt.Errorf("sample count must be greater than zero")
+	}
+	if strings.TrimSpace(opts.SampleDir) == "" {
+		return Options{}, fmt.Errorf("sample directory must not be empty")
+	}
+
 	return opts, nil
 }
 
@@ -48,11 +114,25 @@ func UsageText(defaultConfigPath string) string {
 	return fmt.Sprintf(`Telegram CAPTCHA bot
 
 Usage:
-  toshiki-captcha-bot [options]
+  toshiki-captcha-bot [options] [command]
+
+Commands:
+  validate              Load and validate the config, exit non-zero when invalid
+  print-config          Print the effective config after defaults, environment
+                        overrides and normalization, with secrets redacted
+  render-sample         Render sample challenges to image files and print
+                        their answers and button layout
+
+Without a command the bot starts.
 
 Options:
   -c, --config <path>   YAML configuration path (default: %s)
   -v, --version         Print version and exit
   -h, --help            Show this help and exit
-`, defaultConfigPath)
+
+render-sample options:
+  -n, --count <n>       Number of samples to render (default: %d)
+  -o, --out <dir>       Directory to write samples to (default: %s)
+      --type <type>     Challenge type to render (default: captcha.challenge)
+`, defaultConfigPath, DefaultSampleCount, DefaultSampleDir)
 }
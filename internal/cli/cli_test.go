@@ -13,6 +13,7 @@ func TestParseCLIArgs(t *testing.T) {
 		wantPath  string
 		wantHelp  bool
 		wantVer   bool
+		wantCmd   string
 		expectErr bool
 	}{
 		{
@@ -54,6 +55,45 @@ func TestParseCLIArgs(t *testing.T) {
 			wantPath: defaultConfigPath,
 			wantHelp: true,
 		},
+		{
+			name:     "validate command",
+			args:     []string{"validate"},
+			wantPath: defaultConfigPath,
+			wantCmd:  CommandValidate,
+		},
+		{
+			name:     "flags before command",
+			args:     []string{"-c", "/tmp/custom.yaml", "print-config"},
+			wantPath: "/tmp/custom.yaml",
+			wantCmd:  CommandPrintConfig,
+		},
+		{
+			name:     "flags after command",
+			args:     []string{"validate", "--config", "./custom.yaml"},
+			wantPath: "./custom.yaml",
+			wantCmd:  CommandValidate,
+		},
+		{
+			name:     "render-sample with flags",
+			args:     []string{"render-sample", "-n", "3", "--out", "/tmp/samples", "--type", "arithmetic"},
+			wantPath: defaultConfigPath,
+			wantCmd:  CommandRenderSample,
+		},
+		{
+			name:      "sample flag without render-sample",
+			args:      []string{"-n", "3", "validate"},
+			expectErr: true,
+		},
+		{
+			name:      "zero sample count",
+			args:      []string{"render-sample", "--count", "0"},
+			expectErr: true,
+		},
+		{
+			name:      "argument after command",
+			args:      []string{"validate", "extra"},
+			expectErr: true,
+		},
 		{
 			name:      "unexpected positional argument",
 			args:      []string{"run"},
@@ -88,9 +128,32 @@ func TestParseCLIArgs(t *testing.T) {
 			if got.ShowHelp != tt.wantHelp {
 				t.Fatalf("showHelp = %v, want %v", got.ShowHelp, tt.wantHelp)
 			}
+			if got.Command != tt.wantCmd {
+				t.Fatalf("command = %q, want %q", got.Command, tt.wantCmd)
+			}
 			if got.ShowVersion != tt.wantVer {
 				t.Fatalf("showVersion = %v, want %v", got.ShowVersion, tt.wantVer)
 			}
 		})
 	}
 }
+
+func TestParseArgsRenderSample(t *testing.T) {
+	t.Parallel()
+
+	got, err := ParseArgs([]string{"render-sample"}, "config.yaml")
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if got.SampleCount != DefaultSampleCount || got.SampleDir != DefaultSampleDir || got.SampleType != "" {
+		t.Fatalf("render-sample defaults = %d %q %q", got.SampleCount, got.SampleDir, got.SampleType)
+	}
+
+	got, err = ParseArgs([]string{"render-sample", "-n", "3", "-o", "out", "--type", "arithmetic"}, "config.yaml")
+	if err != nil {
+		t.Fatalf("ParseArgs returned error: %v", err)
+	}
+	if got.SampleCount != 3 || got.SampleDir != "out" || got.SampleType != "arithmetic" {
+		t.Fatalf("render-sample options = %d %q %q", got.SampleCount, got.SampleDir, got.SampleType)
+	}
+}
@@ -0,0 +1,117 @@
+package i18n
+
+// english is the reference catalog. Every other language is checked against
+// its keys and format verbs.
+var english = map[Key]string{
+	"instruction.emoji_sequence": "Select all the emoji you see in the picture in exact left-to-right order.",
+	"instruction.arithmetic":     "Solve the arithmetic problem in the picture and select the correct result.",
+	"instruction.odd_one_out":    "Select the one emoji in the picture that is different from all the others.",
+
+	// %[1]s instruction, %[2]d max failures, %[3]s duration, %[4]s closing.
+	CaptionBody:         "%[1]s\n\n Max failure: %[2]d mistake \n Duration: %[3]s\n\n %[4]s",
+	CaptionClosingGroup: "Please leave group immediately if you are not ready with the bot",
+	// %s group name.
+	CaptionClosingJoinRequest: "Solve it to have your request to join %s approved",
+	GroupNameFallback:         "the group",
+
+	// %s mention.
+	FailureNoticeNoAction: "%s captcha failed.",
+	// %[1]s mention, %[2]s outcome.
+	FailureNotice: "Captcha failed, %[1]s %[2]s",
+	// %s mention.
+	FailureNoticeContact: ", please contact administrator if %s are real human with non-automated account",
+	// %s time until removal.
+	FailureNoticeRemoval: "\n\n this message will automatically removed in %s...",
+	// %s mention.
+	TimeoutNotice: "Captcha timeout, %s did not resolve the challenge in time.",
+
+	OutcomeBanned: "has been banned",
+	// %s ban duration.
+	OutcomeBannedFor: "has been banned for %s",
+	OutcomeKicked:    "has been removed from the group and may rejoin to try again",
+	OutcomeMuted:     "has been muted",
+
+	FailureAlertBanned: "Captcha failed, you have been banned, please contact admin with your another account.",
+	// %s ban duration.
+	FailureAlertBannedFor: "Captcha failed, you have been banned for %s.",
+	FailureAlertKicked:    "Captcha failed, you have been removed from the group. You may rejoin to try again.",
+	FailureAlertMuted:     "Captcha failed, you have been muted, please contact admin.",
+	FailureAlertNoAction:  "Captcha failed.",
+
+	SuccessJoined:      "Successfully joined.",
+	SuccessManual:      "Manual test captcha completed successfully.",
+	SuccessJoinRequest: "Captcha solved, your join request has been approved.",
+	NotYourCaptcha:     "This is not your captcha challenge. Please solve your own challenge.",
+	WrongAnswer:        "Wrong answer. Please continue with the current puzzle.",
+	WrongAnswerNew:     "Wrong answer. A new puzzle has been generated.",
+
+	JoinRequestFailedAlert: "Captcha failed, your join request has been declined.",
+	// %s group name.
+	JoinRequestDeclinedFailure: "Captcha failed, your request to join %s has been declined.",
+	// %s group name.
+	JoinRequestDeclinedTimeout: "Captcha timeout, your request to join %s has been declined. You may send a new request to try again.",
+
+	// %[1]s mention, %[2]s expiration.
+	PromptText:         "%[1]s, please open the captcha in a private chat with me within %[2]s to be able to write here.",
+	PromptButton:       "Solve captcha",
+	StartLinkExpired:   "This captcha link has expired or belongs to someone else.",
+	StartPrepareFailed: "Failed to prepare the captcha, please open the link again.",
+
+	DurationHour:    "1 hour",
+	DurationHours:   "%d hours",
+	DurationMinute:  "1 minute",
+	DurationMinutes: "%d minutes",
+	DurationSecond:  "1 second",
+	DurationSeconds: "%d seconds",
+}
+
+var chinese = map[Key]string{
+	"instruction.emoji_sequence": "请按照图片中从左到右的顺序，依次选择你看到的所有表情。",
+	"instruction.arithmetic":     "请计算图片中的算式，并选择正确的结果。",
+	"instruction.odd_one_out":    "请选择图片中与其他表情都不同的那一个。",
+
+	CaptionBody:               "%[1]s\n\n 最多允许错误：%[2]d 次 \n 时限：%[3]s\n\n %[4]s",
+	CaptionClosingGroup:       "如果你还没准备好完成验证，请立即退出群组",
+	CaptionClosingJoinRequest: "完成验证后，你加入 %s 的申请将被批准",
+	GroupNameFallback:         "该群组",
+
+	FailureNoticeNoAction: "%s 验证失败。",
+	FailureNotice:         "验证失败，%[1]s %[2]s",
+	FailureNoticeContact:  "。如果 %s 是真人使用的非自动化账号，请联系管理员",
+	FailureNoticeRemoval:  "\n\n 此消息将在 %s后自动删除……",
+	TimeoutNotice:         "验证超时，%s 未能在规定时间内完成验证。",
+
+	OutcomeBanned:    "已被封禁",
+	OutcomeBannedFor: "已被封禁 %s",
+	OutcomeKicked:    "已被移出群组，可以重新加入再试一次",
+	OutcomeMuted:     "已被禁言",
+
+	FailureAlertBanned:    "验证失败，你已被封禁，请使用其他账号联系管理员。",
+	FailureAlertBannedFor: "验证失败，你已被封禁 %s。",
+	FailureAlertKicked:    "验证失败，你已被移出群组，可以重新加入再试一次。",
+	FailureAlertMuted:     "验证失败，你已被禁言，请联系管理员。",
+	FailureAlertNoAction:  "验证失败。",
+
+	SuccessJoined:      "验证成功，欢迎加入。",
+	SuccessManual:      "手动测试验证已成功完成。",
+	SuccessJoinRequest: "验证成功，你的入群申请已被批准。",
+	NotYourCaptcha:     "这不是你的验证题，请完成你自己的验证。",
+	WrongAnswer:        "答案错误，请继续完成当前题目。",
+	WrongAnswerNew:     "答案错误，已为你生成新的题目。",
+
+	JoinRequestFailedAlert:     "验证失败，你的入群申请已被拒绝。",
+	JoinRequestDeclinedFailure: "验证失败，你加入 %s 的申请已被拒绝。",
+	JoinRequestDeclinedTimeout: "验证超时，你加入 %s 的申请已被拒绝。你可以重新提交申请再试一次。",
+
+	PromptText:         "%[1]s，请在 %[2]s内与我私聊完成验证，之后即可在此发言。",
+	PromptButton:       "开始验证",
+	StartLinkExpired:   "此验证链接已过期或不属于你。",
+	StartPrepareFailed: "验证准备失败，请重新打开链接。",
+
+	DurationHour:    "1 小时",
+	DurationHours:   "%d 小时",
+	DurationMinute:  "1 分钟",
+	DurationMinutes: "%d 分钟",
+	DurationSecond:  "1 秒",
+	DurationSeconds: "%d 秒",
+}
@@ -0,0 +1,161 @@
+// Package i18n holds the texts the bot shows to group members and
+// applicants. Admin command replies and logs stay in English.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultLanguage is used when captcha.language is not set.
+const DefaultLanguage = "en"
+
+// Key names one translatable text. Texts are fmt format strings; the verbs
+// each key expects are listed next to its English text.
+type Key string
+
+const (
+	CaptionBody               Key = "caption.body"
+	CaptionClosingGroup       Key = "caption.closing_group"
+	CaptionClosingJoinRequest Key = "caption.closing_join_request"
+	GroupNameFallback         Key = "group_name_fallback"
+
+	FailureNoticeNoAction Key = "failure_notice.no_action"
+	FailureNotice         Key = "failure_notice"
+	FailureNoticeContact  Key = "failure_notice.contact"
+	FailureNoticeRemoval  Key = "failure_notice.removal"
+	TimeoutNotice         Key = "timeout_notice"
+
+	OutcomeBanned    Key = "outcome.banned"
+	OutcomeBannedFor Key = "outcome.banned_for"
+	OutcomeKicked    Key = "outcome.kicked"
+	OutcomeMuted     Key = "outcome.muted"
+
+	FailureAlertBanned    Key = "failure_alert.banned"
+	FailureAlertBannedFor Key = "failure_alert.banned_for"
+	FailureAlertKicked    Key = "failure_alert.kicked"
+	FailureAlertMuted     Key = "failure_alert.muted"
+	FailureAlertNoAction  Key = "failure_alert.no_action"
+
+	SuccessJoined      Key = "success.joined"
+	SuccessManual      Key = "success.manual"
+	SuccessJoinRequest Key = "success.join_request"
+	NotYourCaptcha     Key = "not_your_captcha"
+	WrongAnswer        Key = "wrong_answer"
+	WrongAnswerNew     Key = "wrong_answer.new_puzzle"
+
+	JoinRequestFailedAlert     Key = "join_request.failed_alert"
+	JoinRequestDeclinedFailure Key = "join_request.declined_failure"
+	JoinRequestDeclinedTimeout Key = "join_request.declined_timeout"
+
+	PromptText         Key = "prompt.text"
+	PromptButton       Key = "prompt.button"
+	StartLinkExpired   Key = "start.link_expired"
+	StartPrepareFailed Key = "start.prepare_failed"
+
+	DurationHour    Key = "duration.hour"
+	DurationHours   Key = "duration.hours"
+	DurationMinute  Key = "duration.minute"
+	DurationMinutes Key = "duration.minutes"
+	DurationSecond  Key = "duration.second"
+	DurationSeconds Key = "duration.seconds"
+)
+
+// InstructionKey returns the key of the instruction for a challenge type.
+func InstructionKey(challengeType string) Key {
+	return Key("instruction." + challengeType)
+}
+
+var catalogs = map[string]map[Key]string{
+	"en": english,
+	"zh": chinese,
+}
+
+// Messages renders texts in one language, falling back to English for keys
+// the language does not define.
+type Messages struct {
+	language string
+	texts    map[Key]string
+}
+
+// Normalize returns the canonical form of a language code, or an error
+// listing the supported languages.
+func Normalize(language string) (string, error) {
+	clean := strings.ToLower(strings.TrimSpace(language))
+	if _, ok := catalogs[clean]; !ok {
+		return "", fmt.Errorf("unsupported language %q, expected one of %s", language, strings.Join(Languages(), ", "))
+	}
+	return clean, nil
+}
+
+// Languages returns the supported language codes, sorted.
+func Languages() []string {
+	languages := make([]string, 0, len(catalogs))
+	for language := range catalogs {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// For returns the messages of language. Unknown languages get English.
+func For(language string) Messages {
+	clean, err := Normalize(language)
+	if err != nil {
+		clean = DefaultLanguage
+	}
+	return Messages{language: clean, texts: catalogs[clean]}
+}
+
+// Language returns the language code of m.
+func (m Messages) Language() string {
+	if m.language == "" {
+		return DefaultLanguage
+	}
+	return m.language
+}
+
+// Has reports whether the language of m defines key itself.
+func (m Messages) Has(key Key) bool {
+	_, ok := m.texts[key]
+	return ok
+}
+
+// Text formats key with args.
+func (m Messages) Text(key Key, args ...interface{}) string {
+	format, ok := m.texts[key]
+	if !ok {
+		format, ok = english[key]
+	}
+	if !ok {
+		return string(key)
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Duration spells out d in whole hours, minutes or seconds when it divides
+// evenly, and falls back to Go's notation otherwise.
+func (m Messages) Duration(d time.Duration) string {
+	if d%time.Hour == 0 && d >= time.Hour {
+		return m.plural(int(d/time.Hour), DurationHour, DurationHours)
+	}
+	if d%time.Minute == 0 && d >= time.Minute {
+		return m.plural(int(d/time.Minute), DurationMinute, DurationMinutes)
+	}
+	if d%time.Second == 0 {
+		return m.plural(int(d/time.Second), DurationSecond, DurationSeconds)
+	}
+	return d.String()
+}
+
+func (m Messages) plural(n int, one, many Key) string {
+	if n == 1 {
+		return m.Text(one)
+	}
+	return m.Text(many, n)
+}
@@ -0,0 +1,107 @@
+package i18n
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var formatVerbPattern = regexp.MustCompile(`%(\[\d+\])?[a-z]`)
+
+func formatVerbs(format string) []string {
+	verbs := formatVerbPattern.FindAllString(format, -1)
+	sort.Strings(verbs)
+	return verbs
+}
+
+func TestCatalogsMatchEnglish(t *testing.T) {
+	t.Parallel()
+
+	for language, texts := range catalogs {
+		for key, english := range english {
+			text, ok := texts[key]
+			if !ok {
+				t.Errorf("%s: missing %s", language, key)
+				continue
+			}
+			if got, want := strings.Join(formatVerbs(text), " "), strings.Join(formatVerbs(english), " "); got != want {
+				t.Errorf("%s: %s verbs = %q, want %q", language, key, got, want)
+			}
+		}
+		for key := range texts {
+			if _, ok := english[key]; !ok {
+				t.Errorf("%s: unknown key %s", language, key)
+			}
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		language string
+		want     string
+		wantErr  bool
+	}{
+		{language: "en", want: "en"},
+		{language: " ZH ", want: "zh"},
+		{language: "", wantErr: true},
+		{language: "tlh", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Normalize(tt.language)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("Normalize(%q) error = %v, wantErr %t", tt.language, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Fatalf("Normalize(%q) = %q, want %q", tt.language, got, tt.want)
+		}
+	}
+}
+
+func TestMessagesText(t *testing.T) {
+	t.Parallel()
+
+	if got := For("zh").Text(GroupNameFallback); got != "该群组" {
+		t.Fatalf("zh GroupNameFallback = %q", got)
+	}
+	if got := For("tlh").Language(); got != DefaultLanguage {
+		t.Fatalf("For(unknown).Language() = %q, want %q", got, DefaultLanguage)
+	}
+	if got := For("en").Text(OutcomeBannedFor, "2 hours"); got != "has been banned for 2 hours" {
+		t.Fatalf("en OutcomeBannedFor = %q", got)
+	}
+	if !For("en").Has(InstructionKey("arithmetic")) {
+		t.Fatalf("en is missing the arithmetic instruction")
+	}
+	if !For("zh").Has(InstructionKey("arithmetic")) {
+		t.Fatalf("zh is missing the arithmetic instruction")
+	}
+}
+
+func TestMessagesDuration(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		language string
+		duration time.Duration
+		want     string
+	}{
+		{language: "en", duration: time.Hour, want: "1 hour"},
+		{language: "en", duration: 3 * time.Hour, want: "3 hours"},
+		{language: "en", duration: time.Minute, want: "1 minute"},
+		{language: "en", duration: 90 * time.Second, want: "90 seconds"},
+		{language: "en", duration: 1500 * time.Millisecond, want: "1.5s"},
+		{language: "zh", duration: 2 * time.Minute, want: "2 分钟"},
+	}
+
+	for _, tt := range tests {
+		if got := For(tt.language).Duration(tt.duration); got != tt.want {
+			t.Fatalf("For(%q).Duration(%s) = %q, want %q", tt.language, tt.duration, got, tt.want)
+		}
+	}
+}
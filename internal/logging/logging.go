@@ -0,0 +1,271 @@
+// Package logging writes leveled, structured log records as text or JSON
+// lines. A record is an event name followed by key/value fields:
+//
+//	logging.Info("captcha_issued", "chat_id", chat.ID, "user_id", user.ID)
+//
+// renders in text format as
+//
+//	2024-01-01T12:00:00.000Z INFO captcha_issued chat_id=-100123 user_id=42
+//
+// and in JSON format as
+//
+//	{"time":"2024-01-01T12:00:00.000Z","level":"info","event":"captcha_issued","chat_id":-100123,"user_id":42}
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// Level is the severity of a record.
+type Level int
+
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// timeLayout is RFC 3339 with millisecond precision.
+const timeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+// ParseLevel maps debug, info, warn or error to its Level.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+}
+
+// Logger writes records at or above its level to one writer. Loggers
+// derived with With share the writer and its lock.
+type Logger struct {
+	out    *syncWriter
+	json   bool
+	level  Level
+	fields []interface{}
+	now    func() time.Time
+}
+
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// New returns a logger writing format records at level and above to out.
+// An unknown format falls back to text.
+func New(out io.Writer, format string, level Level) *Logger {
+	return &Logger{
+		out:   &syncWriter{w: out},
+		json:  format == FormatJSON,
+		level: level,
+		now:   time.Now,
+	}
+}
+
+// With returns a logger that adds fields to every record.
+func (l *Logger) With(fields ...interface{}) *Logger {
+	derived := *l
+	derived.fields = append(append([]interface{}(nil), l.fields...), fields...)
+	return &derived
+}
+
+// Enabled reports whether records at level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Debug(event string, fields ...interface{}) { l.log(LevelDebug, event, fields) }
+func (l *Logger) Info(event string, fields ...interface{})  { l.log(LevelInfo, event, fields) }
+func (l *Logger) Warn(event string, fields ...interface{})  { l.log(LevelWarn, event, fields) }
+func (l *Logger) Error(event string, fields ...interface{}) { l.log(LevelError, event, fields) }
+
+func (l *Logger) log(level Level, event string, fields []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	all := fields
+	if len(l.fields) > 0 {
+		all = append(append([]interface{}(nil), l.fields...), fields...)
+	}
+
+	var buf bytes.Buffer
+	now := l.now()
+	if l.json {
+		writeJSON(&buf, now, level, event, all)
+	} else {
+		writeText(&buf, now, level, event, all)
+	}
+	buf.WriteByte('\n')
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(buf.Bytes())
+}
+
+func writeText(buf *bytes.Buffer, now time.Time, level Level, event string, fields []interface{}) {
+	buf.WriteString(now.Format(timeLayout))
+	buf.WriteByte(' ')
+	buf.WriteString(strings.ToUpper(level.String()))
+	buf.WriteByte(' ')
+	buf.WriteString(event)
+	eachField(fields, func(key string, value interface{}) {
+		buf.WriteByte(' ')
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(textValue(value))
+	})
+}
+
+func writeJSON(buf *bytes.Buffer, now time.Time, level Level, event string, fields []interface{}) {
+	buf.WriteString(`{"time":`)
+	writeJSONValue(buf, now.Format(timeLayout))
+	buf.WriteString(`,"level":`)
+	writeJSONValue(buf, level.String())
+	buf.WriteString(`,"event":`)
+	writeJSONValue(buf, event)
+	eachField(fields, func(key string, value interface{}) {
+		buf.WriteByte(',')
+		writeJSONValue(buf, key)
+		buf.WriteByte(':')
+		writeJSONValue(buf, jsonValue(value))
+	})
+	buf.WriteByte('}')
+}
+
+// eachField walks fields as key/value pairs. A trailing key without a value
+// is reported under the key "extra".
+func eachField(fields []interface{}, fn func(key string, value interface{})) {
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 == len(fields) {
+			fn("extra", fields[i])
+			return
+		}
+		key, ok := fields[i].(string)
+		if !ok {
+			key = fmt.Sprint(fields[i])
+		}
+		fn(key, fields[i+1])
+	}
+}
+
+func textValue(value interface{}) string {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		return "<nil>"
+	case string:
+		text = v
+	case error:
+		text = v.Error()
+	case fmt.Stringer:
+		text = v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+	if needsQuoting(text) {
+		return strconv.Quote(text)
+	}
+	return text
+}
+
+func needsQuoting(text string) bool {
+	if text == "" {
+		return true
+	}
+	for _, r := range text {
+		if unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v.Format(timeLayout)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+func writeJSONValue(buf *bytes.Buffer, value interface{}) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		raw, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(raw)
+}
+
+var std atomic.Value
+
+func init() {
+	std.Store(New(os.Stderr, FormatText, LevelInfo))
+}
+
+// Default returns the logger used by the package-level functions.
+func Default() *Logger {
+	return std.Load().(*Logger)
+}
+
+// SetDefault replaces the logger used by the package-level functions.
+func SetDefault(l *Logger) {
+	std.Store(l)
+}
+
+func Debug(event string, fields ...interface{}) { Default().log(LevelDebug, event, fields) }
+func Info(event string, fields ...interface{})  { Default().log(LevelInfo, event, fields) }
+func Warn(event string, fields ...interface{})  { Default().log(LevelWarn, event, fields) }
+func Error(event string, fields ...interface{}) { Default().log(LevelError, event, fields) }
+
+// Fatal logs an error record and exits with status 1.
+func Fatal(event string, fields ...interface{}) {
+	Default().log(LevelError, event, fields)
+	os.Exit(1)
+}
@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoggerFormats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{
+			name:   "text",
+			format: FormatText,
+			want:   `2024-01-02T03:04:05.006Z WARN captcha_failed component=app chat_id=-100123 user_id=42 reason="two words" err="send: timeout" ttl=1m0s extra=dangling` + "\n",
+		},
+		{
+			name:   "json",
+			format: FormatJSON,
+			want:   `{"time":"2024-01-02T03:04:05.006Z","level":"warn","event":"captcha_failed","component":"app","chat_id":-100123,"user_id":42,"reason":"two words","err":"send: timeout","ttl":"1m0s","extra":"dangling"}` + "\n",
+		},
+		{
+			name:   "unknown format falls back to text",
+			format: "xml",
+			want:   `2024-01-02T03:04:05.006Z WARN captcha_failed component=app chat_id=-100123 user_id=42 reason="two words" err="send: timeout" ttl=1m0s extra=dangling` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			logger := New(&buf, tt.format, LevelInfo).With("component", "app")
+			logger.now = func() time.Time { return now }
+			logger.Warn(
+				"captcha_failed",
+				"chat_id", int64(-100123),
+				"user_id", int64(42),
+				"reason", "two words",
+				"err", errors.New("send: timeout"),
+				"ttl", time.Minute,
+				"dangling",
+			)
+			if got := buf.String(); got != tt.want {
+				t.Fatalf("record =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoggerLevelFilter(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := New(&buf, FormatText, LevelWarn)
+	logger.Debug("debug_event")
+	logger.Info("info_event")
+	logger.Warn("warn_event")
+	logger.Error("error_event")
+
+	got := buf.String()
+	for _, dropped := range []string{"debug_event", "info_event"} {
+		if bytes.Contains([]byte(got), []byte(dropped)) {
+			t.Fatalf("output contains %s below the warn level:\n%s", dropped, got)
+		}
+	}
+	for _, kept := range []string{" WARN warn_event\n", " ERROR error_event\n"} {
+		if !bytes.Contains([]byte(got), []byte(kept)) {
+			t.Fatalf("output missing %q:\n%s", kept, got)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input   string
+		want    Level
+		wantErr bool
+	}{
+		{input: "debug", want: LevelDebug},
+		{input: " INFO ", want: LevelInfo},
+		{input: "warning", want: LevelWarn},
+		{input: "error", want: LevelError},
+		{input: "trace", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseLevel(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLevel(%q) error = %v, wantErr %t", tt.input, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Fatalf("ParseLevel(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteText(t *testing.T) {
+	t.Parallel()
+
+	registry := NewRegistry()
+	requests := registry.NewCounterVec("test_requests_total", "Requests handled.", "chat", "result")
+	registry.NewGaugeFunc("test_pending", "Pending work.", func() float64 { return 3 })
+	latency := registry.NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "method")
+
+	requests.Inc("-100", "ok")
+	requests.Inc("-100", "ok")
+	requests.Add(2, "-200", `say "hi"`)
+	requests.Add(-1, "-100", "ok")
+	latency.Observe(0.05, "send")
+	latency.Observe(0.5, "send")
+	latency.Observe(5, "send")
+
+	var b strings.Builder
+	registry.WriteText(&b)
+
+	want := `# HELP test_requests_total Requests handled.
+# TYPE test_requests_total counter
+test_requests_total{chat="-100",result="ok"} 2
+test_requests_total{chat="-200",result="say \"hi\""} 2
+# HELP test_pending Pending work.
+# TYPE test_pending gauge
+test_pending 3
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{method="send",le="0.1"} 1
+test_latency_seconds_bucket{method="send",le="1"} 2
+test_latency_seconds_bucket{method="send",le="+Inf"} 3
+test_latency_seconds_sum{method="send"} 5.55
+test_latency_seconds_count{method="send"} 3
+`
+	if got := b.String(); got != want {
+		t.Fatalf("WriteText =\n%s\nwant\n%s", got, want)
+	}
+	if got := requests.Value("-100", "ok"); got != 2 {
+		t.Fatalf("Value = %v, want 2", got)
+	}
+	if got := latency.Count("send"); got != 3 {
+		t.Fatalf("Count = %d, want 3", got)
+	}
+}
+
+func TestRegistryHandler(t *testing.T) {
+	t.Parallel()
+
+	registry := NewRegistry()
+	registry.NewCounterVec("test_total", "Test.").Inc()
+
+	recorder := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if got := recorder.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type = %q", got)
+	}
+	if !strings.Contains(recorder.Body.String(), "test_total 1\n") {
+		t.Fatalf("body = %q, want test_total 1", recorder.Body.String())
+	}
+}
@@ -21,18 +21,30 @@ func IsPublicGroupChat(chat *tele.Chat) bool {
 	return strings.TrimSpace(chat.Username) != ""
 }
 
+// IsAllowedGroupChat reports whether the bot serves chat. Public mode
+// serves every public group; private mode serves the groups listed in
+// config, matched by chat ID or username.
 func IsAllowedGroupChat(chat *tele.Chat, config settings.RuntimeConfig) bool {
 	if !IsGroupChat(chat) {
 		return false
 	}
-	if !IsPublicGroupChat(chat) {
+	if config.IsPublicMode() {
+		return IsPublicGroupChat(chat)
+	}
+
+	return config.IsAllowedGroup(chat.ID, chat.Username)
+}
+
+// IsSupportedGroupChat reports whether chat is a group the bot can stay in:
+// any public group, or a private group allowlisted by its chat ID.
+func IsSupportedGroupChat(chat *tele.Chat, config settings.RuntimeConfig) bool {
+	if !IsGroupChat(chat) {
 		return false
 	}
-	if config.IsPublicMode() {
+	if IsPublicGroupChat(chat) {
 		return true
 	}
-
-	return config.IsAllowedPublicGroupUsername(chat.Username)
+	return !config.IsPublicMode() && config.IsAllowedGroup(chat.ID, "")
 }
 
 func IsAllowedCommandChat(chat *tele.Chat, config settings.RuntimeConfig) bool {
@@ -75,7 +75,7 @@ func TestIsAllowedGroupChat(t *testing.T) {
 	publicCfg := mustValidateConfig(t, settings.DefaultRuntimeConfig())
 	privateCfg := settings.DefaultRuntimeConfig()
 	privateCfg.Bot.AdminUserIDs = []int64{1001}
-	privateCfg.Groups = []settings.GroupTopicConfig{{ID: "@allowedgroup"}}
+	privateCfg.Groups = []settings.GroupTopicConfig{{ID: "@allowedgroup"}, {ID: "-1001234567890"}}
 	privateCfg = mustValidateConfig(t, privateCfg)
 
 	tests := []struct {
@@ -84,6 +84,10 @@ func TestIsAllowedGroupChat(t *testing.T) {
 		chat   *tele.Chat
 		wantOK bool
 	}{
+		{name: "private mode allows private groups listed by chat id", cfg: privateCfg, chat: &tele.Chat{ID: -1001234567890, Type: tele.ChatSuperGroup}, wantOK: true},
+		{name: "private mode allows public groups listed by chat id", cfg: privateCfg, chat: &tele.Chat{ID: -1001234567890, Type: tele.ChatSuperGroup, Username: "renamedgroup"}, wantOK: true},
+		{name: "private mode rejects unlisted chat ids", cfg: privateCfg, chat: &tele.Chat{ID: -1009999999999, Type: tele.ChatSuperGroup}, wantOK: false},
+		{name: "public mode ignores chat ids of private groups", cfg: publicCfg, chat: &tele.Chat{ID: -1001234567890, Type: tele.ChatSuperGroup}, wantOK: false},
 		{name: "public mode allows any public group", cfg: publicCfg, chat: &tele.Chat{Type: tele.ChatSuperGroup, Username: "anygroup"}, wantOK: true},
 		{name: "public mode rejects private groups", cfg: publicCfg, chat: &tele.Chat{Type: tele.ChatSuperGroup, Username: ""}, wantOK: false},
 		{name: "private mode allows only listed groups", cfg: privateCfg, chat: &tele.Chat{Type: tele.ChatSuperGroup, Username: "allowedgroup"}, wantOK: true},
@@ -102,6 +106,41 @@ func TestIsAllowedGroupChat(t *testing.T) {
 	}
 }
 
+func TestIsSupportedGroupChat(t *testing.T) {
+	t.Parallel()
+
+	publicCfg := mustValidateConfig(t, settings.DefaultRuntimeConfig())
+	privateCfg := settings.DefaultRuntimeConfig()
+	privateCfg.Bot.AdminUserIDs = []int64{1001}
+	privateCfg.Groups = []settings.GroupTopicConfig{{ID: "@allowedgroup"}, {ID: "-1001234567890"}}
+	privateCfg = mustValidateConfig(t, privateCfg)
+
+	tests := []struct {
+		name string
+		cfg  settings.RuntimeConfig
+		chat *tele.Chat
+		want bool
+	}{
+		{name: "nil chat", cfg: privateCfg, chat: nil, want: false},
+		{name: "private user chat", cfg: privateCfg, chat: &tele.Chat{ID: 42, Type: tele.ChatPrivate}, want: false},
+		{name: "any public group", cfg: privateCfg, chat: &tele.Chat{ID: -1, Type: tele.ChatSuperGroup, Username: "othergroup"}, want: true},
+		{name: "allowlisted private group", cfg: privateCfg, chat: &tele.Chat{ID: -1001234567890, Type: tele.ChatSuperGroup}, want: true},
+		{name: "allowlisted private basic group", cfg: privateCfg, chat: &tele.Chat{ID: -1001234567890, Type: tele.ChatGroup}, want: true},
+		{name: "unlisted private group", cfg: privateCfg, chat: &tele.Chat{ID: -1002, Type: tele.ChatSuperGroup}, want: false},
+		{name: "private group in public mode", cfg: publicCfg, chat: &tele.Chat{ID: -1001234567890, Type: tele.ChatSuperGroup}, want: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := IsSupportedGroupChat(tt.chat, tt.cfg); got != tt.want {
+				t.Fatalf("IsSupportedGroupChat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestIsAuthorizedGroupChat(t *testing.T) {
 	t.Parallel()
 
@@ -2,51 +2,259 @@ package settings
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v2"
+	"toshiki-captcha-bot/assets"
+	"toshiki-captcha-bot/internal/captcha"
+	"toshiki-captcha-bot/internal/i18n"
+	"toshiki-captcha-bot/internal/logging"
 )
 
 const DefaultConfigPath = "config.yaml"
 
+const (
+	ChallengeStoreMemory = "memory"
+	ChallengeStoreFile   = "file"
+)
+
+const (
+	CaptchaDeliveryGroup               = "group"
+	CaptchaDeliveryPrivate             = "private"
+	CaptchaDeliveryPrivateWithFallback = "private_with_fallback"
+)
+
+const (
+	CaptchaActionBan    = "ban"
+	CaptchaActionBanFor = "ban_for"
+	CaptchaActionKick   = "kick"
+	CaptchaActionMute   = "mute"
+	CaptchaActionNone   = "none"
+)
+
+// Telegram treats bans shorter than 30 seconds or longer than 366 days as
+// permanent, so ban_for durations must stay inside this window.
+const (
+	MinBanDuration = 30 * time.Second
+	MaxBanDuration = 366 * 24 * time.Hour
+)
+
+// MaxButtonsPerRow is the widest inline keyboard row Telegram renders.
+const MaxButtonsPerRow = 8
+
+const (
+	BotModePolling = "polling"
+	BotModeWebhook = "webhook"
+)
+
 var publicGroupIDPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{4,31}$`)
+var webhookSecretTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
 
 type RuntimeConfig struct {
-	Bot         BotConfig           `yaml:"bot"`
-	Groups      []GroupTopicConfig  `yaml:"groups"`
-	groupAllow  map[string]struct{} `yaml:"-"`
-	groupTopics map[string]int      `yaml:"-"`
-	Captcha     CaptchaConfig       `yaml:"captcha"`
+	Bot           BotConfig             `yaml:"bot"`
+	Groups        []GroupTopicConfig    `yaml:"groups"`
+	groupAllow    map[string]struct{}   `yaml:"-"`
+	groupTopics   map[string]int        `yaml:"-"`
+	groupPolicies map[string]ChatPolicy `yaml:"-"`
+	Captcha       CaptchaConfig         `yaml:"captcha"`
+	Assets        AssetsConfig          `yaml:"assets"`
+	AdminServer   AdminServerConfig     `yaml:"admin_server"`
+	Metrics       MetricsConfig         `yaml:"metrics"`
+	Logging       LoggingConfig         `yaml:"logging"`
+}
+
+// LoggingConfig selects the log record format and the lowest level written.
+type LoggingConfig struct {
+	Format string `yaml:"format"`
+	Level  string `yaml:"level"`
 }
 
+// AssetsConfig points at an optional external asset pack.
+type AssetsConfig struct {
+	Dir string `yaml:"dir"`
+}
+
+// AdminServerConfig enables the HTTP server for health checks and metrics.
+// An empty Listen disables it.
+type AdminServerConfig struct {
+	Listen string `yaml:"listen"`
+	// ReadyThreshold is how long /readyz tolerates no successful getUpdates
+	// call or webhook request.
+	ReadyThreshold time.Duration `yaml:"ready_threshold"`
+}
+
+// MetricsConfig mounts the Prometheus endpoint on the admin server.
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
+}
+
+const (
+	// DefaultMetricsPath is where metrics are served when metrics.path is unset.
+	DefaultMetricsPath = "/metrics"
+	HealthzPath        = "/healthz"
+	ReadyzPath         = "/readyz"
+)
+
 type BotConfig struct {
-	Token          string             `yaml:"token"`
-	PollTimeout    time.Duration      `yaml:"poll_timeout"`
-	RequestTimeout time.Duration      `yaml:"request_timeout"`
-	AdminUserIDs   []int64            `yaml:"admin_user_ids"`
-	adminUsers     map[int64]struct{} `yaml:"-"`
+	Token           string             `yaml:"token"`
+	TokenFile       string             `yaml:"token_file"`
+	PollTimeout     time.Duration      `yaml:"poll_timeout"`
+	RequestTimeout  time.Duration      `yaml:"request_timeout"`
+	AdminUserIDs    []int64            `yaml:"admin_user_ids"`
+	adminUsers      map[int64]struct{} `yaml:"-"`
+	Mode            string             `yaml:"mode"`
+	Webhook         WebhookConfig      `yaml:"webhook"`
+	ShutdownTimeout time.Duration      `yaml:"shutdown_timeout"`
+}
+
+type WebhookConfig struct {
+	Listen      string `yaml:"listen"`
+	PublicURL   string `yaml:"public_url"`
+	SecretToken string `yaml:"secret_token"`
+	TLSCert     string `yaml:"tls_cert"`
+	TLSKey      string `yaml:"tls_key"`
 }
 
+// GroupTopicConfig is one allowed group, identified by its public @username
+// or by its numeric chat ID. Besides the topic, every captcha policy field
+// may be overridden; zero values inherit the captcha section.
 type GroupTopicConfig struct {
-	ID    string `yaml:"id"`
-	Topic int    `yaml:"topic"`
+	ID               string        `yaml:"id"`
+	Topic            int           `yaml:"topic,omitempty"`
+	Expiration       time.Duration `yaml:"expiration,omitempty"`
+	MaxFailures      int           `yaml:"max_failures,omitempty"`
+	FailureNoticeTTL time.Duration `yaml:"failure_notice_ttl,omitempty"`
+	Challenge        string        `yaml:"challenge,omitempty"`
+	OnFailure        CaptchaAction `yaml:"on_failure,omitempty"`
+	OnTimeout        CaptchaAction `yaml:"on_timeout,omitempty"`
+	Language         string        `yaml:"language,omitempty"`
+	LogChat          int64         `yaml:"log_chat,omitempty"`
+}
+
+// ChatPolicy is the captcha policy in effect for one chat, with the group
+// overrides already applied over the captcha section.
+type ChatPolicy struct {
+	Expiration       time.Duration
+	MaxFailures      int
+	FailureNoticeTTL time.Duration
+	Challenge        string
+	OnFailure        CaptchaAction
+	OnTimeout        CaptchaAction
+	Language         string
+	LogChat          int64
+}
+
+// CaptchaAction is the consequence for a user who fails or does not finish a
+// captcha. In YAML it is either a bare action name such as `kick` or a
+// mapping with `action` and `duration` for `ban_for`.
+type CaptchaAction struct {
+	Action   string        `yaml:"action"`
+	Duration time.Duration `yaml:"duration"`
+}
+
+func (a *CaptchaAction) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*a = CaptchaAction{Action: name}
+		return nil
+	}
+
+	type plain CaptchaAction
+	var decoded plain
+	if err := unmarshal(&decoded); err != nil {
+		return err
+	}
+	*a = CaptchaAction(decoded)
+	return nil
+}
+
+func (a CaptchaAction) MarshalYAML() (interface{}, error) {
+	if a.Duration == 0 {
+		return a.Action, nil
+	}
+	type plain CaptchaAction
+	return plain(a), nil
+}
+
+// IsSet reports whether an action was configured.
+func (a CaptchaAction) IsSet() bool {
+	return a.Action != ""
+}
+
+func (a *CaptchaAction) normalize(field string) error {
+	a.Action = strings.ToLower(strings.TrimSpace(a.Action))
+	switch a.Action {
+	case CaptchaActionBanFor:
+		if a.Duration < MinBanDuration || a.Duration > MaxBanDuration {
+			return fmt.Errorf("%s.duration must be between %s and %s for ban_for", field, MinBanDuration, MaxBanDuration)
+		}
+		return nil
+	case CaptchaActionBan, CaptchaActionKick, CaptchaActionMute, CaptchaActionNone:
+	default:
+		return fmt.Errorf(
+			"%s must be one of %q, %q, %q, %q or %q",
+			field,
+			CaptchaActionBan,
+			CaptchaActionBanFor,
+			CaptchaActionKick,
+			CaptchaActionMute,
+			CaptchaActionNone,
+		)
+	}
+	if a.Duration != 0 {
+		return fmt.Errorf("%s.duration is only valid with ban_for", field)
+	}
+	return nil
 }
 
 type CaptchaConfig struct {
-	Expiration       time.Duration `yaml:"expiration"`
-	CleanupInterval  time.Duration `yaml:"cleanup_interval"`
-	MaxFailures      int           `yaml:"max_failures"`
-	FailureNoticeTTL time.Duration `yaml:"failure_notice_ttl"`
+	Expiration       time.Duration      `yaml:"expiration"`
+	CleanupInterval  time.Duration      `yaml:"cleanup_interval"`
+	MaxFailures      int                `yaml:"max_failures"`
+	FailureNoticeTTL time.Duration      `yaml:"failure_notice_ttl"`
+	Store            string             `yaml:"store"`
+	Delivery         string             `yaml:"delivery"`
+	Challenge        string             `yaml:"challenge"`
+	AnswerCount      int                `yaml:"answer_count"`
+	DecoyCount       int                `yaml:"decoy_count"`
+	ButtonsPerRow    int                `yaml:"buttons_per_row"`
+	Image            CaptchaImageConfig `yaml:"image"`
+	PoolSize         int                `yaml:"pool_size"`
+	OnFailure        CaptchaAction      `yaml:"on_failure"`
+	OnTimeout        CaptchaAction      `yaml:"on_timeout"`
+	Language         string             `yaml:"language"`
+	// LogChat is the chat ID that receives moderation records. Zero
+	// disables them.
+	LogChat int64 `yaml:"log_chat"`
+}
+
+// CaptchaImageConfig toggles the distortion passes applied to rendered
+// challenge images.
+type CaptchaImageConfig struct {
+	Scale          bool `yaml:"scale"`
+	Jitter         bool `yaml:"jitter"`
+	HueShift       bool `yaml:"hue_shift"`
+	NoiseLines     bool `yaml:"noise_lines"`
+	NoiseDots      bool `yaml:"noise_dots"`
+	BackgroundCrop bool `yaml:"background_crop"`
 }
 
 func DefaultRuntimeConfig() RuntimeConfig {
 	return RuntimeConfig{
 		Bot: BotConfig{
-			PollTimeout:    10 * time.Second,
-			RequestTimeout: 30 * time.Second,
+			PollTimeout:     10 * time.Second,
+			RequestTimeout:  30 * time.Second,
+			Mode:            BotModePolling,
+			ShutdownTimeout: 10 * time.Second,
 		},
 		Groups: make([]GroupTopicConfig, 0),
 		Captcha: CaptchaConfig{
@@ -54,6 +262,25 @@ func DefaultRuntimeConfig() RuntimeConfig {
 			CleanupInterval:  5 * time.Second,
 			MaxFailures:      2,
 			FailureNoticeTTL: 15 * time.Second,
+			Store:            ChallengeStoreFile,
+			Delivery:         CaptchaDeliveryGroup,
+			Challenge:        captcha.DefaultType,
+			AnswerCount:      4,
+			DecoyCount:       6,
+			ButtonsPerRow:    5,
+			OnFailure:        CaptchaAction{Action: CaptchaActionBan},
+			OnTimeout:        CaptchaAction{Action: CaptchaActionBan},
+			Language:         i18n.DefaultLanguage,
+		},
+		AdminServer: AdminServerConfig{
+			ReadyThreshold: 2 * time.Minute,
+		},
+		Metrics: MetricsConfig{
+			Path: DefaultMetricsPath,
+		},
+		Logging: LoggingConfig{
+			Format: logging.FormatText,
+			Level:  logging.LevelInfo.String(),
 		},
 	}
 }
@@ -73,9 +300,17 @@ func Load(path string) (RuntimeConfig, error) {
 		return RuntimeConfig{}, fmt.Errorf("decode YAML config file %q: %w", path, err)
 	}
 
+	if err := applyOverrides(&cfg, filepath.Dir(path), os.LookupEnv); err != nil {
+		return RuntimeConfig{}, fmt.Errorf("invalid config file %q: %w", path, err)
+	}
 	if err := cfg.Validate(); err != nil {
 		return RuntimeConfig{}, fmt.Errorf("invalid config file %q: %w", path, err)
 	}
+	if cfg.Assets.Dir != "" && !filepath.IsAbs(cfg.Assets.Dir) {
+		// Relative asset packs live next to the config file, not the
+		// working directory of the process.
+		cfg.Assets.Dir = filepath.Join(filepath.Dir(path), cfg.Assets.Dir)
+	}
 
 	return cfg, nil
 }
@@ -90,6 +325,12 @@ func (c *RuntimeConfig) Validate() error {
 	if c.Bot.RequestTimeout <= 0 {
 		return fmt.Errorf("bot.request_timeout must be greater than zero")
 	}
+	if c.Bot.ShutdownTimeout <= 0 {
+		return fmt.Errorf("bot.shutdown_timeout must be greater than zero")
+	}
+	if err := c.Bot.validateMode(); err != nil {
+		return err
+	}
 
 	adminUsers := make(map[int64]struct{}, len(c.Bot.AdminUserIDs))
 	for _, userID := range c.Bot.AdminUserIDs {
@@ -106,9 +347,10 @@ func (c *RuntimeConfig) Validate() error {
 		c.Groups = nil
 		c.groupAllow = make(map[string]struct{})
 		c.groupTopics = make(map[string]int)
+		c.groupPolicies = make(map[string]ChatPolicy)
 	} else {
 		if len(c.Groups) == 0 {
-			return fmt.Errorf("groups must contain at least one public group when bot.admin_user_ids is set")
+			return fmt.Errorf("groups must contain at least one group when bot.admin_user_ids is set")
 		}
 
 		groupAllow := make(map[string]struct{}, len(c.Groups))
@@ -116,18 +358,22 @@ func (c *RuntimeConfig) Validate() error {
 		seen := make(map[string]struct{}, len(c.Groups))
 
 		for i, group := range c.Groups {
-			normalizedGroupID, err := NormalizePublicGroupID(group.ID)
+			normalizedGroupID, err := NormalizeGroupID(group.ID)
 			if err != nil {
 				return fmt.Errorf("groups[%d].id is invalid: %w", i, err)
 			}
-			c.Groups[i].ID = "@" + normalizedGroupID
+			c.Groups[i].ID = displayGroupID(normalizedGroupID)
 
 			if _, exists := seen[normalizedGroupID]; exists {
-				return fmt.Errorf("groups[%d].id duplicates @%s", i, normalizedGroupID)
+				return fmt.Errorf("groups[%d].id duplicates %s", i, c.Groups[i].ID)
 			}
 			seen[normalizedGroupID] = struct{}{}
 			groupAllow[normalizedGroupID] = struct{}{}
 
+			if err := c.Groups[i].normalizePolicy(i); err != nil {
+				return err
+			}
+
 			topicID := group.Topic
 			if topicID < 0 {
 				return fmt.Errorf("groups[%d].topic must be greater than zero when set", i)
@@ -159,9 +405,292 @@ func (c *RuntimeConfig) Validate() error {
 	if c.Captcha.FailureNoticeTTL <= 0 {
 		return fmt.Errorf("captcha.failure_notice_ttl must be greater than zero")
 	}
+
+	if c.Captcha.AnswerCount <= 0 {
+		return fmt.Errorf("captcha.answer_count must be greater than zero")
+	}
+	if c.Captcha.DecoyCount <= 0 {
+		return fmt.Errorf("captcha.decoy_count must be greater than zero")
+	}
+	c.Assets.Dir = strings.TrimSpace(c.Assets.Dir)
+	// A pack from assets.dir is checked against the difficulty when it is
+	// loaded; without one the embedded pack must fit it.
+	if total := c.Captcha.AnswerCount + c.Captcha.DecoyCount; c.Assets.Dir == "" && total > assets.Embedded().EmojiCount() {
+		return fmt.Errorf(
+			"captcha.answer_count + captcha.decoy_count must not exceed %d available emoji, got %d",
+			assets.Embedded().EmojiCount(),
+			total,
+		)
+	}
+	if c.Captcha.ButtonsPerRow <= 0 || c.Captcha.ButtonsPerRow > MaxButtonsPerRow {
+		return fmt.Errorf("captcha.buttons_per_row must be between 1 and %d", MaxButtonsPerRow)
+	}
+
+	if !c.Captcha.OnFailure.IsSet() {
+		c.Captcha.OnFailure.Action = CaptchaActionBan
+	}
+	if err := c.Captcha.OnFailure.normalize("captcha.on_failure"); err != nil {
+		return err
+	}
+	if !c.Captcha.OnTimeout.IsSet() {
+		c.Captcha.OnTimeout.Action = CaptchaActionBan
+	}
+	if err := c.Captcha.OnTimeout.normalize("captcha.on_timeout"); err != nil {
+		return err
+	}
+
+	if c.Captcha.PoolSize < 0 {
+		return fmt.Errorf("captcha.pool_size must not be negative")
+	}
+
+	c.Captcha.Store = strings.ToLower(strings.TrimSpace(c.Captcha.Store))
+	switch c.Captcha.Store {
+	case "":
+		c.Captcha.Store = ChallengeStoreFile
+	case ChallengeStoreMemory, ChallengeStoreFile:
+	default:
+		return fmt.Errorf("captcha.store must be one of %q or %q", ChallengeStoreMemory, ChallengeStoreFile)
+	}
+
+	c.Captcha.Delivery = strings.ToLower(strings.TrimSpace(c.Captcha.Delivery))
+	switch c.Captcha.Delivery {
+	case "":
+		c.Captcha.Delivery = CaptchaDeliveryGroup
+	case CaptchaDeliveryGroup, CaptchaDeliveryPrivate, CaptchaDeliveryPrivateWithFallback:
+	default:
+		return fmt.Errorf(
+			"captcha.delivery must be one of %q, %q or %q",
+			CaptchaDeliveryGroup,
+			CaptchaDeliveryPrivate,
+			CaptchaDeliveryPrivateWithFallback,
+		)
+	}
+
+	challenge, err := captcha.Lookup(c.Captcha.Challenge)
+	if err != nil {
+		return fmt.Errorf("captcha.challenge is invalid: %w", err)
+	}
+	c.Captcha.Challenge = challenge.Type()
+
+	if strings.TrimSpace(c.Captcha.Language) == "" {
+		c.Captcha.Language = i18n.DefaultLanguage
+	}
+	language, err := i18n.Normalize(c.Captcha.Language)
+	if err != nil {
+		return fmt.Errorf("captcha.language is invalid: %w", err)
+	}
+	c.Captcha.Language = language
+
+	// Group policies are resolved last so they inherit the normalized
+	// captcha section.
+	c.groupPolicies = make(map[string]ChatPolicy, len(c.Groups))
+	for _, group := range c.Groups {
+		c.groupPolicies[NormalizePublicGroupLookupID(group.ID)] = group.applyPolicy(c.defaultPolicy())
+	}
+
+	if err := c.validateAdminServer(); err != nil {
+		return err
+	}
+	return c.Logging.normalize()
+}
+
+func (l *LoggingConfig) normalize() error {
+	l.Format = strings.ToLower(strings.TrimSpace(l.Format))
+	switch l.Format {
+	case "":
+		l.Format = logging.FormatText
+	case logging.FormatText, logging.FormatJSON:
+	default:
+		return fmt.Errorf("logging.format must be one of %q or %q", logging.FormatText, logging.FormatJSON)
+	}
+
+	if strings.TrimSpace(l.Level) == "" {
+		l.Level = logging.LevelInfo.String()
+	}
+	level, err := logging.ParseLevel(l.Level)
+	if err != nil {
+		return fmt.Errorf("logging.level must be one of debug, info, warn or error")
+	}
+	l.Level = level.String()
+	return nil
+}
+
+// validateAdminServer checks admin_server and the endpoints mounted on it.
+func (c *RuntimeConfig) validateAdminServer() error {
+	server := &c.AdminServer
+	server.Listen = strings.TrimSpace(server.Listen)
+	if server.Listen != "" {
+		if _, _, err := net.SplitHostPort(server.Listen); err != nil {
+			return fmt.Errorf("admin_server.listen must be a host:port address: %w", err)
+		}
+	}
+	if server.ReadyThreshold <= 0 {
+		return fmt.Errorf("admin_server.ready_threshold must be greater than zero")
+	}
+
+	metrics := &c.Metrics
+	metrics.Path = strings.TrimSpace(metrics.Path)
+	if metrics.Path == "" {
+		metrics.Path = DefaultMetricsPath
+	}
+	if !strings.HasPrefix(metrics.Path, "/") {
+		return fmt.Errorf("metrics.path must start with /")
+	}
+	if metrics.Path == HealthzPath || metrics.Path == ReadyzPath {
+		return fmt.Errorf("metrics.path must not be %s or %s", HealthzPath, ReadyzPath)
+	}
+	if metrics.Enabled && server.Listen == "" {
+		return fmt.Errorf("metrics.enabled requires admin_server.listen")
+	}
 	return nil
 }
 
+// AdminServerEnabled reports whether the admin HTTP server should run.
+func (c RuntimeConfig) AdminServerEnabled() bool {
+	return c.AdminServer.Listen != ""
+}
+
+// normalizePolicy validates the captcha overrides of groups[index].
+func (g *GroupTopicConfig) normalizePolicy(index int) error {
+	if g.Expiration < 0 {
+		return fmt.Errorf("groups[%d].expiration must be greater than zero when set", index)
+	}
+	if g.MaxFailures < 0 {
+		return fmt.Errorf("groups[%d].max_failures must be greater than zero when set", index)
+	}
+	if g.FailureNoticeTTL < 0 {
+		return fmt.Errorf("groups[%d].failure_notice_ttl must be greater than zero when set", index)
+	}
+	if strings.TrimSpace(g.Challenge) != "" {
+		challenge, err := captcha.Lookup(g.Challenge)
+		if err != nil {
+			return fmt.Errorf("groups[%d].challenge is invalid: %w", index, err)
+		}
+		g.Challenge = challenge.Type()
+	}
+	if g.OnFailure.IsSet() {
+		if err := g.OnFailure.normalize(fmt.Sprintf("groups[%d].on_failure", index)); err != nil {
+			return err
+		}
+	}
+	if g.OnTimeout.IsSet() {
+		if err := g.OnTimeout.normalize(fmt.Sprintf("groups[%d].on_timeout", index)); err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(g.Language) != "" {
+		language, err := i18n.Normalize(g.Language)
+		if err != nil {
+			return fmt.Errorf("groups[%d].language is invalid: %w", index, err)
+		}
+		g.Language = language
+	}
+	return nil
+}
+
+// applyPolicy returns base with the overrides set on g.
+func (g GroupTopicConfig) applyPolicy(base ChatPolicy) ChatPolicy {
+	if g.Expiration > 0 {
+		base.Expiration = g.Expiration
+	}
+	if g.MaxFailures > 0 {
+		base.MaxFailures = g.MaxFailures
+	}
+	if g.FailureNoticeTTL > 0 {
+		base.FailureNoticeTTL = g.FailureNoticeTTL
+	}
+	if g.Challenge != "" {
+		base.Challenge = g.Challenge
+	}
+	if g.OnFailure.IsSet() {
+		base.OnFailure = g.OnFailure
+	}
+	if g.OnTimeout.IsSet() {
+		base.OnTimeout = g.OnTimeout
+	}
+	if g.Language != "" {
+		base.Language = g.Language
+	}
+	if g.LogChat != 0 {
+		base.LogChat = g.LogChat
+	}
+	return base
+}
+
+// IsLogChat reports whether chatID receives moderation records, globally
+// or for any group.
+func (c RuntimeConfig) IsLogChat(chatID int64) bool {
+	if chatID == 0 {
+		return false
+	}
+	if c.Captcha.LogChat == chatID {
+		return true
+	}
+	for _, policy := range c.groupPolicies {
+		if policy.LogChat == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *BotConfig) validateMode() error {
+	b.Mode = strings.ToLower(strings.TrimSpace(b.Mode))
+	switch b.Mode {
+	case "":
+		b.Mode = BotModePolling
+		return nil
+	case BotModePolling:
+		return nil
+	case BotModeWebhook:
+	default:
+		return fmt.Errorf("bot.mode must be one of %q or %q", BotModePolling, BotModeWebhook)
+	}
+
+	hook := &b.Webhook
+	hook.Listen = strings.TrimSpace(hook.Listen)
+	hook.PublicURL = strings.TrimSpace(hook.PublicURL)
+	hook.SecretToken = strings.TrimSpace(hook.SecretToken)
+	hook.TLSCert = strings.TrimSpace(hook.TLSCert)
+	hook.TLSKey = strings.TrimSpace(hook.TLSKey)
+
+	if hook.Listen == "" {
+		return fmt.Errorf("bot.webhook.listen is required when bot.mode is webhook")
+	}
+	if _, _, err := net.SplitHostPort(hook.Listen); err != nil {
+		return fmt.Errorf("bot.webhook.listen must be a host:port address: %w", err)
+	}
+	if hook.PublicURL == "" {
+		return fmt.Errorf("bot.webhook.public_url is required when bot.mode is webhook")
+	}
+	publicURL, err := url.Parse(hook.PublicURL)
+	if err != nil || publicURL.Scheme != "https" || publicURL.Host == "" {
+		return fmt.Errorf("bot.webhook.public_url must be an absolute https URL")
+	}
+	if hook.SecretToken != "" && !webhookSecretTokenPattern.MatchString(hook.SecretToken) {
+		return fmt.Errorf("bot.webhook.secret_token must be 1-256 characters of A-Z, a-z, 0-9, _ or -")
+	}
+	if (hook.TLSCert == "") != (hook.TLSKey == "") {
+		return fmt.Errorf("bot.webhook.tls_cert and bot.webhook.tls_key must be set together")
+	}
+	return nil
+}
+
+// Redacted returns a copy of c with its secrets masked, for printing.
+func (c RuntimeConfig) Redacted() RuntimeConfig {
+	if c.Bot.Token != "" {
+		c.Bot.Token = redactedValue
+	}
+	if c.Bot.Webhook.SecretToken != "" {
+		c.Bot.Webhook.SecretToken = redactedValue
+	}
+	return c
+}
+
+func (c RuntimeConfig) IsWebhookMode() bool {
+	return c.Bot.Mode == BotModeWebhook
+}
+
 func (c RuntimeConfig) IsPublicMode() bool {
 	return len(c.Bot.adminUsers) == 0
 }
@@ -182,6 +711,37 @@ func NormalizePublicGroupID(raw string) (string, error) {
 	return id, nil
 }
 
+// NormalizeGroupID returns the lookup key of a groups[].id entry: the
+// lowercase username without @ for public groups, or the decimal chat ID for
+// groups configured by numeric ID. Group chat IDs are always negative.
+func NormalizeGroupID(raw string) (string, error) {
+	id := strings.TrimSpace(raw)
+	if chatID, err := strconv.ParseInt(id, 10, 64); err == nil {
+		if chatID >= 0 {
+			return "", fmt.Errorf("numeric chat ID must be negative like -1001234567890")
+		}
+		return strconv.FormatInt(chatID, 10), nil
+	}
+	return NormalizePublicGroupID(id)
+}
+
+// displayGroupID turns a lookup key back into the form used in groups[].id.
+func displayGroupID(key string) string {
+	if _, err := strconv.ParseInt(key, 10, 64); err == nil {
+		return key
+	}
+	return "@" + key
+}
+
+// ChatID returns the numeric chat ID of a group configured by ID.
+func (g GroupTopicConfig) ChatID() (int64, bool) {
+	chatID, err := strconv.ParseInt(strings.TrimSpace(g.ID), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return chatID, true
+}
+
 func NormalizePublicGroupLookupID(raw string) string {
 	id := strings.TrimSpace(raw)
 	id = strings.TrimPrefix(id, "@")
@@ -218,25 +778,114 @@ func (c RuntimeConfig) GroupsList() []GroupTopicConfig {
 	return out
 }
 
-func (c RuntimeConfig) TopicForChatUsername(username string) int {
+// TopicForChat returns the forum topic configured for the group with chatID
+// or username.
+func (c RuntimeConfig) TopicForChat(chatID int64, username string) int {
 	if c.IsPublicMode() {
 		return 0
 	}
-	groupID := NormalizePublicGroupLookupID(username)
-	if groupID == "" {
+	groupID, ok := c.groupKey(chatID, username)
+	if !ok {
 		return 0
 	}
 	return c.groupTopics[groupID]
 }
 
-func (c RuntimeConfig) IsAllowedPublicGroupUsername(username string) bool {
+// groupKey returns the lookup key of the configured group matching chatID or
+// username. A match by chat ID wins, so renamed groups keep their settings.
+func (c RuntimeConfig) groupKey(chatID int64, username string) (string, bool) {
+	if chatID != 0 {
+		key := strconv.FormatInt(chatID, 10)
+		if _, ok := c.groupAllow[key]; ok {
+			return key, true
+		}
+	}
+	key := NormalizePublicGroupLookupID(username)
+	if key == "" {
+		return "", false
+	}
+	_, ok := c.groupAllow[key]
+	return key, ok
+}
+
+// defaultPolicy is the policy of chats without a group override, built from
+// the captcha section.
+func (c RuntimeConfig) defaultPolicy() ChatPolicy {
+	policy := ChatPolicy{
+		Expiration:       c.Captcha.Expiration,
+		MaxFailures:      c.Captcha.MaxFailures,
+		FailureNoticeTTL: c.Captcha.FailureNoticeTTL,
+		Challenge:        c.Captcha.Challenge,
+		OnFailure:        c.Captcha.OnFailure,
+		OnTimeout:        c.Captcha.OnTimeout,
+		Language:         c.Captcha.Language,
+		LogChat:          c.Captcha.LogChat,
+	}
+	if policy.Challenge == "" {
+		policy.Challenge = captcha.DefaultType
+	}
+	if !policy.OnFailure.IsSet() {
+		policy.OnFailure = CaptchaAction{Action: CaptchaActionBan}
+	}
+	if !policy.OnTimeout.IsSet() {
+		policy.OnTimeout = CaptchaAction{Action: CaptchaActionBan}
+	}
+	if policy.Language == "" {
+		policy.Language = i18n.DefaultLanguage
+	}
+	return policy
+}
+
+// PolicyForChatUsername returns the captcha policy for the group, falling
+// back to the captcha section for unknown groups and in public mode.
+func (c RuntimeConfig) PolicyForChatUsername(username string) ChatPolicy {
+	return c.PolicyForChat(0, username)
+}
+
+// PolicyForChat returns the captcha policy for the group with chatID or
+// username, falling back to the captcha section for unknown groups and in
+// public mode.
+func (c RuntimeConfig) PolicyForChat(chatID int64, username string) ChatPolicy {
 	if c.IsPublicMode() {
-		return true
+		return c.defaultPolicy()
 	}
-	groupID := NormalizePublicGroupLookupID(username)
-	if groupID == "" {
-		return false
+	if groupID, ok := c.groupKey(chatID, username); ok {
+		if policy, ok := c.groupPolicies[groupID]; ok {
+			return policy
+		}
+	}
+	return c.defaultPolicy()
+}
+
+// IsPrivateDelivery reports whether challenges are opened in a private chat
+// through a deep link posted in the group.
+func (c CaptchaConfig) IsPrivateDelivery() bool {
+	return c.Delivery == CaptchaDeliveryPrivate || c.Delivery == CaptchaDeliveryPrivateWithFallback
+}
+
+// ChallengeTypes returns every challenge type in use by captcha.challenge or
+// a group override, sorted.
+func (c RuntimeConfig) ChallengeTypes() []string {
+	seen := map[string]struct{}{c.defaultPolicy().Challenge: {}}
+	if !c.IsPublicMode() {
+		for _, policy := range c.groupPolicies {
+			seen[policy.Challenge] = struct{}{}
+		}
+	}
+	kinds := make([]string, 0, len(seen))
+	for kind := range seen {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// IsAllowedGroup reports whether the group with chatID or username is
+// listed in groups. Every group is allowed in public mode.
+func (c RuntimeConfig) IsAllowedGroup(chatID int64, username string) bool {
+	if c.IsPublicMode() {
+		return true
 	}
-	_, ok := c.groupAllow[groupID]
+	_, ok := c.groupKey(chatID, username)
 	return ok
 }
@@ -3,8 +3,15 @@ package settings
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"toshiki-captcha-bot/assets"
+	"toshiki-captcha-bot/internal/captcha"
+
+	"gopkg.in/yaml.v2"
 )
 
 func TestRuntimeConfigValidate(t *testing.T) {
@@ -32,6 +39,81 @@ func TestRuntimeConfigValidate(t *testing.T) {
 			},
 			wantErr: "bot.poll_timeout",
 		},
+		{
+			name: "invalid shutdown timeout",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.ShutdownTimeout = 0
+			},
+			wantErr: "bot.shutdown_timeout",
+		},
+		{
+			name: "invalid bot mode",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.Mode = "push"
+			},
+			wantErr: "bot.mode",
+		},
+		{
+			name: "valid webhook mode",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.Mode = "Webhook"
+				cfg.Bot.Webhook = WebhookConfig{
+					Listen:      ":8443",
+					PublicURL:   "https://bot.example.com/telegram",
+					SecretToken: "secret_token-1",
+					TLSCert:     "/etc/bot/cert.pem",
+					TLSKey:      "/etc/bot/key.pem",
+				}
+			},
+		},
+		{
+			name: "webhook mode requires listen",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.Mode = BotModeWebhook
+				cfg.Bot.Webhook = WebhookConfig{PublicURL: "https://bot.example.com/telegram"}
+			},
+			wantErr: "bot.webhook.listen is required",
+		},
+		{
+			name: "webhook mode rejects invalid listen",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.Mode = BotModeWebhook
+				cfg.Bot.Webhook = WebhookConfig{Listen: "8443", PublicURL: "https://bot.example.com/telegram"}
+			},
+			wantErr: "bot.webhook.listen must be a host:port address",
+		},
+		{
+			name: "webhook mode requires https public url",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.Mode = BotModeWebhook
+				cfg.Bot.Webhook = WebhookConfig{Listen: ":8443", PublicURL: "http://bot.example.com/telegram"}
+			},
+			wantErr: "bot.webhook.public_url must be an absolute https URL",
+		},
+		{
+			name: "webhook mode rejects invalid secret token",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.Mode = BotModeWebhook
+				cfg.Bot.Webhook = WebhookConfig{
+					Listen:      ":8443",
+					PublicURL:   "https://bot.example.com/telegram",
+					SecretToken: "not allowed!",
+				}
+			},
+			wantErr: "bot.webhook.secret_token",
+		},
+		{
+			name: "webhook mode requires tls pair",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.Mode = BotModeWebhook
+				cfg.Bot.Webhook = WebhookConfig{
+					Listen:    ":8443",
+					PublicURL: "https://bot.example.com/telegram",
+					TLSCert:   "/etc/bot/cert.pem",
+				}
+			},
+			wantErr: "must be set together",
+		},
 		{
 			name: "invalid admin user id",
 			mutate: func(cfg *RuntimeConfig) {
@@ -86,7 +168,7 @@ func TestRuntimeConfigValidate(t *testing.T) {
 				cfg.Bot.AdminUserIDs = []int64{1001}
 				cfg.Groups = nil
 			},
-			wantErr: "groups must contain at least one public group when bot.admin_user_ids is set",
+			wantErr: "groups must contain at least one group when bot.admin_user_ids is set",
 		},
 		{
 			name: "public mode discards groups config",
@@ -124,6 +206,299 @@ func TestRuntimeConfigValidate(t *testing.T) {
 			},
 			wantErr: "captcha.failure_notice_ttl",
 		},
+		{
+			name: "memory challenge store",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.Store = " Memory "
+			},
+		},
+		{
+			name: "invalid challenge store",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.Store = "redis"
+			},
+			wantErr: "captcha.store",
+		},
+		{
+			name: "custom difficulty",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.AnswerCount = 8
+				cfg.Captcha.DecoyCount = 8
+				cfg.Captcha.ButtonsPerRow = 4
+			},
+		},
+		{
+			name: "invalid answer count",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.AnswerCount = 0
+			},
+			wantErr: "captcha.answer_count",
+		},
+		{
+			name: "invalid decoy count",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.DecoyCount = -1
+			},
+			wantErr: "captcha.decoy_count",
+		},
+		{
+			name: "difficulty exceeds emoji pool",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.AnswerCount = assets.Embedded().EmojiCount()
+				cfg.Captcha.DecoyCount = 1
+			},
+			wantErr: "must not exceed",
+		},
+		{
+			name: "difficulty left to configured asset pack",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Assets.Dir = "/srv/captcha-assets"
+				cfg.Captcha.AnswerCount = assets.Embedded().EmojiCount()
+				cfg.Captcha.DecoyCount = 1
+			},
+		},
+		{
+			name: "invalid buttons per row",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.ButtonsPerRow = MaxButtonsPerRow + 1
+			},
+			wantErr: "captcha.buttons_per_row",
+		},
+		{
+			name: "invalid pool size",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.PoolSize = -1
+			},
+			wantErr: "captcha.pool_size",
+		},
+		{
+			name: "arithmetic challenge type",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.Challenge = " Arithmetic "
+			},
+		},
+		{
+			name: "invalid challenge type",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.Challenge = "crossword"
+			},
+			wantErr: "captcha.challenge",
+		},
+		{
+			name: "invalid group challenge type",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.AdminUserIDs = []int64{1001}
+				cfg.Groups = []GroupTopicConfig{{ID: "@somegroup", Challenge: "crossword"}}
+			},
+			wantErr: "groups[0].challenge",
+		},
+		{
+			name: "private delivery",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.Delivery = " Private_With_Fallback "
+			},
+		},
+		{
+			name: "invalid delivery",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.Delivery = "carrier_pigeon"
+			},
+			wantErr: "captcha.delivery",
+		},
+		{
+			name: "failure and timeout actions",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.OnFailure = CaptchaAction{Action: " Kick "}
+				cfg.Captcha.OnTimeout = CaptchaAction{Action: CaptchaActionBanFor, Duration: time.Hour}
+			},
+		},
+		{
+			name: "empty failure action defaults to ban",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.OnFailure = CaptchaAction{}
+			},
+		},
+		{
+			name: "invalid failure action",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.OnFailure = CaptchaAction{Action: "shame"}
+			},
+			wantErr: "captcha.on_failure must be one of",
+		},
+		{
+			name: "ban_for without duration",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.OnTimeout = CaptchaAction{Action: CaptchaActionBanFor}
+			},
+			wantErr: "captcha.on_timeout.duration must be between",
+		},
+		{
+			name: "ban_for longer than telegram allows",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.OnFailure = CaptchaAction{Action: CaptchaActionBanFor, Duration: MaxBanDuration + time.Hour}
+			},
+			wantErr: "captcha.on_failure.duration",
+		},
+		{
+			name: "duration on action without one",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.OnFailure = CaptchaAction{Action: CaptchaActionKick, Duration: time.Hour}
+			},
+			wantErr: "captcha.on_failure.duration is only valid with ban_for",
+		},
+		{
+			name: "invalid group timeout action",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.AdminUserIDs = []int64{1001}
+				cfg.Groups = []GroupTopicConfig{{ID: "@somegroup", OnTimeout: CaptchaAction{Action: "shame"}}}
+			},
+			wantErr: "groups[0].on_timeout",
+		},
+		{
+			name: "language",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.Language = " ZH "
+			},
+		},
+		{
+			name: "invalid language",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Captcha.Language = "klingon"
+			},
+			wantErr: "captcha.language is invalid",
+		},
+		{
+			name: "group policy overrides",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.AdminUserIDs = []int64{1001}
+				cfg.Groups = []GroupTopicConfig{{
+					ID:               "@somegroup",
+					Expiration:       5 * time.Minute,
+					MaxFailures:      4,
+					FailureNoticeTTL: time.Minute,
+					Language:         "zh",
+				}}
+			},
+		},
+		{
+			name: "negative group expiration",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.AdminUserIDs = []int64{1001}
+				cfg.Groups = []GroupTopicConfig{{ID: "@somegroup", Expiration: -time.Second}}
+			},
+			wantErr: "groups[0].expiration must be greater than zero when set",
+		},
+		{
+			name: "negative group max failures",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.AdminUserIDs = []int64{1001}
+				cfg.Groups = []GroupTopicConfig{{ID: "@somegroup", MaxFailures: -1}}
+			},
+			wantErr: "groups[0].max_failures must be greater than zero when set",
+		},
+		{
+			name: "negative group failure notice ttl",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.AdminUserIDs = []int64{1001}
+				cfg.Groups = []GroupTopicConfig{{ID: "@somegroup", FailureNoticeTTL: -time.Second}}
+			},
+			wantErr: "groups[0].failure_notice_ttl must be greater than zero when set",
+		},
+		{
+			name: "invalid group language",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.AdminUserIDs = []int64{1001}
+				cfg.Groups = []GroupTopicConfig{{ID: "@somegroup", Language: "klingon"}}
+			},
+			wantErr: "groups[0].language is invalid",
+		},
+		{
+			name: "group by numeric chat id",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.AdminUserIDs = []int64{1001}
+				cfg.Groups = []GroupTopicConfig{{ID: " -1001234567890 "}, {ID: "@somegroup"}}
+			},
+		},
+		{
+			name: "positive group chat id",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.AdminUserIDs = []int64{1001}
+				cfg.Groups = []GroupTopicConfig{{ID: "1234567890"}}
+			},
+			wantErr: "groups[0].id is invalid: numeric chat ID must be negative",
+		},
+		{
+			name: "duplicate group chat id",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Bot.AdminUserIDs = []int64{1001}
+				cfg.Groups = []GroupTopicConfig{{ID: "-1001234567890"}, {ID: "-01001234567890"}}
+			},
+			wantErr: "groups[1].id duplicates -1001234567890",
+		},
+		{
+			name: "admin server with metrics",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.AdminServer.Listen = "127.0.0.1:9090"
+				cfg.Metrics = MetricsConfig{Enabled: true, Path: "/prom"}
+			},
+		},
+		{
+			name: "admin server rejects invalid listen",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.AdminServer.Listen = "9090"
+			},
+			wantErr: "admin_server.listen must be a host:port address",
+		},
+		{
+			name: "admin server rejects zero ready threshold",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.AdminServer.ReadyThreshold = 0
+			},
+			wantErr: "admin_server.ready_threshold must be greater than zero",
+		},
+		{
+			name: "metrics require admin server",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Metrics.Enabled = true
+			},
+			wantErr: "metrics.enabled requires admin_server.listen",
+		},
+		{
+			name: "metrics rejects relative path",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.AdminServer.Listen = ":9090"
+				cfg.Metrics = MetricsConfig{Enabled: true, Path: "metrics"}
+			},
+			wantErr: "metrics.path must start with /",
+		},
+		{
+			name: "metrics rejects health path",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.AdminServer.Listen = ":9090"
+				cfg.Metrics = MetricsConfig{Enabled: true, Path: "/readyz"}
+			},
+			wantErr: "metrics.path must not be /healthz or /readyz",
+		},
+		{
+			name: "json logging at debug level",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Logging = LoggingConfig{Format: " JSON ", Level: "Debug"}
+			},
+		},
+		{
+			name: "invalid logging format",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Logging.Format = "logfmt"
+			},
+			wantErr: `logging.format must be one of "text" or "json"`,
+		},
+		{
+			name: "invalid logging level",
+			mutate: func(cfg *RuntimeConfig) {
+				cfg.Logging.Level = "trace"
+			},
+			wantErr: "logging.level must be one of debug, info, warn or error",
+		},
 	}
 
 	for _, tt := range tests {
@@ -180,6 +555,12 @@ func TestLoadConfig(t *testing.T) {
 		if cfg.Bot.PollTimeout != want.Bot.PollTimeout {
 			t.Fatalf("Bot.PollTimeout = %v, want %v", cfg.Bot.PollTimeout, want.Bot.PollTimeout)
 		}
+		if cfg.Bot.ShutdownTimeout != want.Bot.ShutdownTimeout {
+			t.Fatalf("Bot.ShutdownTimeout = %v, want %v", cfg.Bot.ShutdownTimeout, want.Bot.ShutdownTimeout)
+		}
+		if cfg.Bot.Mode != BotModePolling || cfg.IsWebhookMode() {
+			t.Fatalf("Bot.Mode = %q, want %q", cfg.Bot.Mode, BotModePolling)
+		}
 		if len(cfg.Bot.AdminUserIDs) != 0 {
 			t.Fatalf("Bot.AdminUserIDs length = %d, want 0", len(cfg.Bot.AdminUserIDs))
 		}
@@ -210,6 +591,54 @@ func TestLoadConfig(t *testing.T) {
 		if cfg.Captcha.FailureNoticeTTL != want.Captcha.FailureNoticeTTL {
 			t.Fatalf("Captcha.FailureNoticeTTL = %v, want %v", cfg.Captcha.FailureNoticeTTL, want.Captcha.FailureNoticeTTL)
 		}
+		if cfg.Captcha.Store != ChallengeStoreFile {
+			t.Fatalf("Captcha.Store = %q, want %q", cfg.Captcha.Store, ChallengeStoreFile)
+		}
+		if cfg.Captcha.AnswerCount != want.Captcha.AnswerCount || cfg.Captcha.DecoyCount != want.Captcha.DecoyCount {
+			t.Fatalf(
+				"Captcha counts = %d/%d, want %d/%d",
+				cfg.Captcha.AnswerCount,
+				cfg.Captcha.DecoyCount,
+				want.Captcha.AnswerCount,
+				want.Captcha.DecoyCount,
+			)
+		}
+		if cfg.Captcha.ButtonsPerRow != want.Captcha.ButtonsPerRow {
+			t.Fatalf("Captcha.ButtonsPerRow = %d, want %d", cfg.Captcha.ButtonsPerRow, want.Captcha.ButtonsPerRow)
+		}
+		if cfg.Captcha.Challenge != captcha.TypeEmojiSequence {
+			t.Fatalf("Captcha.Challenge = %q, want %q", cfg.Captcha.Challenge, captcha.TypeEmojiSequence)
+		}
+	})
+
+	t.Run("resolves relative assets dir against config directory", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config.yaml")
+		absolute := filepath.Join(t.TempDir(), "pack")
+		tests := []struct {
+			value string
+			want  string
+		}{
+			{value: "", want: ""},
+			{value: "themes/winter", want: filepath.Join(dir, "themes", "winter")},
+			{value: absolute, want: absolute},
+		}
+		for _, tt := range tests {
+			content := "bot:\n  token: test-token\nassets:\n  dir: \"" + tt.value + "\"\n"
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatalf("write config file: %v", err)
+			}
+
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load returned error: %v", err)
+			}
+			if cfg.Assets.Dir != tt.want {
+				t.Fatalf("Assets.Dir for %q = %q, want %q", tt.value, cfg.Assets.Dir, tt.want)
+			}
+		}
 	})
 
 	t.Run("private mode with groups and topics", func(t *testing.T) {
@@ -309,8 +738,8 @@ func TestLoadConfig(t *testing.T) {
 		if cfg.Groups[0].Topic != 0 {
 			t.Fatalf("Groups[0].Topic = %d, want 0", cfg.Groups[0].Topic)
 		}
-		if topic := cfg.TopicForChatUsername("somepublicgroup"); topic != 0 {
-			t.Fatalf("TopicForChatUsername(somepublicgroup) = %d, want 0", topic)
+		if topic := cfg.TopicForChat(0, "somepublicgroup"); topic != 0 {
+			t.Fatalf("TopicForChat(somepublicgroup) = %d, want 0", topic)
 		}
 		if _, ok := cfg.groupTopics["somepublicgroup"]; ok {
 			t.Fatalf("groupTopics[somepublicgroup] should not be set when topic is 1")
@@ -399,7 +828,7 @@ func TestLoadConfig(t *testing.T) {
 				"  admin_user_ids: [1001]",
 				"",
 			}, "\n"),
-			wantErr: "groups must contain at least one public group when bot.admin_user_ids is set",
+			wantErr: "groups must contain at least one group when bot.admin_user_ids is set",
 		},
 	}
 
@@ -425,6 +854,325 @@ func TestLoadConfig(t *testing.T) {
 	}
 }
 
+func TestLoadConfigCaptchaActions(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := strings.Join([]string{
+		"bot:",
+		"  token: test",
+		"  admin_user_ids: [1001]",
+		"captcha:",
+		"  on_failure: kick",
+		"  on_timeout:",
+		"    action: ban_for",
+		"    duration: 12h",
+		"groups:",
+		"  - id: '@strictgroup'",
+		"    on_failure: ban",
+		"  - id: '@quietgroup'",
+		"    on_timeout: mute",
+		"",
+	}, "\n")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		got      CaptchaAction
+		want     string
+		duration time.Duration
+	}{
+		{name: "global failure", got: cfg.PolicyForChatUsername("@unknown").OnFailure, want: CaptchaActionKick},
+		{name: "global timeout", got: cfg.PolicyForChatUsername("unknown").OnTimeout, want: CaptchaActionBanFor, duration: 12 * time.Hour},
+		{name: "group failure override", got: cfg.PolicyForChatUsername("StrictGroup").OnFailure, want: CaptchaActionBan},
+		{name: "group keeps global timeout", got: cfg.PolicyForChatUsername("strictgroup").OnTimeout, want: CaptchaActionBanFor, duration: 12 * time.Hour},
+		{name: "group timeout override", got: cfg.PolicyForChatUsername("@quietgroup").OnTimeout, want: CaptchaActionMute},
+	}
+	for _, tt := range tests {
+		if tt.got.Action != tt.want || tt.got.Duration != tt.duration {
+			t.Fatalf("%s = %+v, want %s %s", tt.name, tt.got, tt.want, tt.duration)
+		}
+	}
+}
+
+func TestCaptchaActionMarshalYAML(t *testing.T) {
+	t.Parallel()
+
+	raw, err := yaml.Marshal(struct {
+		Plain CaptchaAction `yaml:"plain"`
+		Timed CaptchaAction `yaml:"timed"`
+	}{
+		Plain: CaptchaAction{Action: CaptchaActionKick},
+		Timed: CaptchaAction{Action: CaptchaActionBanFor, Duration: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	want := "plain: kick\ntimed:\n  action: ban_for\n  duration: 1h0m0s\n"
+	if string(raw) != want {
+		t.Fatalf("Marshal = %q, want %q", raw, want)
+	}
+}
+
+func TestCaptchaDelivery(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		delivery    string
+		want        string
+		wantPrivate bool
+	}{
+		{delivery: "", want: CaptchaDeliveryGroup},
+		{delivery: "GROUP", want: CaptchaDeliveryGroup},
+		{delivery: "private", want: CaptchaDeliveryPrivate, wantPrivate: true},
+		{delivery: "private_with_fallback", want: CaptchaDeliveryPrivateWithFallback, wantPrivate: true},
+	}
+	for _, tt := range tests {
+		cfg := DefaultRuntimeConfig()
+		cfg.Bot.Token = "test-token"
+		cfg.Captcha.Delivery = tt.delivery
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("Validate(delivery=%q) returned error: %v", tt.delivery, err)
+		}
+		if cfg.Captcha.Delivery != tt.want || cfg.Captcha.IsPrivateDelivery() != tt.wantPrivate {
+			t.Fatalf("delivery %q = %q private=%t, want %q private=%t", tt.delivery, cfg.Captcha.Delivery, cfg.Captcha.IsPrivateDelivery(), tt.want, tt.wantPrivate)
+		}
+	}
+}
+
+func TestPolicyForChatUsername(t *testing.T) {
+	t.Parallel()
+
+	raw := `
+bot:
+  token: "test-token"
+  admin_user_ids: [1001]
+captcha:
+  expiration: 2m
+  max_failures: 3
+  failure_notice_ttl: 20s
+  challenge: arithmetic
+  on_failure: kick
+  log_chat: -1009000000001
+groups:
+  - id: "@strictgroup"
+    expiration: 30s
+    max_failures: 1
+    failure_notice_ttl: 1m
+    challenge: odd_one_out
+    on_failure: ban
+    on_timeout:
+      action: ban_for
+      duration: 1h
+    language: ZH
+    log_chat: -1009000000002
+  - id: "@plaingroup"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(raw), 0o600); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	global := ChatPolicy{
+		Expiration:       2 * time.Minute,
+		MaxFailures:      3,
+		FailureNoticeTTL: 20 * time.Second,
+		Challenge:        captcha.TypeArithmetic,
+		OnFailure:        CaptchaAction{Action: CaptchaActionKick},
+		OnTimeout:        CaptchaAction{Action: CaptchaActionBan},
+		Language:         "en",
+		LogChat:          -1009000000001,
+	}
+	strict := ChatPolicy{
+		Expiration:       30 * time.Second,
+		MaxFailures:      1,
+		FailureNoticeTTL: time.Minute,
+		Challenge:        captcha.TypeOddOneOut,
+		OnFailure:        CaptchaAction{Action: CaptchaActionBan},
+		OnTimeout:        CaptchaAction{Action: CaptchaActionBanFor, Duration: time.Hour},
+		Language:         "zh",
+		LogChat:          -1009000000002,
+	}
+
+	tests := []struct {
+		username string
+		want     ChatPolicy
+	}{
+		{username: "StrictGroup", want: strict},
+		{username: "@strictgroup", want: strict},
+		{username: "plaingroup", want: global},
+		{username: "unknowngroup", want: global},
+		{username: "", want: global},
+	}
+	for _, tt := range tests {
+		if got := cfg.PolicyForChatUsername(tt.username); got != tt.want {
+			t.Fatalf("PolicyForChatUsername(%q) = %+v, want %+v", tt.username, got, tt.want)
+		}
+	}
+
+}
+
+func TestIsLogChat(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultRuntimeConfig()
+	cfg.Bot.Token = "test-token"
+	cfg.Bot.AdminUserIDs = []int64{1001}
+	cfg.Captcha.LogChat = -1009000000001
+	cfg.Groups = []GroupTopicConfig{{ID: "@somegroup", LogChat: -1009000000002}, {ID: "@othergroup"}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+
+	tests := []struct {
+		chatID int64
+		want   bool
+	}{
+		{chatID: -1009000000001, want: true},
+		{chatID: -1009000000002, want: true},
+		{chatID: -1009000000003, want: false},
+		{chatID: 0, want: false},
+	}
+	for _, tt := range tests {
+		if got := cfg.IsLogChat(tt.chatID); got != tt.want {
+			t.Fatalf("IsLogChat(%d) = %t, want %t", tt.chatID, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyForChatUsernamePublicMode(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultRuntimeConfig()
+	cfg.Bot.Token = "test-token"
+	cfg.Groups = []GroupTopicConfig{{ID: "@somegroup", MaxFailures: 9, Language: "zh"}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+
+	got := cfg.PolicyForChatUsername("somegroup")
+	if got.MaxFailures != cfg.Captcha.MaxFailures || got.Language != "en" {
+		t.Fatalf("PolicyForChatUsername in public mode = %+v, want global policy", got)
+	}
+}
+
+func TestGroupLookupByChatID(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultRuntimeConfig()
+	cfg.Bot.Token = "test-token"
+	cfg.Bot.AdminUserIDs = []int64{1001}
+	cfg.Groups = []GroupTopicConfig{
+		{ID: "-1001234567890", Topic: 7, MaxFailures: 5},
+		{ID: "@somegroup", Topic: 3},
+		{ID: "-4321"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+
+	if got := cfg.Groups[0].ID; got != "-1001234567890" {
+		t.Fatalf("Groups[0].ID = %q, want -1001234567890", got)
+	}
+	if got, ok := cfg.Groups[0].ChatID(); !ok || got != -1001234567890 {
+		t.Fatalf("Groups[0].ChatID() = %d, %t, want -1001234567890, true", got, ok)
+	}
+	if _, ok := cfg.Groups[1].ChatID(); ok {
+		t.Fatalf("Groups[1].ChatID() ok = true for a username group")
+	}
+
+	if !cfg.IsAllowedGroup(-1001234567890, "") {
+		t.Fatalf("IsAllowedGroup(private group id) = false, want true")
+	}
+	if cfg.IsAllowedGroup(-1009, "") {
+		t.Fatalf("IsAllowedGroup(unlisted id) = true, want false")
+	}
+	if !cfg.IsAllowedGroup(-1009, "SomeGroup") {
+		t.Fatalf("IsAllowedGroup(listed username) = false, want true")
+	}
+
+	if got := cfg.TopicForChat(-1001234567890, ""); got != 7 {
+		t.Fatalf("TopicForChat(private group id) = %d, want 7", got)
+	}
+	// The chat ID wins over the username when both match different entries.
+	if got := cfg.TopicForChat(-1001234567890, "somegroup"); got != 7 {
+		t.Fatalf("TopicForChat(id and username) = %d, want 7", got)
+	}
+	if got := cfg.TopicForChat(-1009, "somegroup"); got != 3 {
+		t.Fatalf("TopicForChat(username) = %d, want 3", got)
+	}
+	if got := cfg.PolicyForChat(-1001234567890, "").MaxFailures; got != 5 {
+		t.Fatalf("PolicyForChat(private group id).MaxFailures = %d, want 5", got)
+	}
+	if got := cfg.PolicyForChat(-4321, "").MaxFailures; got != cfg.Captcha.MaxFailures {
+		t.Fatalf("PolicyForChat(group without overrides).MaxFailures = %d, want %d", got, cfg.Captcha.MaxFailures)
+	}
+}
+
+func TestNormalizeGroupID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input   string
+		want    string
+		wantErr string
+	}{
+		{input: "@SomeGroup", want: "somegroup"},
+		{input: " -1001234567890 ", want: "-1001234567890"},
+		{input: "-42", want: "-42"},
+		{input: "0", wantErr: "must be negative"},
+		{input: "42", wantErr: "must be negative"},
+		{input: "-12ab", wantErr: "must be a public group username"},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeGroupID(tt.input)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("NormalizeGroupID(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Fatalf("NormalizeGroupID(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestChallengeTypes(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultRuntimeConfig()
+	cfg.Bot.Token = "test-token"
+	cfg.Bot.AdminUserIDs = []int64{1001}
+	cfg.Groups = []GroupTopicConfig{
+		{ID: "@groupone", Challenge: captcha.TypeOddOneOut},
+		{ID: "@grouptwo", Challenge: captcha.TypeOddOneOut},
+		{ID: "@groupthree"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+
+	got := strings.Join(cfg.ChallengeTypes(), ",")
+	want := captcha.TypeEmojiSequence + "," + captcha.TypeOddOneOut
+	if got != want {
+		t.Fatalf("ChallengeTypes() = %q, want %q", got, want)
+	}
+}
+
 func TestNormalizePublicGroupID(t *testing.T) {
 	t.Parallel()
 
@@ -491,3 +1239,152 @@ func TestNormalizePublicGroupID(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyOverrides(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("file-token\n"), 0o600); err != nil {
+		t.Fatalf("write token file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "empty"), []byte(" \n"), 0o600); err != nil {
+		t.Fatalf("write empty token file: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		tokenFile  string
+		adminIDs   []int64
+		env        map[string]string
+		wantToken  string
+		wantAdmins []int64
+		wantErr    string
+	}{
+		{
+			name:      "config token only",
+			token:     "config-token",
+			wantToken: "config-token",
+		},
+		{
+			name:      "env token overrides config token",
+			token:     "config-token",
+			env:       map[string]string{EnvBotToken: "env-token"},
+			wantToken: "env-token",
+		},
+		{
+			name:      "token file relative to config dir",
+			tokenFile: "token",
+			wantToken: "file-token",
+		},
+		{
+			name:      "token file absolute path",
+			tokenFile: filepath.Join(dir, "token"),
+			wantToken: "file-token",
+		},
+		{
+			name:      "env token overrides token file",
+			tokenFile: "missing",
+			env:       map[string]string{EnvBotToken: "env-token"},
+			wantToken: "env-token",
+		},
+		{
+			name:      "empty env token is ignored",
+			token:     "config-token",
+			env:       map[string]string{EnvBotToken: "  "},
+			wantToken: "config-token",
+		},
+		{
+			name:      "token and token file are exclusive",
+			token:     "config-token",
+			tokenFile: "token",
+			wantErr:   "bot.token and bot.token_file are mutually exclusive",
+		},
+		{
+			name:      "missing token file",
+			tokenFile: "missing",
+			wantErr:   "read bot.token_file",
+		},
+		{
+			name:      "empty token file",
+			tokenFile: "empty",
+			wantErr:   "is empty",
+		},
+		{
+			name:       "env admins replace config admins",
+			token:      "config-token",
+			adminIDs:   []int64{1001},
+			env:        map[string]string{EnvBotAdminUserIDs: "2001, 2002,"},
+			wantToken:  "config-token",
+			wantAdmins: []int64{2001, 2002},
+		},
+		{
+			name:       "config admins without env",
+			token:      "config-token",
+			adminIDs:   []int64{1001},
+			wantToken:  "config-token",
+			wantAdmins: []int64{1001},
+		},
+		{
+			name:    "invalid env admin",
+			token:   "config-token",
+			env:     map[string]string{EnvBotAdminUserIDs: "1001,abc"},
+			wantErr: `CAPTCHA_BOT_ADMIN_USER_IDS: invalid user ID "abc"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := DefaultRuntimeConfig()
+			cfg.Bot.Token = tt.token
+			cfg.Bot.TokenFile = tt.tokenFile
+			cfg.Bot.AdminUserIDs = tt.adminIDs
+			lookupEnv := func(name string) (string, bool) {
+				value, ok := tt.env[name]
+				return value, ok
+			}
+
+			err := applyOverrides(&cfg, dir, lookupEnv)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyOverrides error = %v, want substring %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyOverrides returned error: %v", err)
+			}
+			if cfg.Bot.Token != tt.wantToken {
+				t.Fatalf("Bot.Token = %q, want %q", cfg.Bot.Token, tt.wantToken)
+			}
+			if !reflect.DeepEqual(cfg.Bot.AdminUserIDs, tt.wantAdmins) {
+				t.Fatalf("Bot.AdminUserIDs = %v, want %v", cfg.Bot.AdminUserIDs, tt.wantAdmins)
+			}
+		})
+	}
+}
+
+func TestLoadConfigEnvironmentOverrides(t *testing.T) {
+	t.Setenv(EnvBotToken, "env-token")
+	t.Setenv(EnvBotAdminUserIDs, "1001")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "bot:\n  token_file: token\ngroups:\n  - id: \"@somegroup\"\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Bot.Token != "env-token" {
+		t.Fatalf("Bot.Token = %q, want %q", cfg.Bot.Token, "env-token")
+	}
+	if cfg.IsPublicMode() || !cfg.HasAdminUser(1001) {
+		t.Fatalf("admin user 1001 from %s was not applied", EnvBotAdminUserIDs)
+	}
+}
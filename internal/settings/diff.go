@@ -0,0 +1,171 @@
+package settings
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const redactedValue = "<redacted>"
+
+// redactedPaths hold secrets whose values never show up in a diff.
+var redactedPaths = map[string]struct{}{
+	"bot.token":                {},
+	"bot.webhook.secret_token": {},
+}
+
+// Change is one setting that differs between two configs. Paths follow the
+// YAML layout, with groups addressed by ID such as groups[@mygroup].topic.
+type Change struct {
+	Path string
+	// Old is the previous value, empty when the group at Path was added.
+	Old string
+	// New is the current value, empty when the group at Path was removed.
+	New string
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Old == "":
+		return c.Path + ": added"
+	case c.New == "":
+		return c.Path + ": removed"
+	case c.Old == c.New:
+		return c.Path + ": changed"
+	default:
+		return fmt.Sprintf("%s: %s -> %s", c.Path, c.Old, c.New)
+	}
+}
+
+// Diff lists the settings that differ between old and next, in config file
+// order. Secrets are reported as changed without their values, and a group
+// that was added or removed is reported once rather than field by field.
+func Diff(old, next RuntimeConfig) []Change {
+	oldValues, oldPaths := flattenConfig(old)
+	nextValues, nextPaths := flattenConfig(next)
+
+	paths := oldPaths
+	for _, path := range nextPaths {
+		if _, exists := oldValues[path]; !exists {
+			paths = append(paths, path)
+		}
+	}
+
+	var changes []Change
+	var wholeGroups []string
+	for _, path := range paths {
+		if hasAnyPrefix(path, wholeGroups) {
+			continue
+		}
+		oldValue, inOld := oldValues[path]
+		nextValue, inNext := nextValues[path]
+		switch {
+		case !inOld:
+			wholeGroups = append(wholeGroups, path+".")
+			changes = append(changes, Change{Path: path, New: nextValue})
+		case !inNext:
+			wholeGroups = append(wholeGroups, path+".")
+			changes = append(changes, Change{Path: path, Old: oldValue})
+		case oldValue != nextValue:
+			if _, secret := redactedPaths[path]; secret {
+				oldValue, nextValue = redactedValue, redactedValue
+			}
+			changes = append(changes, Change{Path: path, Old: oldValue, New: nextValue})
+		}
+	}
+	return changes
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	actionType   = reflect.TypeOf(CaptchaAction{})
+)
+
+// flattenConfig renders every YAML setting of config as path -> value, and
+// returns the paths in declaration order. Each group is one node keyed by its
+// ID with its fields below it.
+func flattenConfig(config RuntimeConfig) (map[string]string, []string) {
+	values := map[string]string{}
+	var paths []string
+	flattenValue("", reflect.ValueOf(config), func(path, value string) {
+		values[path] = value
+		paths = append(paths, path)
+	})
+	return values, paths
+}
+
+func flattenValue(path string, value reflect.Value, add func(path, value string)) {
+	switch {
+	case value.Type() == actionType:
+		add(path, formatCaptchaAction(value.Interface().(CaptchaAction)))
+	case value.Type() == reflect.TypeOf([]GroupTopicConfig(nil)):
+		for i := 0; i < value.Len(); i++ {
+			group := value.Index(i)
+			groupPath := fmt.Sprintf("%s[%s]", path, group.FieldByName("ID").String())
+			add(groupPath, "present")
+			flattenFields(groupPath, group, add, "id")
+		}
+	case value.Kind() == reflect.Struct:
+		flattenFields(path, value, add, "")
+	default:
+		add(path, formatSettingValue(value))
+	}
+}
+
+func flattenFields(path string, value reflect.Value, add func(path, value string), skip string) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if field.PkgPath != "" || name == "" || name == "-" || name == skip {
+			continue
+		}
+		flattenValue(joinPath(path, name), value.Field(i), add)
+	}
+}
+
+func formatSettingValue(value reflect.Value) string {
+	switch {
+	case value.Type() == durationType:
+		return time.Duration(value.Int()).String()
+	case value.Kind() == reflect.String:
+		if value.String() == "" {
+			return `""`
+		}
+		return value.String()
+	case value.Kind() == reflect.Slice:
+		parts := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			parts = append(parts, formatSettingValue(value.Index(i)))
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	default:
+		return fmt.Sprint(value.Interface())
+	}
+}
+
+func formatCaptchaAction(action CaptchaAction) string {
+	if !action.IsSet() {
+		return `""`
+	}
+	if action.Duration != 0 {
+		return fmt.Sprintf("%s(%s)", action.Action, action.Duration)
+	}
+	return action.Action
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func hasAnyPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package settings
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	base := func() RuntimeConfig {
+		cfg := DefaultRuntimeConfig()
+		cfg.Bot.Token = "old-token"
+		cfg.Bot.AdminUserIDs = []int64{1001}
+		cfg.Groups = []GroupTopicConfig{{ID: "@keptgroup", Topic: 5}, {ID: "@oldgroup"}}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("Validate returned error: %v", err)
+		}
+		return cfg
+	}
+
+	tests := []struct {
+		name   string
+		modify func(cfg *RuntimeConfig)
+		want   []string
+	}{
+		{
+			name:   "unchanged",
+			modify: func(cfg *RuntimeConfig) {},
+		},
+		{
+			name: "scalar settings",
+			modify: func(cfg *RuntimeConfig) {
+				cfg.Captcha.Expiration = 2 * time.Minute
+				cfg.Captcha.Image.NoiseDots = true
+				cfg.Assets.Dir = "/srv/pack"
+			},
+			want: []string{
+				"captcha.expiration: 1m0s -> 2m0s",
+				"captcha.image.noise_dots: false -> true",
+				`assets.dir: "" -> /srv/pack`,
+			},
+		},
+		{
+			name: "secrets are redacted",
+			modify: func(cfg *RuntimeConfig) {
+				cfg.Bot.Token = "new-token"
+			},
+			want: []string{"bot.token: changed"},
+		},
+		{
+			name: "admins and groups",
+			modify: func(cfg *RuntimeConfig) {
+				cfg.Bot.AdminUserIDs = []int64{1001, 1002}
+				cfg.Groups = []GroupTopicConfig{
+					{ID: "@keptgroup", Topic: 7, OnFailure: CaptchaAction{Action: CaptchaActionBanFor, Duration: time.Hour}},
+					{ID: "@newgroup", Topic: 3},
+				}
+			},
+			want: []string{
+				"bot.admin_user_ids: [1001] -> [1001, 1002]",
+				"groups[@keptgroup].topic: 5 -> 7",
+				`groups[@keptgroup].on_failure: "" -> ban_for(1h0m0s)`,
+				"groups[@oldgroup]: removed",
+				"groups[@newgroup]: added",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			old := base()
+			next := base()
+			tt.modify(&next)
+			if err := next.Validate(); err != nil {
+				t.Fatalf("Validate returned error: %v", err)
+			}
+
+			var got []string
+			for _, change := range Diff(old, next) {
+				got = append(got, change.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Diff = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
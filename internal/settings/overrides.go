@@ -0,0 +1,85 @@
+package settings
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Environment variables that override the config file. They are meant for
+// container deployments where secrets should not be baked into config.yaml.
+const (
+	EnvBotToken        = "CAPTCHA_BOT_TOKEN"
+	EnvBotAdminUserIDs = "CAPTCHA_BOT_ADMIN_USER_IDS"
+)
+
+// applyOverrides resolves the bot token and admin list from their override
+// sources. The token is taken from, in order of precedence:
+// CAPTCHA_BOT_TOKEN, the file named by bot.token_file, then bot.token.
+// Setting both bot.token and bot.token_file in the file is an error.
+// CAPTCHA_BOT_ADMIN_USER_IDS, a comma-separated list, replaces
+// bot.admin_user_ids. Empty variables count as unset. A relative
+// bot.token_file is resolved against configDir.
+func applyOverrides(c *RuntimeConfig, configDir string, lookupEnv func(string) (string, bool)) error {
+	if c.Bot.TokenFile != "" && strings.TrimSpace(c.Bot.Token) != "" {
+		return fmt.Errorf("bot.token and bot.token_file are mutually exclusive")
+	}
+
+	if token, ok := lookupNonEmptyEnv(lookupEnv, EnvBotToken); ok {
+		c.Bot.Token = token
+	} else if c.Bot.TokenFile != "" {
+		token, err := readTokenFile(c.Bot.TokenFile, configDir)
+		if err != nil {
+			return err
+		}
+		c.Bot.Token = token
+	}
+
+	if raw, ok := lookupNonEmptyEnv(lookupEnv, EnvBotAdminUserIDs); ok {
+		ids, err := parseAdminUserIDs(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", EnvBotAdminUserIDs, err)
+		}
+		c.Bot.AdminUserIDs = ids
+	}
+	return nil
+}
+
+func lookupNonEmptyEnv(lookupEnv func(string) (string, bool), name string) (string, bool) {
+	value, ok := lookupEnv(name)
+	value = strings.TrimSpace(value)
+	return value, ok && value != ""
+}
+
+func readTokenFile(path, configDir string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(configDir, path)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read bot.token_file: %w", err)
+	}
+	token := strings.TrimSpace(string(raw))
+	if token == "" {
+		return "", fmt.Errorf("bot.token_file %q is empty", path)
+	}
+	return token, nil
+}
+
+func parseAdminUserIDs(raw string) ([]int64, error) {
+	var ids []int64
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user ID %q", field)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}